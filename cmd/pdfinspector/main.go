@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/stripe/stripe-go/v79"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"pdfinspector/pkg/config"
 	"pdfinspector/pkg/job"
@@ -24,6 +26,12 @@ func main() {
 		fmt.Println("Finished Executing main functionality via CLI")
 		return
 	}
+	if config.Mode == "resume" {
+		fmt.Printf("Resuming job %s from its checkpoint...\n", config.JobId)
+		cliResumeJob(config)
+		fmt.Println("Finished resuming job via CLI")
+		return
+	}
 
 	// Web server mode
 	stripe.Key = config.StripeSecretKey //not sure a better place to do this. this is probably fine.
@@ -88,8 +96,35 @@ func cliRunJob(config *config.ServiceConfig) {
 	inputJob.BaselineJSON = baselineJSON
 	//inputJob.OutputDir = filepath.Join(config.LocalPath, inputjob.Id) //should not use this for things that end up on gcs from a windows machine b/c it gets a backslash. idk probably should have local and gcs dirs saved separately so local can use local path sep and gcs always use forward slash.
 	inputJob.OutputDir = fmt.Sprintf("%s/%s", config.LocalPath, inputJob.Id)
+	inputJob.Budget.Fill(t.DefaultBudget())
+	err = t.PopulateJobModelSettings(inputJob)
+	if err != nil {
+		log.Fatal().Msgf("Error from populating model settings: %v", err)
+	}
+	_, err = t.PopulateJobPromptSet(inputJob)
+	if err != nil {
+		log.Fatal().Msgf("Error from populating prompt set: %v", err)
+	}
+
+	//ctrl-c stops the job rather than leaving gotenberg and ghostscript running
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = t.TuneResumeContents(ctx, inputJob, nil)
+	if err != nil {
+		log.Fatal().Msgf("Error from resume tuning: %v", err)
+	}
+}
 
-	err = t.TuneResumeContents(inputJob, nil)
+// cliResumeJob carries on an interrupted job (run from the cli or the server, so long as it's the same fstype and local path).
+func cliResumeJob(config *config.ServiceConfig) {
+	t := tuner.NewTuner(config)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	checkpoint, err := t.LoadCheckpoint(ctx, config.JobId)
+	if err != nil {
+		log.Fatal().Msgf("Error loading checkpoint: %v", err)
+	}
+	err = t.ContinueTuneResumeContents(ctx, checkpoint, nil)
 	if err != nil {
 		log.Fatal().Msgf("Error from resume tuning: %v", err)
 	}
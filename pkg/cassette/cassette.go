@@ -0,0 +1,179 @@
+package cassette
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A cassette is a directory of recorded outbound calls (LLM completions, PDF renders) keyed by a hash of the request.
+// In record mode every call goes out as normal and the response gets saved. In replay mode nothing goes out at all and
+// the recorded response is handed back instead, so that the whole tuning loop can be run deterministically for free.
+//
+// Layout on disk:
+//
+//	<dir>/<kind>/<key>     the recorded response for a request
+//	<dir>/<kind>.order     keys in the order they were recorded, one per line (used for sequence matching)
+type Mode string
+
+const (
+	ModeOff    Mode = "off"
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+)
+
+// Match decides how a request finds its recording during replay.
+type Match string
+
+const (
+	// MatchRequest needs the exact same request (hash) as was recorded. For true regression runs.
+	MatchRequest Match = "request"
+	// MatchSequence hands back recordings in the order they were made, regardless of request contents.
+	// Handy when refactoring prompts, since any change to a prompt changes the request hash.
+	MatchSequence Match = "sequence"
+)
+
+var ErrCassetteMiss = errors.New("no recording found in cassette")
+
+type Cassette struct {
+	Dir   string
+	Mode  Mode
+	Match Match
+
+	mu      sync.Mutex
+	cursors map[string]int
+	orders  map[string][]string
+}
+
+func New(dir string, mode Mode, match Match) (*Cassette, error) {
+	switch mode {
+	case ModeOff, ModeRecord, ModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode: %s", mode)
+	}
+	switch match {
+	case "":
+		match = MatchRequest
+	case MatchRequest, MatchSequence:
+	default:
+		return nil, fmt.Errorf("unknown cassette match: %s", match)
+	}
+	if mode != ModeOff && dir == "" {
+		return nil, errors.New("cassette dir must be specified when cassette mode is not off")
+	}
+	return &Cassette{
+		Dir:     dir,
+		Mode:    mode,
+		Match:   match,
+		cursors: map[string]int{},
+		orders:  map[string][]string{},
+	}, nil
+}
+
+func (c *Cassette) Recording() bool {
+	return c != nil && c.Mode == ModeRecord
+}
+
+func (c *Cassette) Replaying() bool {
+	return c != nil && c.Mode == ModeReplay
+}
+
+// Key is a sha256 of the JSON encoding of whatever identifies the request.
+func Key(request interface{}) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize cassette key: %v", err)
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Record saves a response under its key and notes the key in the order file.
+func (c *Cassette) Record(kind, key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kindDir := filepath.Join(c.Dir, kind)
+	if err := os.MkdirAll(kindDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(kindDir, key), data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette recording: %v", err)
+	}
+
+	orderFile, err := os.OpenFile(c.orderPath(kind), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette order file: %v", err)
+	}
+	defer orderFile.Close()
+	if _, err := fmt.Fprintln(orderFile, key); err != nil {
+		return fmt.Errorf("failed to write cassette order file: %v", err)
+	}
+	log.Debug().Msgf("cassette recorded %s/%s", kind, key)
+	return nil
+}
+
+// Replay finds the recorded response for a request, depending on the match setting.
+func (c *Cassette) Replay(kind, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Match == MatchSequence {
+		order, err := c.loadOrder(kind)
+		if err != nil {
+			return nil, err
+		}
+		cursor := c.cursors[kind]
+		if cursor >= len(order) {
+			return nil, fmt.Errorf("%w: %s call %d is past the end of the recording", ErrCassetteMiss, kind, cursor)
+		}
+		c.cursors[kind] = cursor + 1
+		key = order[cursor]
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.Dir, kind, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrCassetteMiss, kind, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette recording: %v", err)
+	}
+	log.Debug().Msgf("cassette replayed %s/%s", kind, key)
+	return data, nil
+}
+
+func (c *Cassette) orderPath(kind string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%s.order", kind))
+}
+
+func (c *Cassette) loadOrder(kind string) ([]string, error) {
+	if order, ok := c.orders[kind]; ok {
+		return order, nil
+	}
+	file, err := os.Open(c.orderPath(kind))
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't open %s order file: %v", ErrCassetteMiss, kind, err)
+	}
+	defer file.Close()
+
+	var order []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			order = append(order, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette order file: %v", err)
+	}
+	c.orders[kind] = order
+	return order, nil
+}
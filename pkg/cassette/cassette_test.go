@@ -0,0 +1,39 @@
+package cassette
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecordThenReplayByRequestAndBySequence(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := New(dir, ModeRecord, MatchRequest)
+	assert.NoError(t, err)
+
+	keyA, _ := Key(map[string]string{"prompt": "a"})
+	keyB, _ := Key(map[string]string{"prompt": "b"})
+	assert.NoError(t, recorder.Record("llm", keyA, []byte("response a")))
+	assert.NoError(t, recorder.Record("llm", keyB, []byte("response b")))
+
+	byRequest, _ := New(dir, ModeReplay, MatchRequest)
+	data, err := byRequest.Replay("llm", keyB)
+	assert.NoError(t, err)
+	assert.Equal(t, "response b", string(data))
+	keyC, _ := Key(map[string]string{"prompt": "c"})
+	_, err = byRequest.Replay("llm", keyC)
+	assert.ErrorIs(t, err, ErrCassetteMiss)
+
+	bySequence, _ := New(dir, ModeReplay, MatchSequence)
+	for _, expected := range []string{"response a", "response b"} {
+		data, err := bySequence.Replay("llm", keyC) //key doesn't matter in sequence mode
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+	}
+	_, err = bySequence.Replay("llm", keyC)
+	assert.ErrorIs(t, err, ErrCassetteMiss)
+}
+
+func TestNewRejectsUnknownMode(t *testing.T) {
+	_, err := New(t.TempDir(), "rewind", MatchRequest)
+	assert.Error(t, err)
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // ServiceConfig struct to hold the configuration values
@@ -18,6 +19,9 @@ type ServiceConfig struct {
 	GotenbergURL         string
 	JsonServerURL        string
 	ReactAppURL          string
+	Renderer             string //html (gotenberg, given html from our own templates), url (gotenberg loads the react app, which needs the json server), chromium or stub. see the render package
+	RenderMaxRetries     int    //how many times to retry a render that failed in a retryable way, eg gotenberg being busy
+	ChromiumPath         string //the binary the chromium renderer starts
 	FsType               string
 	Mode                 string
 	LocalPath            string
@@ -27,7 +31,7 @@ type ServiceConfig struct {
 	UseSystemGs          bool //in the deployed environment we will bake a gs into the image that runs this part, so we can just use a 'gs' command locally.
 	ServiceListenPort    string
 	AdminKey             string
-	UserCreditDeduct     int
+	UserCreditDeduct     int //per candidate, see job.CreditCost
 	LogLevel             int
 	FrontendClientID     string
 	FrontendClientSecret string
@@ -35,6 +39,28 @@ type ServiceConfig struct {
 	StripeSecretKey      string
 	StripeWebhookSecret  string
 	SchemasPath          string
+	PromptsPath          string //dir of prompt template sets, see the prompts package
+	PromptSet            string //the prompt set jobs use unless told otherwise
+	LLMProvider          string //openai, openai-compatible, anthropic or fake
+	LLMBaseURL           string //only used by openai-compatible, eg http://localhost:11434/v1 for ollama
+	AnthropicApiKey      string
+	LLMModel             string   //server wide default model for tuning, layouts and jobs can override it.
+	LLMTemperature       float64  //server wide default temperature
+	LLMMaxTokens         int      //0 means don't send a limit (well, anthropic has to have one so it uses its own default)
+	JDNotesModel         string   //model for the cheap JD note taking step, falls back to LLMModel
+	ExtractModel         string   //model for resume extraction which can be long, falls back to LLMModel
+	AllowedModels        []string //models that non-admin jobs are allowed to pick from
+	LLMMaxRetries        int      //how many times to retry rate limits, server errors and timeouts before giving up
+	LLMCallTimeout       int      //seconds, per individual call to the LLM provider
+	LLMStream            bool     //use streaming completions and forward progress as job status updates
+	CassetteMode         string   //off, record or replay - see the cassette package
+	CassetteDir          string
+	CassetteMatch        string //request (exact request hash) or sequence (in recorded order, so not with candidates)
+	JobId                string //the job to pick up from its checkpoint in resume mode
+	BudgetMaxAttempts    int    //default job budgets, see job.Budget. admins can override them per job.
+	ExtractMaxAttempts   int    //extraction gets its own number of attempts, the rest of its budget is the same
+	BudgetMaxWallSeconds int    //0 for no limit
+	BudgetMaxTokens      int    //0 for no limit
 }
 
 func InitLogging() int {
@@ -55,18 +81,36 @@ func GetResponseTemplatesDir() string {
 	return schemasDir
 }
 
+// GetPromptsDir is the prompts dir next to response_templates
+func GetPromptsDir() string {
+	originalDir, err := os.Getwd()
+	if err != nil {
+		panic("could not determine own path via os.Getwd")
+	}
+	promptsDir := filepath.Join(originalDir, "prompts")
+	log.Trace().Msgf("GetPromptsDir determined promptsDir: %s", promptsDir)
+	return promptsDir
+}
+
 // GetServiceConfig function to return a pointer to serviceConfig
 func GetServiceConfig(logLevel int) *ServiceConfig {
 	// Define CLI flags
 	gotenbergURL := flag.String("gotenberg-url", "", "URL for Gotenberg service")
 	jsonServerURL := flag.String("json-server-url", "", "URL for JSON server")
 	reactAppURL := flag.String("react-app-url", "", "URL for React app")
+	renderer := flag.String("renderer", "", "How resumes are rendered to PDF (html, url, chromium or stub)")
 	gcsBucket := flag.String("gcs-bucket", "", "File system type (local or gcs)")
 	openAiApiKey := flag.String("api-key", "", "OpenAI API Key")
 	localPath := flag.String("local-path", "", "Local path for outputs")
 	fstype := flag.String("fstype", "", "File system type (local or gcs)")
-	mode := flag.String("mode", "", "Mode of the application (server or cli)")
+	mode := flag.String("mode", "", "Mode of the application (server, cli or resume)")
+	jobId := flag.String("job-id", "", "Job to resume from its checkpoint, for resume mode")
 	useSystemGs := flag.Bool("use-system-gs", false, "Use GhostScript from the system instead of via docker run")
+	llmProvider := flag.String("llm-provider", "", "LLM provider (openai, openai-compatible, anthropic or fake)")
+	llmBaseURL := flag.String("llm-base-url", "", "Base URL for an openai-compatible LLM provider")
+	cassetteMode := flag.String("cassette-mode", "", "Record or replay LLM and Gotenberg calls (off, record or replay)")
+	cassetteDir := flag.String("cassette-dir", "", "Directory for cassette recordings")
+	cassetteMatch := flag.String("cassette-match", "", "How replayed calls find their recording (request or sequence)")
 
 	// Parse CLI flags
 	flag.Parse()
@@ -76,6 +120,9 @@ func GetServiceConfig(logLevel int) *ServiceConfig {
 		GotenbergURL:         getConfig(gotenbergURL, "GOTENBERG_URL", "http://localhost:80"),
 		JsonServerURL:        getConfig(jsonServerURL, "JSON_SERVER_URL", "http://localhost:3002"),
 		ReactAppURL:          getConfig(reactAppURL, "REACT_APP_URL", "http://host.docker.internal:3000"),
+		Renderer:             getConfig(renderer, "RENDERER", "html"),
+		RenderMaxRetries:     getConfigInt(nil, "RENDER_MAX_RETRIES", 2),
+		ChromiumPath:         getConfig(nil, "CHROMIUM_PATH", "chromium"),
 		OpenAiApiKey:         getConfig(openAiApiKey, "OPENAI_API_KEY", ""),
 		FsType:               getConfig(fstype, "FSTYPE", "local"),
 		GcsBucket:            getConfig(gcsBucket, "GCS_BUCKET", "my-stinky-bucket"),
@@ -91,6 +138,28 @@ func GetServiceConfig(logLevel int) *ServiceConfig {
 		StripeSecretKey:      getConfig(nil, "STRIPE_API_SECRET_KEY", ""), //todo make sure this gets put into secrets and set in the deploy.
 		StripeWebhookSecret:  getConfig(nil, "STRIPE_WEBHOOK_SECRET", ""), //todo make sure this gets put into secrets and set in the deploy.
 		SchemasPath:          GetResponseTemplatesDir(),
+		PromptsPath:          getConfig(nil, "PROMPTS_PATH", GetPromptsDir()),
+		PromptSet:            getConfig(nil, "PROMPT_SET", "default"),
+		LLMProvider:          getConfig(llmProvider, "LLM_PROVIDER", "openai"),
+		LLMBaseURL:           getConfig(llmBaseURL, "LLM_BASE_URL", ""),
+		AnthropicApiKey:      getConfig(nil, "ANTHROPIC_API_KEY", ""),
+		LLMModel:             getConfig(nil, "LLM_MODEL", "gpt-4o-mini"),
+		LLMTemperature:       getConfigFloat(nil, "LLM_TEMPERATURE", 0.7),
+		LLMMaxTokens:         getConfigInt(nil, "LLM_MAX_TOKENS", 0),
+		JDNotesModel:         getConfig(nil, "JD_NOTES_MODEL", ""),
+		ExtractModel:         getConfig(nil, "EXTRACT_MODEL", ""),
+		AllowedModels:        getConfigList(nil, "ALLOWED_MODELS", []string{"gpt-4o-mini"}),
+		LLMMaxRetries:        getConfigInt(nil, "LLM_MAX_RETRIES", 4),
+		LLMCallTimeout:       getConfigInt(nil, "LLM_CALL_TIMEOUT", 180),
+		LLMStream:            getConfigBool(nil, "LLM_STREAM", false),
+		CassetteMode:         getConfig(cassetteMode, "CASSETTE_MODE", "off"),
+		CassetteDir:          getConfig(cassetteDir, "CASSETTE_DIR", "cassettes"),
+		CassetteMatch:        getConfig(cassetteMatch, "CASSETTE_MATCH", "request"),
+		JobId:                getConfig(jobId, "JOB_ID", ""),
+		BudgetMaxAttempts:    getConfigInt(nil, "BUDGET_MAX_ATTEMPTS", 7),
+		ExtractMaxAttempts:   getConfigInt(nil, "BUDGET_MAX_EXTRACT_ATTEMPTS", 7),
+		BudgetMaxWallSeconds: getConfigInt(nil, "BUDGET_MAX_WALL_SECONDS", 720), //under the 15 minute request timeout, so a job stops with its best result rather than being cut off
+		BudgetMaxTokens:      getConfigInt(nil, "BUDGET_MAX_TOKENS", 0),
 	}
 
 	//Validation
@@ -101,10 +170,30 @@ func GetServiceConfig(logLevel int) *ServiceConfig {
 	if config.FsType == "local" && config.LocalPath == "" {
 		log.Fatal().Msg("Local path must be specified for local filesystem")
 	}
+	switch config.Renderer {
+	case "html", "url", "chromium", "stub":
+	default:
+		log.Fatal().Msgf("Unknown renderer %s, it should be html, url, chromium or stub", config.Renderer)
+	}
+	if config.BudgetMaxAttempts < 1 {
+		log.Fatal().Msg("The max attempts budget must be at least 1")
+	}
+	if config.ExtractMaxAttempts < 1 {
+		log.Fatal().Msg("The max extraction attempts budget must be at least 1")
+	}
+	if config.Mode == "resume" && config.JobId == "" {
+		log.Fatal().Msg("A job id must be specified to resume")
+	}
+	if config.LLMProvider == "openai-compatible" && config.LLMBaseURL == "" {
+		log.Fatal().Msg("LLM base URL must be specified for the openai-compatible LLM provider")
+	}
 	if config.Mode == "server" {
-		if config.OpenAiApiKey == "" {
+		if config.LLMProvider == "openai" && config.OpenAiApiKey == "" && config.CassetteMode != "replay" {
 			log.Fatal().Msg("An Open AI (what a misnomer lol) API Key is required for the server to be able to do anything interesting.")
 		}
+		if config.LLMProvider == "anthropic" && config.AnthropicApiKey == "" {
+			log.Fatal().Msg("An Anthropic API Key is required when using the anthropic LLM provider.")
+		}
 
 		//todo astute-backup-434623-h3 at least should probably be an env var. or ... idk a robot suggested GOOGLE_CLOUD_PROJECT in the env might have it
 		url, err := getServiceURL("astute-backup-434623-h3", "us-central1", "pdfinspector")
@@ -134,7 +223,7 @@ func getConfig(cliValue *string, envVar string, defaultValue string) string {
 }
 func getConfigBool(cliValue *bool, envVar string, defaultValue bool) bool {
 	// First, check if the CLI value is provided
-	if *cliValue {
+	if cliValue != nil && *cliValue {
 		return *cliValue
 	} else if envVal, exists := os.LookupEnv(envVar); exists {
 		// Otherwise, check if the environment variable exists and is parseable as a bool
@@ -165,6 +254,35 @@ func getConfigInt(cliValue *int, envVar string, defaultValue int) int {
 	return defaultValue
 }
 
+func getConfigFloat(cliValue *float64, envVar string, defaultValue float64) float64 {
+	if cliValue != nil && *cliValue != 0 {
+		return *cliValue
+	} else if envVal, exists := os.LookupEnv(envVar); exists {
+		parsedValue, err := strconv.ParseFloat(envVal, 64)
+		if err != nil {
+			return defaultValue
+		}
+		return parsedValue
+	}
+	return defaultValue
+}
+
+// getConfigList is for comma separated values, eg ALLOWED_MODELS=gpt-4o-mini,gpt-4o
+func getConfigList(cliValue *string, envVar string, defaultValue []string) []string {
+	raw := getConfig(cliValue, envVar, "")
+	if raw == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getServiceURL(projectID, location, serviceName string) (string, error) {
 	// Create a context
 	ctx := context.Background()
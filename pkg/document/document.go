@@ -0,0 +1,192 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The document package knows what's in the resumedata for each layout, so it can be turned into something a person
+// reads (HTML for the PDF renderer) without going via the React app. The types here follow the layout schemas in
+// response_templates, plus the handful of extra fields the renderer understands (hide, companydesc and so on, see
+// config.EnhanceSchemaWithRendererFields).
+
+const (
+	LAYOUT_CHRONO      = "chrono"
+	LAYOUT_FUNCTIONAL  = "functional"
+	LAYOUT_COVERLETTER = "coverletter"
+)
+
+type PersonalInfo struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Linkedin string `json:"linkedin"`
+	Location string `json:"location"`
+	Github   string `json:"github"`
+	Profile  string `json:"profile"`
+}
+
+type Education struct {
+	Institution string   `json:"institution"`
+	Location    string   `json:"location"`
+	Description string   `json:"description"`
+	Graduated   string   `json:"graduated"`
+	Notes       []string `json:"notes"`
+}
+
+type Chrono struct {
+	PersonalInfo PersonalInfo       `json:"personal_info"`
+	Skills       []string           `json:"skills"`
+	WorkHistory  []WorkHistoryEntry `json:"work_history"`
+	Education    []Education        `json:"education_v2"`
+}
+
+type WorkHistoryEntry struct {
+	Company     string    `json:"company"`
+	Tag         string    `json:"tag"`
+	CompanyDesc string    `json:"companydesc"`
+	Location    string    `json:"location"`
+	JobTitle    string    `json:"jobtitle"`
+	DateRange   string    `json:"daterange"`
+	Projects    []Project `json:"projects"`
+	Hide        bool      `json:"hide"`
+}
+
+type Project struct {
+	Desc            string `json:"desc"`
+	Github          string `json:"github"`
+	Location        string `json:"location"`
+	Tech            string `json:"tech"` //comma separated, unlike the functional layout
+	Hide            bool   `json:"hide"`
+	PageBreakBefore bool   `json:"pageBreakBefore"`
+}
+
+type Functional struct {
+	PersonalInfo      PersonalInfo      `json:"personal_info"`
+	Overview          string            `json:"overview"`
+	Education         []Education       `json:"education"`
+	FunctionalAreas   []FunctionalArea  `json:"functional_areas"`
+	EmploymentHistory []EmploymentEntry `json:"employment_history"`
+}
+
+type FunctionalArea struct {
+	Title            string            `json:"title"`
+	KeyContributions []KeyContribution `json:"key_contributions"`
+}
+
+type KeyContribution struct {
+	Description string   `json:"description"`
+	LeadIn      int      `json:"lead_in"` //how many words at the start of the description get highlighted
+	Tech        []string `json:"tech"`
+	DateRange   string   `json:"daterange"`
+	Company     string   `json:"company"`
+	Hide        bool     `json:"hide"`
+}
+
+type EmploymentEntry struct {
+	Title     string `json:"title"`
+	Company   string `json:"company"`
+	Location  string `json:"location"`
+	DateRange string `json:"daterange"`
+}
+
+type CoverLetter struct {
+	PersonalInfo   PersonalInfo `json:"personal_info"`
+	CompanyInfo    CompanyInfo  `json:"company_info"`
+	Date           string       `json:"date"`
+	LetterContents []string     `json:"letter_contents"`
+	Closing        string       `json:"closing"`
+}
+
+type CompanyInfo struct {
+	CompanyName      string `json:"company_name"`
+	OrganizationName string `json:"organization_name"`
+}
+
+// Document is resumedata decoded for its layout. Only the one for the layout is set.
+type Document struct {
+	Layout string
+	Style  string //"" for the default look
+
+	Chrono      *Chrono
+	Functional  *Functional
+	CoverLetter *CoverLetter
+}
+
+// Decode reads resumedata as it goes to the renderer, ie with the layout (and maybe style) keys in it, see insertLayout in the tuner.
+func Decode(resumedata []byte) (*Document, error) {
+	var header struct {
+		Layout string `json:"layout"`
+		Style  string `json:"style"`
+	}
+	err := json.Unmarshal(resumedata, &header)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding resumedata: %w", err)
+	}
+	doc := &Document{Layout: header.Layout, Style: header.Style}
+	switch header.Layout {
+	case LAYOUT_CHRONO:
+		doc.Chrono = &Chrono{}
+		err = json.Unmarshal(resumedata, doc.Chrono)
+	case LAYOUT_FUNCTIONAL:
+		doc.Functional = &Functional{}
+		err = json.Unmarshal(resumedata, doc.Functional)
+	case LAYOUT_COVERLETTER:
+		doc.CoverLetter = &CoverLetter{}
+		err = json.Unmarshal(resumedata, doc.CoverLetter)
+	default:
+		return nil, fmt.Errorf("unknown layout %q in resumedata", header.Layout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s resumedata: %w", header.Layout, err)
+	}
+	return doc, nil
+}
+
+// PersonalInfo is the personal info of whichever layout the document is.
+func (d *Document) PersonalInfo() PersonalInfo {
+	switch {
+	case d.Chrono != nil:
+		return d.Chrono.PersonalInfo
+	case d.Functional != nil:
+		return d.Functional.PersonalInfo
+	case d.CoverLetter != nil:
+		return d.CoverLetter.PersonalInfo
+	}
+	return PersonalInfo{}
+}
+
+// contactDetails is the non empty bits of contact info, in the order the header shows them.
+func (p PersonalInfo) contactDetails() []string {
+	var details []string
+	for _, detail := range []string{p.Location, p.Phone, p.Email, p.Linkedin, p.Github} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	return details
+}
+
+// LeadInWords is the highlighted start of the description, Rest is everything after it.
+func (k KeyContribution) LeadInWords() string {
+	words := strings.Fields(k.Description)
+	if k.LeadIn <= 0 {
+		return ""
+	}
+	if k.LeadIn > len(words) {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:k.LeadIn], " ")
+}
+
+func (k KeyContribution) Rest() string {
+	words := strings.Fields(k.Description)
+	if k.LeadIn <= 0 {
+		return strings.Join(words, " ")
+	}
+	if k.LeadIn >= len(words) {
+		return ""
+	}
+	return strings.Join(words[k.LeadIn:], " ")
+}
@@ -0,0 +1,78 @@
+package document
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const chronoResumedata = `{
+	"layout": "chrono",
+	"personal_info": {"name": "Sam <Smith>", "email": "sam@example.com", "phone": "555", "linkedin": null, "location": "Here", "github": "https://github.com/sam"},
+	"skills": ["go", "k8s"],
+	"work_history": [
+		{"company": "Acme", "tag": "acme", "location": "Here", "jobtitle": "Gopher", "daterange": "2020 - now",
+			"projects": [{"desc": "made things", "github": null, "location": "Here", "tech": "go, sql"}, {"desc": "secret project", "hide": true}]},
+		{"company": "Hidden Co", "jobtitle": "Intern", "hide": true, "projects": []}
+	],
+	"education_v2": [{"institution": "School", "location": null, "description": "BSc", "graduated": "2019", "notes": ["honours"]}]
+}`
+
+const functionalResumedata = `{
+	"layout": "functional",
+	"style": "fluffy",
+	"personal_info": {"name": "Sam", "email": "sam@example.com", "phone": "555", "linkedin": "https://linkedin.com/in/sam", "location": "Here", "github": null},
+	"overview": "Gopher of note.",
+	"education": [{"institution": "School", "location": "There", "description": "BSc", "graduated": "2019", "notes": null}],
+	"functional_areas": [{"title": "Backend", "key_contributions": [
+		{"description": "Built the   payments service in go", "lead_in": 2, "tech": ["go", "postgres"], "daterange": "2021", "company": "Acme"}
+	]}],
+	"employment_history": [{"title": "Gopher", "company": "Acme", "location": "Here", "daterange": "2020 - now"}]
+}`
+
+const coverletterResumedata = `{
+	"layout": "coverletter",
+	"personal_info": {"name": "Sam", "email": "sam@example.com", "phone": "555", "linkedin": null, "location": "Here", "github": null},
+	"company_info": {"company_name": "Widgets & Co", "organization_name": "Hiring Team"},
+	"date": "October 17, 2026",
+	"letter_contents": ["Dear Hiring Team,", "I'd like the job."],
+	"closing": "Sincerely,"
+}`
+
+func TestDecode(t *testing.T) {
+	doc, err := Decode([]byte(chronoResumedata))
+	if assert.NoError(t, err) && assert.NotNil(t, doc.Chrono) {
+		assert.Equal(t, LAYOUT_CHRONO, doc.Layout)
+		assert.Equal(t, "", doc.Style)
+		assert.Nil(t, doc.Functional)
+		assert.Equal(t, "", doc.Chrono.PersonalInfo.Linkedin, "null comes out empty")
+		assert.Len(t, doc.Chrono.WorkHistory, 2)
+		assert.True(t, doc.Chrono.WorkHistory[0].Projects[1].Hide)
+	}
+
+	doc, err = Decode([]byte(functionalResumedata))
+	if assert.NoError(t, err) && assert.NotNil(t, doc.Functional) {
+		assert.Equal(t, "fluffy", doc.Style)
+		assert.Equal(t, []string{"go", "postgres"}, doc.Functional.FunctionalAreas[0].KeyContributions[0].Tech)
+	}
+
+	_, err = Decode([]byte(`{"layout": "fancy"}`))
+	assert.Error(t, err)
+	_, err = Decode([]byte(`{"personal_info": {}}`))
+	assert.Error(t, err, "resumedata without a layout can't be rendered")
+	_, err = Decode([]byte(`{"layout": "chrono", "skills": "go"}`))
+	assert.Error(t, err)
+}
+
+func TestKeyContributionLeadIn(t *testing.T) {
+	contribution := KeyContribution{Description: "Built the   payments service", LeadIn: 2}
+	assert.Equal(t, "Built the", contribution.LeadInWords())
+	assert.Equal(t, "payments service", contribution.Rest())
+
+	contribution.LeadIn = 0
+	assert.Equal(t, "", contribution.LeadInWords())
+	assert.Equal(t, "Built the payments service", contribution.Rest())
+
+	contribution.LeadIn = 10
+	assert.Equal(t, "Built the payments service", contribution.LeadInWords())
+	assert.Equal(t, "", contribution.Rest())
+}
@@ -0,0 +1,183 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// A DOCX is a zip of WordprocessingML parts. Only the handful of parts Word (and LibreOffice, Google Docs etc) insist
+// on are written, with our own few paragraph styles, so the file opens with real headings and bullet lists that
+// applicant tracking systems can pick apart. There are no tables or text boxes, ATS parsers tend to choke on those.
+// The look doesn't follow the style (fluffy etc), Word files get sent on to be read, not admired.
+
+const DOCX_MIME_TYPE = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// PageSetup is the paper and margins a Word file is laid out on, in inches. It's the jobs print options, so the docx
+// comes out on the same paper as the PDF.
+type PageSetup struct {
+	Width, Height            float64
+	Top, Right, Bottom, Left float64
+}
+
+// twips is inches in twentieths of a point, which is what WordprocessingML measures pages in.
+func twips(inches float64) int {
+	return int(math.Round(inches * 1440))
+}
+
+// docxModified is the timestamp on every part, so the same document always zips up to the same bytes.
+var docxModified = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+const docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+const docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>
+</Relationships>`
+
+// sizes are in half points, spacing in twentieths of a point
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/><w:sz w:val="21"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="60"/></w:pPr></w:pPrDefault></w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:spacing w:after="40"/></w:pPr><w:rPr><w:b/><w:sz w:val="40"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="1" w:color="auto"/></w:pBdr><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="26"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="120" w:after="20"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:b/><w:sz w:val="22"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="ListBullet"><w:name w:val="List Bullet"/><w:basedOn w:val="Normal"/><w:pPr><w:numPr><w:numId w:val="1"/></w:numPr><w:spacing w:after="20"/></w:pPr></w:style>
+</w:styles>`
+
+const docxNumbering = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:abstractNum w:abstractNumId="0"><w:multiLevelType w:val="singleLevel"/><w:lvl w:ilvl="0"><w:start w:val="1"/><w:numFmt w:val="bullet"/><w:lvlText w:val="&#8226;"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="360" w:hanging="360"/></w:pPr></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+</w:numbering>`
+
+// docxBody builds up word/document.xml one paragraph at a time.
+type docxBody struct {
+	buf bytes.Buffer
+}
+
+func (b *docxBody) paragraph(style string, runs ...textRun) {
+	b.buf.WriteString("<w:p>")
+	if style != "" {
+		fmt.Fprintf(&b.buf, `<w:pPr><w:pStyle w:val="%s"/></w:pPr>`, style)
+	}
+	for _, run := range runs {
+		if run.text == "" {
+			continue
+		}
+		b.buf.WriteString("<w:r>")
+		if run.bold || run.italic {
+			b.buf.WriteString("<w:rPr>")
+			if run.bold {
+				b.buf.WriteString("<w:b/>")
+			}
+			if run.italic {
+				b.buf.WriteString("<w:i/>")
+			}
+			b.buf.WriteString("</w:rPr>")
+		}
+		b.buf.WriteString(`<w:t xml:space="preserve">`)
+		xml.EscapeText(&b.buf, []byte(run.text))
+		b.buf.WriteString("</w:t></w:r>")
+	}
+	b.buf.WriteString("</w:p>")
+}
+
+func (b *docxBody) para(runs ...textRun) {
+	b.paragraph("", runs...)
+}
+
+func (b *docxBody) heading(text string) {
+	b.paragraph("Heading1", plain(text))
+}
+
+func (b *docxBody) bullet(runs ...textRun) {
+	b.paragraph("ListBullet", runs...)
+}
+
+func (b *docxBody) title(name string, contact []string) {
+	b.paragraph("Title", plain(name))
+	b.para(plain(strings.Join(contact, " | ")))
+}
+
+func (b *docxBody) entry(title, when string) {
+	runs := []textRun{plain(title)}
+	if when != "" {
+		runs = append(runs, plain(" | "+when))
+	}
+	b.paragraph("Heading2", runs...)
+}
+
+// RenderDOCX turns the document into a Word file on the given paper and margins.
+func (d *Document) RenderDOCX(page PageSetup) ([]byte, error) {
+	var body docxBody
+	err := writeOutline(&body, d)
+	if err != nil {
+		return nil, err
+	}
+	info := d.PersonalInfo()
+
+	var document bytes.Buffer
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	document.WriteString(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	document.Write(body.buf.Bytes())
+	fmt.Fprintf(&document, `<w:sectPr><w:pgSz w:w="%d" w:h="%d"/><w:pgMar w:top="%d" w:right="%d" w:bottom="%d" w:left="%d" w:header="0" w:footer="0" w:gutter="0"/></w:sectPr>`,
+		twips(page.Width), twips(page.Height), twips(page.Top), twips(page.Right), twips(page.Bottom), twips(page.Left))
+	document.WriteString(`</w:body></w:document>`)
+
+	var title bytes.Buffer
+	xml.EscapeText(&title, []byte(info.Name))
+	core := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>%s</dc:title><dc:creator>%s</dc:creator></cp:coreProperties>`, title.String(), title.String())
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	//[Content_Types].xml has to come first
+	for _, part := range []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", []byte(docxContentTypes)},
+		{"_rels/.rels", []byte(docxRels)},
+		{"docProps/core.xml", []byte(core)},
+		{"word/_rels/document.xml.rels", []byte(docxDocumentRels)},
+		{"word/document.xml", document.Bytes()},
+		{"word/styles.xml", []byte(docxStyles)},
+		{"word/numbering.xml", []byte(docxNumbering)},
+	} {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: docxModified})
+		if err != nil {
+			return nil, fmt.Errorf("error adding %s to docx: %w", part.name, err)
+		}
+		_, err = writer.Write(part.content)
+		if err != nil {
+			return nil, fmt.Errorf("error writing %s to docx: %w", part.name, err)
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error finishing docx: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+// docxParts unzips a docx, checking that every part is well formed xml.
+func docxParts(t *testing.T, docx []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if !assert.NoError(t, err) {
+			continue
+		}
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err, file.Name) {
+				break
+			}
+		}
+		parts[file.Name] = string(content)
+	}
+	assert.Equal(t, "[Content_Types].xml", archive.File[0].Name)
+	return parts
+}
+
+// letterPage is letter paper with half inch margins.
+var letterPage = PageSetup{Width: 8.5, Height: 11, Top: 0.5, Right: 0.5, Bottom: 0.5, Left: 0.5}
+
+func TestRenderDOCXChrono(t *testing.T) {
+	doc, err := Decode([]byte(chronoResumedata))
+	if !assert.NoError(t, err) {
+		return
+	}
+	docx, err := doc.RenderDOCX(letterPage)
+	if !assert.NoError(t, err) {
+		return
+	}
+	again, _ := doc.RenderDOCX(letterPage)
+	assert.Equal(t, docx, again, "same document, same bytes")
+
+	parts := docxParts(t, docx)
+	for _, part := range []string{"_rels/.rels", "word/_rels/document.xml.rels", "word/styles.xml", "word/numbering.xml", "docProps/core.xml"} {
+		assert.Contains(t, parts, part)
+	}
+	body := parts["word/document.xml"]
+	assert.Contains(t, body, "Sam &lt;Smith&gt;")
+	assert.Contains(t, body, "Here | 555 | sam@example.com | https://github.com/sam")
+	assert.Contains(t, body, "Gopher at Acme")
+	assert.Contains(t, body, `<w:pStyle w:val="ListBullet"/></w:pPr><w:r><w:t xml:space="preserve">made things</w:t></w:r>`)
+	assert.Contains(t, body, "honours")
+	assert.NotContains(t, body, "secret project")
+	assert.NotContains(t, body, "Hidden Co")
+	assert.Contains(t, body, `<w:pgSz w:w="12240" w:h="15840"/><w:pgMar w:top="720" w:right="720" w:bottom="720" w:left="720"`)
+}
+
+func TestRenderDOCXUsesThePageSetup(t *testing.T) {
+	doc, _ := Decode([]byte(chronoResumedata))
+	docx, err := doc.RenderDOCX(PageSetup{Width: 8.27, Height: 11.7, Top: 1, Right: 0.39, Bottom: 0.75, Left: 0})
+	if assert.NoError(t, err) {
+		body := docxParts(t, docx)["word/document.xml"]
+		assert.Contains(t, body, `<w:pgSz w:w="11909" w:h="16848"/><w:pgMar w:top="1440" w:right="562" w:bottom="1080" w:left="0"`)
+	}
+}
+
+func TestRenderDOCXFunctionalAndCoverLetter(t *testing.T) {
+	doc, _ := Decode([]byte(functionalResumedata))
+	docx, err := doc.RenderDOCX(letterPage)
+	if assert.NoError(t, err) {
+		body := docxParts(t, docx)["word/document.xml"]
+		assert.Contains(t, body, `<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">Built the</w:t>`)
+		assert.Contains(t, body, "payments service in go")
+		assert.Contains(t, body, "(Acme, 2021)")
+		assert.Contains(t, body, "Gopher at Acme, Here")
+	}
+
+	doc, _ = Decode([]byte(coverletterResumedata))
+	docx, err = doc.RenderDOCX(letterPage)
+	if assert.NoError(t, err) {
+		body := docxParts(t, docx)["word/document.xml"]
+		assert.Contains(t, body, "Widgets &amp; Co")
+		assert.Contains(t, body, "I&#39;d like the job.")
+		assert.Contains(t, body, "Sincerely,")
+	}
+
+	_, err = (&Document{Layout: LAYOUT_CHRONO}).RenderDOCX(letterPage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,114 @@
+package document
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// The HTML is self contained (styles inlined, no scripts, no fonts or images to fetch) so it can be posted to
+// gotenberg's html route as is and be rendered the same every time.
+//
+//	templates/page.html.tmpl         the page around the content, with the header that every layout shares
+//	templates/<layout>.html.tmpl     defines "content" for the layout
+//	styles/default.css               always included
+//	styles/<style>.css               on top of default.css for a style, eg fluffy
+//
+//go:embed templates/*.html.tmpl styles/*.css
+var assets embed.FS
+
+const DEFAULT_STYLE = "default"
+
+var layoutTemplates = map[string]*template.Template{}
+
+func init() {
+	for _, layout := range []string{LAYOUT_CHRONO, LAYOUT_FUNCTIONAL, LAYOUT_COVERLETTER} {
+		//a broken template is a bug in the binary, not something to carry on with
+		layoutTemplates[layout] = template.Must(template.New("page.html.tmpl").Funcs(template.FuncMap{
+			"join": strings.Join,
+		}).ParseFS(assets, "templates/page.html.tmpl", fmt.Sprintf("templates/%s.html.tmpl", layout)))
+	}
+}
+
+// pageData is what the templates get. Doc is the layouts own type, eg *Chrono.
+type pageData struct {
+	Layout       string
+	Style        string
+	CSS          template.CSS
+	PersonalInfo PersonalInfo
+	Doc          interface{}
+}
+
+// Styles is the styles there is css for, other than the default.
+func Styles() []string {
+	entries, _ := assets.ReadDir("styles")
+	var styles []string
+	for _, entry := range entries {
+		style := strings.TrimSuffix(entry.Name(), ".css")
+		if style != DEFAULT_STYLE {
+			styles = append(styles, style)
+		}
+	}
+	return styles
+}
+
+func styleCSS(style string) (template.CSS, error) {
+	css, err := assets.ReadFile("styles/default.css")
+	if err != nil {
+		return "", err
+	}
+	if style != "" && style != DEFAULT_STYLE {
+		extra, err := assets.ReadFile(fmt.Sprintf("styles/%s.css", style))
+		if err != nil {
+			return "", fmt.Errorf("unknown style %q", style)
+		}
+		css = append(append(css, '\n'), extra...)
+	}
+	//our own files, not user input
+	return template.CSS(css), nil
+}
+
+// RenderHTML turns the document into a complete HTML page.
+func (d *Document) RenderHTML() ([]byte, error) {
+	tmpl, ok := layoutTemplates[d.Layout]
+	if !ok {
+		return nil, fmt.Errorf("no html template for layout %q", d.Layout)
+	}
+	css, err := styleCSS(d.Style)
+	if err != nil {
+		return nil, err
+	}
+	data := pageData{Layout: d.Layout, Style: d.Style, CSS: css}
+	switch {
+	case d.Chrono != nil:
+		data.PersonalInfo, data.Doc = d.Chrono.PersonalInfo, d.Chrono
+	case d.Functional != nil:
+		data.PersonalInfo, data.Doc = d.Functional.PersonalInfo, d.Functional
+	case d.CoverLetter != nil:
+		data.PersonalInfo, data.Doc = d.CoverLetter.PersonalInfo, d.CoverLetter
+	}
+	if data.Doc == nil {
+		return nil, fmt.Errorf("no %s content to render", d.Layout)
+	}
+	if data.Style == "" {
+		data.Style = DEFAULT_STYLE
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s html: %w", d.Layout, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderHTML is Decode then RenderHTML, for resumedata straight from an attempt file.
+func RenderHTML(resumedata []byte) ([]byte, error) {
+	doc, err := Decode(resumedata)
+	if err != nil {
+		return nil, err
+	}
+	return doc.RenderHTML()
+}
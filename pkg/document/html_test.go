@@ -0,0 +1,57 @@
+package document
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRenderHTMLChrono(t *testing.T) {
+	html, err := RenderHTML([]byte(chronoResumedata))
+	if !assert.NoError(t, err) {
+		return
+	}
+	page := string(html)
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.Contains(t, page, "Sam &lt;Smith&gt;", "content gets escaped")
+	assert.NotContains(t, page, "<Smith>")
+	assert.Contains(t, page, "made things")
+	assert.Contains(t, page, "go, sql")
+	assert.Contains(t, page, `href="https://github.com/sam"`)
+	assert.Contains(t, page, "honours")
+	assert.NotContains(t, page, "secret project", "hidden projects are left out")
+	assert.NotContains(t, page, "Hidden Co", "so is hidden work history")
+	assert.NotContains(t, page, "<script", "nothing to run, so nothing to wait for")
+	assert.NotContains(t, page, "fluffy")
+}
+
+func TestRenderHTMLFunctional(t *testing.T) {
+	html, err := RenderHTML([]byte(functionalResumedata))
+	if !assert.NoError(t, err) {
+		return
+	}
+	page := string(html)
+	assert.Contains(t, page, `<strong class="lead-in">Built the</strong> payments service in go`)
+	assert.Contains(t, page, "go, postgres")
+	assert.Contains(t, page, "Gopher of note.")
+	assert.Contains(t, page, "Employment History")
+	assert.Contains(t, page, "style-fluffy")
+	assert.Contains(t, page, "#6a3d9a", "the fluffy css is inlined")
+}
+
+func TestRenderHTMLCoverLetter(t *testing.T) {
+	html, err := RenderHTML([]byte(coverletterResumedata))
+	if !assert.NoError(t, err) {
+		return
+	}
+	page := string(html)
+	assert.Contains(t, page, "Widgets &amp; Co")
+	assert.Contains(t, page, "I&#39;d like the job.")
+	assert.Contains(t, page, "Sincerely,")
+}
+
+func TestRenderHTMLUnknownStyle(t *testing.T) {
+	_, err := RenderHTML([]byte(`{"layout": "chrono", "style": "spiky"}`))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"fluffy"}, Styles())
+}
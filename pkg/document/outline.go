@@ -0,0 +1,170 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The formats made from the document rather than rendered from the HTML (docx, plain text and markdown) all have the
+// same outline: the name and contact details, then headings with entries (a job, a school), paragraphs and bullets
+// under them. writeOutline walks the document for each layout, each format just has to write those out. Hidden work
+// history and projects are left out, same as the HTML.
+
+type outliner interface {
+	title(name string, contact []string)
+	heading(text string)
+	entry(title, when string) //a job or a school, then when it was
+	para(runs ...textRun)
+	bullet(runs ...textRun)
+}
+
+// textRun is a bit of text in a paragraph, with its formatting. Formats without any (plain text) just use the text.
+type textRun struct {
+	text   string
+	bold   bool
+	italic bool
+}
+
+func plain(text string) textRun {
+	return textRun{text: text}
+}
+
+func bold(text string) textRun {
+	return textRun{text: text, bold: true}
+}
+
+func italic(text string) textRun {
+	return textRun{text: text, italic: true}
+}
+
+func writeOutline(b outliner, d *Document) error {
+	if d.Chrono == nil && d.Functional == nil && d.CoverLetter == nil {
+		return fmt.Errorf("no %s content to render", d.Layout)
+	}
+	info := d.PersonalInfo()
+	b.title(info.Name, info.contactDetails())
+	switch {
+	case d.Chrono != nil:
+		outlineChrono(b, d.Chrono)
+	case d.Functional != nil:
+		outlineFunctional(b, d.Functional)
+	case d.CoverLetter != nil:
+		outlineCoverLetter(b, d.CoverLetter)
+	}
+	return nil
+}
+
+func outlineEducation(b outliner, education []Education) {
+	if len(education) == 0 {
+		return
+	}
+	b.heading("Education")
+	for _, school := range education {
+		b.entry(joinNonEmpty(" - ", school.Description, school.Institution), school.Graduated)
+		if school.Location != "" {
+			b.para(italic(school.Location))
+		}
+		for _, note := range school.Notes {
+			b.bullet(plain(note))
+		}
+	}
+}
+
+func outlineChrono(b outliner, c *Chrono) {
+	if c.PersonalInfo.Profile != "" {
+		b.para(plain(c.PersonalInfo.Profile))
+	}
+	if len(c.Skills) > 0 {
+		b.heading("Skills")
+		b.para(plain(strings.Join(c.Skills, ", ")))
+	}
+	if len(c.WorkHistory) > 0 {
+		b.heading("Experience")
+	}
+	for _, work := range c.WorkHistory {
+		if work.Hide {
+			continue
+		}
+		b.entry(joinNonEmpty(" at ", work.JobTitle, work.Company), work.DateRange)
+		if work.Location != "" {
+			b.para(italic(work.Location))
+		}
+		if work.CompanyDesc != "" {
+			b.para(plain(work.CompanyDesc))
+		}
+		for _, project := range work.Projects {
+			if project.Hide {
+				continue
+			}
+			runs := []textRun{plain(project.Desc)}
+			if project.Tech != "" {
+				runs = append(runs, italic(" ("+project.Tech+")"))
+			}
+			if project.Github != "" {
+				runs = append(runs, plain(" "+project.Github))
+			}
+			b.bullet(runs...)
+		}
+	}
+	outlineEducation(b, c.Education)
+}
+
+func outlineFunctional(b outliner, f *Functional) {
+	if f.Overview != "" {
+		b.para(plain(f.Overview))
+	}
+	for _, area := range f.FunctionalAreas {
+		b.heading(area.Title)
+		for _, contribution := range area.KeyContributions {
+			if contribution.Hide {
+				continue
+			}
+			var runs []textRun
+			if leadIn := contribution.LeadInWords(); leadIn != "" {
+				runs = append(runs, bold(leadIn), plain(" "))
+			}
+			runs = append(runs, plain(contribution.Rest()))
+			if where := joinNonEmpty(", ", contribution.Company, contribution.DateRange); where != "" {
+				runs = append(runs, plain(" ("+where+")"))
+			}
+			if len(contribution.Tech) > 0 {
+				runs = append(runs, plain(" - "), italic(strings.Join(contribution.Tech, ", ")))
+			}
+			b.bullet(runs...)
+		}
+	}
+	if len(f.EmploymentHistory) > 0 {
+		b.heading("Employment History")
+	}
+	for _, employment := range f.EmploymentHistory {
+		b.entry(joinNonEmpty(", ", joinNonEmpty(" at ", employment.Title, employment.Company), employment.Location), employment.DateRange)
+	}
+	outlineEducation(b, f.Education)
+}
+
+func outlineCoverLetter(b outliner, c *CoverLetter) {
+	if c.Date != "" {
+		b.para(plain(c.Date))
+	}
+	if c.CompanyInfo.OrganizationName != "" {
+		b.para(plain(c.CompanyInfo.OrganizationName))
+	}
+	if c.CompanyInfo.CompanyName != "" {
+		b.para(plain(c.CompanyInfo.CompanyName))
+	}
+	for _, paragraph := range c.LetterContents {
+		b.para(plain(paragraph))
+	}
+	b.para(plain(c.Closing))
+	b.para(plain(c.PersonalInfo.Name))
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
@@ -0,0 +1,133 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Plain text is for pasting into the text boxes on job portals, markdown for anywhere that takes it. Both are made
+// from the document (see outline.go) rather than pulled out of the PDF, so there's no broken up lines or columns run
+// together, and the same document always comes out the same.
+
+// textBody writes the outline as lines, with a blank line between blocks. A block being a heading or an entry with
+// whatever directly follows it, a paragraph or a list of bullets.
+type textBody struct {
+	buf      bytes.Buffer
+	markdown bool
+	last     string //what was written last, to know whether a blank line is needed
+}
+
+func (b *textBody) line(kind string, text string) {
+	if b.buf.Len() > 0 {
+		switch {
+		case kind == "bullet" && b.last != "title":
+		case kind == "para" && (b.last == "title" || b.last == "heading" || b.last == "entry"):
+		case kind == "entry" && b.last == "heading":
+		default:
+			b.buf.WriteString("\n")
+		}
+	}
+	b.buf.WriteString(text)
+	b.buf.WriteString("\n")
+	b.last = kind
+}
+
+// text is the runs as text, marked up if it's markdown. Spaces at either end of a run stay outside the markup, or
+// markdown won't have it.
+func (b *textBody) text(runs ...textRun) string {
+	var text strings.Builder
+	for _, run := range runs {
+		if !b.markdown {
+			text.WriteString(run.text)
+			continue
+		}
+		trimmed := strings.TrimSpace(run.text)
+		if trimmed == "" || (!run.bold && !run.italic) {
+			text.WriteString(escapeMarkdown(run.text))
+			continue
+		}
+		marker := "*"
+		if run.bold {
+			marker = "**"
+		}
+		leading := run.text[:strings.Index(run.text, trimmed)]
+		trailing := run.text[len(leading)+len(trimmed):]
+		fmt.Fprintf(&text, "%s%s%s%s%s", leading, marker, escapeMarkdown(trimmed), marker, trailing)
+	}
+	return text.String()
+}
+
+func (b *textBody) title(name string, contact []string) {
+	if b.markdown {
+		b.line("title", "# "+escapeMarkdown(name))
+	} else {
+		b.line("title", name)
+	}
+	if len(contact) > 0 {
+		details := make([]string, len(contact))
+		for i, detail := range contact {
+			details[i] = b.text(plain(detail))
+		}
+		b.line("para", strings.Join(details, " | "))
+	}
+}
+
+func (b *textBody) heading(text string) {
+	if b.markdown {
+		b.line("heading", "## "+escapeMarkdown(text))
+	} else {
+		b.line("heading", strings.ToUpper(text))
+	}
+}
+
+func (b *textBody) entry(title, when string) {
+	text := joinNonEmpty(" | ", b.text(plain(title)), b.text(plain(when)))
+	if b.markdown {
+		text = "### " + text
+	}
+	b.line("entry", text)
+}
+
+func (b *textBody) para(runs ...textRun) {
+	b.line("para", b.text(runs...))
+}
+
+func (b *textBody) bullet(runs ...textRun) {
+	b.line("bullet", "- "+b.text(runs...))
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`)
+
+// these only mean anything at the start of a line (a heading, a quote, a list), of which there can be more than one in a run
+var markdownLineStart = regexp.MustCompile(`(?m)^(#|>|[-+] )`)
+
+var markdownNumberedLineStart = regexp.MustCompile(`(?m)^(\d+)\. `)
+
+// escapeMarkdown keeps whatever is in the resumedata from being taken as markup.
+func escapeMarkdown(text string) string {
+	escaped := markdownEscaper.Replace(text)
+	escaped = markdownLineStart.ReplaceAllString(escaped, `\$1`)
+	return markdownNumberedLineStart.ReplaceAllString(escaped, `$1\. `)
+}
+
+// RenderText turns the document into plain text.
+func (d *Document) RenderText() ([]byte, error) {
+	body := textBody{}
+	err := writeOutline(&body, d)
+	if err != nil {
+		return nil, err
+	}
+	return body.buf.Bytes(), nil
+}
+
+// RenderMarkdown turns the document into markdown.
+func (d *Document) RenderMarkdown() ([]byte, error) {
+	body := textBody{markdown: true}
+	err := writeOutline(&body, d)
+	if err != nil {
+		return nil, err
+	}
+	return body.buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package document
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRenderTextChrono(t *testing.T) {
+	doc, err := Decode([]byte(chronoResumedata))
+	if !assert.NoError(t, err) {
+		return
+	}
+	text, err := doc.RenderText()
+	assert.NoError(t, err)
+	assert.Equal(t, `Sam <Smith>
+Here | 555 | sam@example.com | https://github.com/sam
+
+SKILLS
+go, k8s
+
+EXPERIENCE
+Gopher at Acme | 2020 - now
+Here
+- made things (go, sql)
+
+EDUCATION
+BSc - School | 2019
+- honours
+`, string(text))
+
+	markdown, err := doc.RenderMarkdown()
+	assert.NoError(t, err)
+	assert.Equal(t, `# Sam \<Smith>
+Here | 555 | sam@example.com | https://github.com/sam
+
+## Skills
+go, k8s
+
+## Experience
+### Gopher at Acme | 2020 - now
+*Here*
+- made things *(go, sql)*
+
+## Education
+### BSc - School | 2019
+- honours
+`, string(markdown))
+}
+
+func TestRenderTextFunctionalAndCoverLetter(t *testing.T) {
+	doc, _ := Decode([]byte(functionalResumedata))
+	text, err := doc.RenderText()
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(text), "BACKEND\n- Built the payments service in go (Acme, 2021) - go, postgres\n")
+		assert.Contains(t, string(text), "EMPLOYMENT HISTORY\nGopher at Acme, Here | 2020 - now\n")
+	}
+	markdown, err := doc.RenderMarkdown()
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(markdown), "- **Built the** payments service in go (Acme, 2021) - *go, postgres*\n")
+	}
+
+	doc, _ = Decode([]byte(coverletterResumedata))
+	text, err = doc.RenderText()
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(text), "Dear Hiring Team,\n\nI'd like the job.\n\nSincerely,\n\nSam\n", "a blank line between paragraphs")
+	}
+
+	_, err = (&Document{Layout: LAYOUT_FUNCTIONAL}).RenderMarkdown()
+	assert.Error(t, err)
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	assert.Equal(t, `C# and \*nix, snake\_case \[link\] \<b>`, escapeMarkdown("C# and *nix, snake_case [link] <b>"), "a # only needs it at the start")
+	assert.Equal(t, `\# not a heading`, escapeMarkdown("# not a heading"))
+	assert.Equal(t, `\- not a bullet`, escapeMarkdown("- not a bullet"))
+	assert.Equal(t, `2019\. not a list`, escapeMarkdown("2019. not a list"))
+	assert.Equal(t, "2020 - now", escapeMarkdown("2020 - now"))
+	assert.Equal(t, "made things\n\\- not a bullet\n\\# nor a heading\n\\> nor a quote\n2019\\. nor a list", escapeMarkdown("made things\n- not a bullet\n# nor a heading\n> nor a quote\n2019. nor a list"), "every line, not just the first")
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"time"
+)
+
+// Budget is how much a job gets to use before it stops and goes with the best it has so far. It's checked before each
+// attempt, so an attempt that's already going gets to finish. 0 for wall time or tokens means no limit.
+// MaxAttempts is just how many goes the job gets, using them all up is the normal end rather than a budget running out.
+// Server defaults come from config, admins can set their own per job.
+type Budget struct {
+	MaxAttempts    int `json:"max_attempts,omitempty"`
+	MaxWallSeconds int `json:"max_wall_seconds,omitempty"`
+	MaxTokens      int `json:"max_tokens,omitempty"` //total over all the LLM calls for the job, unlike Job.MaxTokens which is per call
+}
+
+// which budget ran out
+const (
+	BUDGET_WALL_TIME = "wall_time"
+	BUDGET_TOKENS    = "tokens"
+)
+
+// Fill sets whatever isn't set from the defaults.
+func (b *Budget) Fill(defaults Budget) {
+	if b.MaxAttempts == 0 {
+		b.MaxAttempts = defaults.MaxAttempts
+	}
+	if b.MaxWallSeconds == 0 {
+		b.MaxWallSeconds = defaults.MaxWallSeconds
+	}
+	if b.MaxTokens == 0 {
+		b.MaxTokens = defaults.MaxTokens
+	}
+}
+
+// Exhausted is which budget has run out given when the job started and the tokens it's used, or "" if there's budget
+// left for another attempt. Whether there are attempts left is up to the caller.
+func (b Budget) Exhausted(started time.Time, tokens int) string {
+	switch {
+	case b.MaxWallSeconds > 0 && time.Since(started) >= time.Duration(b.MaxWallSeconds)*time.Second:
+		return BUDGET_WALL_TIME
+	case b.MaxTokens > 0 && tokens >= b.MaxTokens:
+		return BUDGET_TOKENS
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBudgetFillKeepsWhatWasSet(t *testing.T) {
+	budget := Budget{MaxAttempts: 2}
+	budget.Fill(Budget{MaxAttempts: 7, MaxWallSeconds: 600})
+	assert.Equal(t, Budget{MaxAttempts: 2, MaxWallSeconds: 600}, budget)
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	budget := Budget{MaxAttempts: 3, MaxWallSeconds: 60, MaxTokens: 1000}
+	assert.Equal(t, "", budget.Exhausted(time.Now(), 999))
+	assert.Equal(t, BUDGET_WALL_TIME, budget.Exhausted(time.Now().Add(-time.Minute), 0))
+	assert.Equal(t, BUDGET_TOKENS, budget.Exhausted(time.Now(), 1000))
+
+	budget = Budget{MaxAttempts: 3}
+	assert.Equal(t, "", budget.Exhausted(time.Now().Add(-time.Hour), 1000000), "no limit on wall time or tokens")
+}
@@ -0,0 +1,33 @@
+package job
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExperimentOutcome is what we keep about each job that ran as part of a prompt experiment,
+// enough to compare the variants on how well and how cheaply they get to a finished resume.
+type ExperimentOutcome struct {
+	Experiment           string    `json:"experiment"`
+	Variant              string    `json:"variant"`
+	PromptVersion        string    `json:"prompt_version"`
+	JobId                string    `json:"job_id"`
+	Layout               string    `json:"layout"`
+	Attempts             int       `json:"attempts"`  //attempts made, which is the attempts to converge when it did
+	Converged            bool      `json:"converged"` //got to the page count and fill ratio we were after
+	NumberOfPages        int       `json:"number_of_pages"`
+	LastPageContentRatio float64   `json:"last_page_content_ratio"`
+	TotalTokens          int       `json:"total_tokens"`
+	EstimatedCostUSD     float64   `json:"estimated_cost_usd"`
+	Error                string    `json:"error,omitempty"`
+	Created              time.Time `json:"created"`
+}
+
+// ExperimentOutcomesPrefix is where all the outcomes of an experiment live in the bucket.
+func ExperimentOutcomesPrefix(experiment string) string {
+	return fmt.Sprintf("experiments/%s/", experiment)
+}
+
+func ExperimentOutcomePath(experiment, variant, jobId string) string {
+	return fmt.Sprintf("%s%s/%s.json", ExperimentOutcomesPrefix(experiment), variant, jobId)
+}
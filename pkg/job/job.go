@@ -10,21 +10,61 @@ import (
 	"github.com/rs/zerolog/log"
 	"os"
 	"path/filepath"
+	"pdfinspector/pkg/document"
+	"time"
 )
 
-// todo maybe this could include a flag about if it was an error so that we can detect that at the server and refund them?
+// JobStatus is a line in a jobs stream. Whether a failed job gets its credit back is decided from the job once it's done, see Job.ServerSideFailure.
 type JobStatus struct {
-	Message string `json:"message"`
-	Error   *bool  `json:"error,omitempty"`
+	Message  string               `json:"message"`
+	Error    *bool                `json:"error,omitempty"`
+	Stream   *StreamProgress      `json:"stream,omitempty"`
+	Warnings []FabricationWarning `json:"warnings,omitempty"`
+
+	BudgetExhausted string `json:"budget_exhausted,omitempty"` //which of the jobs budgets ran out, see Budget
+}
+
+// StreamProgress goes out with the status updates sent while an LLM response is still streaming in.
+type StreamProgress struct {
+	Phase  string `json:"phase"`
+	Tokens int    `json:"tokens"`          //approximate completion tokens received so far
+	Delta  string `json:"delta,omitempty"` //partial content received since the previous update
+}
+
+// FabricationWarning is a detail in tuned resumedata that couldn't be found in the baseline it was tuned from.
+type FabricationWarning struct {
+	Kind  string `json:"kind"`  //employer, institution, date, degree or number
+	Field string `json:"field"` //where it is in the tuned resumedata, eg work_history[2].company
+	Value string `json:"value"`
 }
+
 type ExtractResult struct {
 	JobStatus
-	TemplateName *string `json:"template_name,omitempty"`
+	TemplateName *string     `json:"template_name,omitempty"`
+	Usage        *TokenUsage `json:"usage,omitempty"`
 }
 
 type JobResult struct {
-	Status  string `json:"status"`
-	Details string `json:"details"`
+	Status  string        `json:"status"`
+	Details string        `json:"details"`
+	Usage   *TokenUsage   `json:"usage,omitempty"`
+	Refund  *CreditRefund `json:"refund,omitempty"`
+
+	BudgetExhausted string `json:"budget_exhausted,omitempty"` //set if the job stopped early because a budget ran out
+}
+
+// CreditRefund is the credit given back for a job that failed on our side. It's kept in the bucket under CreditRefundPath
+// as well as being reported in the jobs final result.
+type CreditRefund struct {
+	JobId           string    `json:"job_id"`
+	Amount          int       `json:"amount"`
+	Reason          string    `json:"reason"`
+	CreditRemaining int       `json:"credit_remaining"`
+	Created         time.Time `json:"created"`
+}
+
+func CreditRefundPath(userKey string, jobId string) string {
+	return fmt.Sprintf("users/%s/refunds/%s.json", userKey, jobId)
 }
 
 // Job represents the structure for a job
@@ -36,8 +76,31 @@ type Job struct {
 	StyleOverride  string `json:"style_override"` //eg fluffy
 	Id             string
 	OverrideJobId  *string `json:"job_id,omitempty"` //generally speaking this can't be set by a user, is just for admin/testing
-	Layout         string  `json:"layout""`
-	Supplement     string  `json:"supplement""` //the identifier for a template in gcs to be used to supplement the prompt -- adding this so that i can select some saved resumedata to go along with a cover letter prompt, in addition to the custom cover letter tune data.
+	Layout         string  `json:"layout"`
+	Supplement     string  `json:"supplement"` //the identifier for a template in gcs to be used to supplement the prompt -- adding this so that i can select some saved resumedata to go along with a cover letter prompt, in addition to the custom cover letter tune data.
+
+	//model settings. admins can set any of these, non-admins can only pick a model from the allowlist.
+	//whatever is not set gets filled in from the layout defaults and then the server config during PopulateJob.
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+
+	//how many pages the result should be, all full except the last which needs to be AcceptableRatio full. 1 if not set.
+	TargetPages int `json:"target_pages,omitempty"`
+
+	//ask the model to put back anything the fabrication guard flags as not being in the baseline, before rendering
+	RevertFabrications bool `json:"revert_fabrications,omitempty"`
+
+	//how many completions to ask for and render side by side on each attempt, keeping the best. costs that many times more, see CreditCost.
+	Candidates int `json:"candidates,omitempty"`
+
+	//paper size, margins and so on, see PrintOptions
+	PrintOptions
+
+	PromptSet     string `json:"prompt_set,omitempty"`     //admin only, otherwise the server default set
+	PromptVersion string `json:"prompt_version,omitempty"` //filled in with the exact prompts used, see prompts.Set.ID
+	Experiment    string `json:"experiment,omitempty"`     //prompt experiment the job got put into, if any
+	Variant       string `json:"variant,omitempty"`        //and which variant of it
 
 	MainPrompt     string
 	SupplementData []byte //the actual content of supplement data we may have to collect from gcs
@@ -46,19 +109,43 @@ type Job struct {
 	OutputDir string
 	//OutputFilename  string //todo use this maybe?
 	AcceptableRatio float64
-	MaxAttempts     int
 	IsForAdmin      bool
 
+	//admin only, otherwise the server defaults. whatever is not set gets filled in from the server defaults during PopulateJob.
+	Budget          Budget `json:"budget"`
+	BudgetExhausted string `json:"budget_exhausted,omitempty"` //which budget ran out, if the job stopped early because of one
+
 	//anything else we want as options per-job? i was thinking include_bio might be a good option. (todo: ability to not show it on functional, ability to show it on chrono, and then json schema tuning depending on if it is set or not so that the gpt can know to specify it - and dont include it when it shouldn't!)
 	//idk but i want to report to the user their balance and i dont really want to make a whole new struct for it
 	UserKey             string
 	UserCreditRemaining int
+	UserCreditDeducted  int    //what the job was charged, see CreditCost. what gets refunded if it fails on our side.
 	UserID              string //like sso subject id, so we can put generation ids into a bucket path for them to recall later.
 
+	Usage *UsageSummary //token usage of all the llm calls made for this job
+
+	Cancelled         bool  `json:"-"` //set by the job runner if the job was stopped before it finished
+	ServerSideFailure error `json:"-"` //set by the job runner if the job failed for reasons that weren't the users fault, see jobrunner.isServerSideFailure
+
 	//
-	Logger *zerolog.Logger
+	Logger *zerolog.Logger `json:"-"`
+}
+
+// MAX_CANDIDATES is as many candidates per attempt as a non-admin job can ask for.
+const MAX_CANDIDATES = 4
+
+// CreditCost is what the job costs at perCandidate credit for every candidate it asks for, each being a whole
+// completion and render per attempt.
+func (job *Job) CreditCost(perCandidate int) int {
+	if job.Candidates > 1 {
+		return perCandidate * job.Candidates
+	}
+	return perCandidate
 }
 
+// MAX_TARGET_PAGES is the longest a non-admin job can ask for the result to be.
+const MAX_TARGET_PAGES = 3
+
 func NewDefaultJob() *Job {
 	job := &Job{}
 	job.PrepareDefault(nil)
@@ -72,9 +159,21 @@ func (job *Job) PrepareDefault(jobId *string) {
 	}
 
 	job.Logger = getLogger(job.Id)
+	job.Usage = NewUsageSummary()
+	if job.TargetPages < 1 {
+		job.TargetPages = 1
+	}
 }
 
-func (job *Job) ValidateForNonAdmin() error {
+// PrepareResumed sets back up what doesn't get saved with a job, for one that's been read back from a checkpoint.
+func (job *Job) PrepareResumed() {
+	job.Logger = getLogger(job.Id)
+	if job.Usage == nil {
+		job.Usage = NewUsageSummary()
+	}
+}
+
+func (job *Job) ValidateForNonAdmin(allowedModels []string) error {
 	//this is just more of a thought than perhaps a good idea. the failure modes can be many and we should just return api credits if job failed. todo.
 	if job.Baseline != "" {
 		return errors.New("disallowed")
@@ -83,6 +182,28 @@ func (job *Job) ValidateForNonAdmin() error {
 		return errors.New("disallowed")
 	}
 
+	if job.Temperature != nil || job.MaxTokens != 0 || job.PromptSet != "" || job.Budget != (Budget{}) {
+		return errors.New("disallowed")
+	}
+	if job.TargetPages < 0 || job.TargetPages > MAX_TARGET_PAGES {
+		return fmt.Errorf("target_pages must be between 1 and %d", MAX_TARGET_PAGES)
+	}
+	if job.Candidates < 0 || job.Candidates > MAX_CANDIDATES {
+		return fmt.Errorf("candidates must be between 1 and %d", MAX_CANDIDATES)
+	}
+	if job.Model != "" {
+		modelAllowed := false
+		for _, allowed := range allowedModels {
+			if allowed == job.Model {
+				modelAllowed = true
+				break
+			}
+		}
+		if !modelAllowed {
+			return fmt.Errorf("Model not allowed: %s", job.Model)
+		}
+	}
+
 	var result interface{}
 	if err := json.Unmarshal([]byte(job.BaselineJSON), &result); err != nil {
 		return fmt.Errorf("error decoding JSON into interface{}: %v", err)
@@ -101,9 +222,10 @@ func (job *Job) ValidateForNonAdmin() error {
 	} else {
 		return errors.New("The layout is neither 'functional' nor 'chrono'")
 	}
-	// List of valid styles (expandable in the future)
-	validStyles := map[string]bool{
-		"fluffy": true, // Starting with only "fluffy"
+	// the styles there's css for in the document package
+	validStyles := map[string]bool{}
+	for _, style := range document.Styles() {
+		validStyles[style] = true
 	}
 
 	// Check if the "style" field exists and is valid
@@ -169,7 +291,8 @@ type RenderJob struct {
 	BaselineJSON  string `json:"baseline_json"`  //the actual layout to use is a property of the baseline resumedata.
 	StyleOverride string `json:"style_override"` //eg fluffy
 	Id            string
-	Layout        string `json:"layout""`
+	Layout        string `json:"layout"`
+	PrintOptions
 
 	OutputDir string
 	UserKey   string
@@ -0,0 +1,13 @@
+package job
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreditCostIsPerCandidate(t *testing.T) {
+	job := NewDefaultJob()
+	assert.Equal(t, 2, job.CreditCost(2), "no candidates set is one")
+	job.Candidates = 3
+	assert.Equal(t, 6, job.CreditCost(2))
+}
@@ -0,0 +1,104 @@
+package job
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PrintOptions is how a resume gets put on paper. Anything that isn't set is left to the renderer, which for gotenberg
+// and chromium is letter paper with 0.39in margins at a scale of 1. Margins are in inches.
+type PrintOptions struct {
+	PaperSize         string   `json:"paper_size,omitempty"` //letter, legal, a4 etc, see PAPER_SIZES
+	MarginTop         *float64 `json:"margin_top,omitempty"` //pointers since 0 is a margin someone might want
+	MarginBottom      *float64 `json:"margin_bottom,omitempty"`
+	MarginLeft        *float64 `json:"margin_left,omitempty"`
+	MarginRight       *float64 `json:"margin_right,omitempty"`
+	Scale             float64  `json:"scale,omitempty"`
+	PreferCSSPageSize bool     `json:"prefer_css_page_size,omitempty"` //let an @page rule in the css decide the page size instead
+}
+
+// PaperDimensions is the width and height of a paper size, in inches.
+type PaperDimensions struct {
+	Width  float64
+	Height float64
+}
+
+var PAPER_SIZES = map[string]PaperDimensions{
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+	"a3":      {11.7, 16.54},
+	"a4":      {8.27, 11.7},
+	"a5":      {5.83, 8.27},
+}
+
+const DEFAULT_PAPER_SIZE = "letter"
+
+// DEFAULT_MARGIN is what gotenberg and chromium use when they aren't told, in inches.
+const DEFAULT_MARGIN = 0.39
+
+const (
+	MAX_MARGIN = 3
+	MIN_SCALE  = 0.1
+	MAX_SCALE  = 2.0
+)
+
+func (p PrintOptions) Validate() error {
+	if p.PaperSize != "" {
+		if _, ok := PAPER_SIZES[strings.ToLower(p.PaperSize)]; !ok {
+			var sizes []string
+			for size := range PAPER_SIZES {
+				sizes = append(sizes, size)
+			}
+			sort.Strings(sizes)
+			return fmt.Errorf("paper_size must be one of %s", strings.Join(sizes, ", "))
+		}
+	}
+	for _, margin := range []*float64{p.MarginTop, p.MarginBottom, p.MarginLeft, p.MarginRight} {
+		if margin != nil && (*margin < 0 || *margin > MAX_MARGIN) {
+			return fmt.Errorf("margins must be between 0 and %d inches", MAX_MARGIN)
+		}
+	}
+	if p.Scale != 0 && (p.Scale < MIN_SCALE || p.Scale > MAX_SCALE) {
+		return fmt.Errorf("scale must be between %g and %g", MIN_SCALE, MAX_SCALE)
+	}
+	top, right, bottom, left := p.Margins()
+	paper := p.Paper()
+	if top+bottom >= paper.Height || left+right >= paper.Width {
+		return fmt.Errorf("the margins don't leave any room on %s paper", p.paperSize())
+	}
+	return nil
+}
+
+func (p PrintOptions) paperSize() string {
+	if p.PaperSize == "" {
+		return DEFAULT_PAPER_SIZE
+	}
+	return strings.ToLower(p.PaperSize)
+}
+
+// Paper is the size of the paper, letter if it isn't set (or isn't one we know).
+func (p PrintOptions) Paper() PaperDimensions {
+	paper, ok := PAPER_SIZES[p.paperSize()]
+	if !ok {
+		return PAPER_SIZES[DEFAULT_PAPER_SIZE]
+	}
+	return paper
+}
+
+// Margins in inches, with the default for any that aren't set.
+func (p PrintOptions) Margins() (top, right, bottom, left float64) {
+	margin := func(m *float64) float64 {
+		if m == nil {
+			return DEFAULT_MARGIN
+		}
+		return *m
+	}
+	return margin(p.MarginTop), margin(p.MarginRight), margin(p.MarginBottom), margin(p.MarginLeft)
+}
+
+// Set is whether any of the options have been set, ie whether the renderer needs to be told anything.
+func (p PrintOptions) Set() bool {
+	return p != PrintOptions{}
+}
@@ -0,0 +1,30 @@
+package job
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrintOptionsValidate(t *testing.T) {
+	margin := func(m float64) *float64 { return &m }
+	assert.NoError(t, PrintOptions{}.Validate())
+	assert.NoError(t, PrintOptions{PaperSize: "A4", MarginTop: margin(0), Scale: 0.8, PreferCSSPageSize: true}.Validate())
+
+	assert.ErrorContains(t, PrintOptions{PaperSize: "napkin"}.Validate(), "paper_size must be one of a3, a4, a5, legal, letter, tabloid")
+	assert.Error(t, PrintOptions{MarginLeft: margin(-1)}.Validate())
+	assert.Error(t, PrintOptions{MarginLeft: margin(MAX_MARGIN + 1)}.Validate())
+	assert.Error(t, PrintOptions{Scale: 5}.Validate())
+	assert.ErrorContains(t, PrintOptions{PaperSize: "a5", MarginLeft: margin(3), MarginRight: margin(3)}.Validate(), "don't leave any room")
+}
+
+func TestPrintOptionsDefaults(t *testing.T) {
+	margin := 1.0
+	options := PrintOptions{MarginBottom: &margin}
+	assert.Equal(t, PaperDimensions{8.5, 11}, options.Paper(), "letter when it isn't set")
+	top, right, bottom, left := options.Margins()
+	assert.Equal(t, []float64{DEFAULT_MARGIN, DEFAULT_MARGIN, 1, DEFAULT_MARGIN}, []float64{top, right, bottom, left})
+	assert.True(t, options.Set())
+	assert.False(t, PrintOptions{}.Set())
+
+	assert.Equal(t, PaperDimensions{8.27, 11.7}, PrintOptions{PaperSize: "A4"}.Paper())
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"sync"
+)
+
+// TokenUsage is a running total of tokens for some set of LLM calls.
+type TokenUsage struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.EstimatedCostUSD += other.EstimatedCostUSD
+}
+
+// UsageSummary keeps the token usage for a job, in total and per phase (jd_notes, attempt_0, extraction_2 etc).
+// It is safe to record into from multiple goroutines.
+type UsageSummary struct {
+	Total  TokenUsage             `json:"total"`
+	Phases map[string]*TokenUsage `json:"phases"`
+	mu     sync.Mutex
+}
+
+func NewUsageSummary() *UsageSummary {
+	return &UsageSummary{Phases: map[string]*TokenUsage{}}
+}
+
+// Record adds the usage of one call under the given phase. Nil receiver is allowed and does nothing, so callers that don't care can just not have one.
+func (u *UsageSummary) Record(phase string, usage TokenUsage) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.Phases == nil {
+		u.Phases = map[string]*TokenUsage{}
+	}
+	if _, ok := u.Phases[phase]; !ok {
+		u.Phases[phase] = &TokenUsage{}
+	}
+	u.Phases[phase].Add(usage)
+	u.Total.Add(usage)
+}
+
+// Totals gives a copy of the total so far.
+func (u *UsageSummary) Totals() TokenUsage {
+	if u == nil {
+		return TokenUsage{}
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.Total
+}
@@ -1,18 +1,31 @@
 package jobrunner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"pdfinspector/pkg/config"
 	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
 	"pdfinspector/pkg/tuner"
+	"sync"
 )
 
 type JobRunner struct {
 	Config *config.ServiceConfig
 	Tuner  *tuner.Tuner
+
+	runningMu sync.Mutex
+	running   map[string]*runningJob //by job id, so they can be cancelled
+}
+
+type runningJob struct {
+	userKey string
+	cancel  context.CancelFunc
 }
 
-func (j *JobRunner) RunJob(job *job.Job, updates chan job.JobStatus) {
+// RunJob runs the job to completion, or until ctx is done. A cancelled job is recorded as such rather than as a failure.
+func (j *JobRunner) RunJob(ctx context.Context, job *job.Job, updates chan job.JobStatus) {
 	if updates != nil {
 		defer close(updates)
 	}
@@ -25,28 +38,167 @@ func (j *JobRunner) RunJob(job *job.Job, updates chan job.JobStatus) {
 	if err != nil {
 		job.Log().Error().Msgf("Error from PopulateJob: %v", err)
 		tuner.SendJobErrorUpdate(updates, fmt.Sprintf("Error from PopulateJob: %v", err))
+		if !errors.Is(err, tuner.ErrInvalidJob) {
+			job.ServerSideFailure = err
+		}
 		return
 	}
 	job.Log().Trace().Msgf("debug here job output dir: %s", job.OutputDir)
+	if ctx.Err() != nil {
+		j.tuningDone(ctx, job, ctx.Err(), updates)
+		return
+	}
 
-	err = j.Tuner.TuneResumeContents(job, updates)
+	err = j.Tuner.TuneResumeContents(ctx, job, updates)
+	j.tuningDone(ctx, job, err, updates)
+}
+
+// ResumeJob carries on an interrupted job from its checkpoint, see tuner.LoadCheckpoint. Like RunJob, but the job was
+// already populated (and paid for) the first time round.
+func (j *JobRunner) ResumeJob(ctx context.Context, checkpoint *tuner.Checkpoint, updates chan job.JobStatus) {
+	if updates != nil {
+		defer close(updates)
+	}
+	job := checkpoint.Job
+	tuner.SendJobUpdate(updates, fmt.Sprintf("resuming job from attempt %d", checkpoint.NextAttempt))
+	if ctx.Err() != nil {
+		j.tuningDone(ctx, job, ctx.Err(), updates)
+		return
+	}
+	err := j.Tuner.ContinueTuneResumeContents(ctx, checkpoint, updates)
+	j.tuningDone(ctx, job, err, updates)
+}
+
+// tuningDone reports how tuning went, telling apart cancelled jobs and failures that were on us. Only the client going
+// away or the cancel endpoint count as cancelling, a job that ran past a deadline we gave it failed on our side.
+func (j *JobRunner) tuningDone(ctx context.Context, job *job.Job, err error, updates chan job.JobStatus) {
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		j.jobCancelled(job, updates)
+		return
+	}
 	if err != nil {
 		job.Log().Error().Msgf("Error from resume tuning: %v", err)
-		tuner.SendJobErrorUpdate(updates, fmt.Sprintf("Error from resume tuning: %v", err))
-		//todo send an update that is flagged as an error so that runner can report the failure.
+		tuner.SendJobErrorUpdate(updates, fmt.Sprintf("Error from resume tuning: %s", describeTuningError(err)))
+		if isServerSideFailure(err) {
+			job.ServerSideFailure = err
+		}
+	}
+}
+
+// isServerSideFailure is true if a tuning failure was down to us or the services we use (LLM outages, gotenberg, ghostscript, gcs)
+// rather than what the user sent, in which case whoever runs the job should give back the credit it cost. Input too long for the
+// model and content it refused or couldn't finish are on the user, as is cancelling. Running out of time (a deadline) is on us.
+// PopulateJob failures are told apart with tuner.ErrInvalidJob instead.
+func isServerSideFailure(err error) bool {
+	var completionErr *tuner.CompletionError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, llm.ErrContextLength):
+		return false
+	case errors.As(err, &completionErr):
+		return false
 	}
+	return true
 }
 
-func (j *JobRunner) RunJobStreaming(inputJob *job.Job) chan job.JobStatus {
+func (j *JobRunner) jobCancelled(job *job.Job, updates chan job.JobStatus) {
+	job.Log().Info().Msgf("job was cancelled")
+	job.Cancelled = true
+	j.Tuner.RecordCancelledJob(job, "The inputJob was cancelled before it completed.")
+	tuner.SendJobUpdate(updates, "job was cancelled")
+}
+
+// describeTuningError spells out the LLM outcomes that the user might be able to do something about.
+func describeTuningError(err error) string {
+	var schemaErr *tuner.SchemaValidationError
+	if errors.As(err, &schemaErr) {
+		return fmt.Sprintf("the model's output never matched the resume format, even after asking it to fix it: %s", err.Error())
+	}
+	var completionErr *tuner.CompletionError
+	if !errors.As(err, &completionErr) {
+		return err.Error()
+	}
+	switch {
+	case errors.Is(err, tuner.ErrCompletionTruncated):
+		return fmt.Sprintf("the model's response was too long and got cut off, even after asking it for less content (%s). A higher max tokens or less input content should help.", completionErr.Phase)
+	case completionErr.Refusal != "":
+		return fmt.Sprintf("the model declined to tune this resume (%s): %s", completionErr.Phase, completionErr.Refusal)
+	}
+	return fmt.Sprintf("the model declined to tune this resume (%s, finish_reason %s)", completionErr.Phase, completionErr.FinishReason)
+}
+
+// RunJobStreaming runs the job in the background, sending updates on the returned channel until it's done and the channel closes.
+// The job stops early if ctx is done or it's cancelled with CancelJob. Whoever reads the updates has to keep reading them
+// until the channel closes, even if they stop caring, or the job blocks.
+func (j *JobRunner) RunJobStreaming(ctx context.Context, inputJob *job.Job) chan job.JobStatus {
 	inputJob.Log().Info().Msgf("running job")
 	updates := make(chan job.JobStatus)
-	go j.RunJob(inputJob, updates)
+	ctx, cancel := context.WithCancel(ctx)
+	j.trackJob(inputJob, cancel) //a new job, so it can't already be running
+	go func() {
+		defer j.untrackJob(inputJob.Id)
+		j.RunJob(ctx, inputJob, updates)
+	}()
 
 	//// Add job to queue
 	return updates
 }
 
-func (j *JobRunner) RunRenderJob(job *job.RenderJob, updates chan job.JobStatus) {
+// ResumeJobStreaming is RunJobStreaming for ResumeJob. False (and no channel) if the job is already running here,
+// eg it got resumed twice.
+func (j *JobRunner) ResumeJobStreaming(ctx context.Context, checkpoint *tuner.Checkpoint) (chan job.JobStatus, bool) {
+	checkpoint.Job.Log().Info().Msgf("resuming job")
+	ctx, cancel := context.WithCancel(ctx)
+	if !j.trackJob(checkpoint.Job, cancel) {
+		cancel()
+		return nil, false
+	}
+	updates := make(chan job.JobStatus)
+	go func() {
+		defer j.untrackJob(checkpoint.Job.Id)
+		j.ResumeJob(ctx, checkpoint, updates)
+	}()
+	return updates, true
+}
+
+// trackJob notes a job as running so it can be cancelled. False if it's already running.
+func (j *JobRunner) trackJob(inputJob *job.Job, cancel context.CancelFunc) bool {
+	j.runningMu.Lock()
+	defer j.runningMu.Unlock()
+	if j.running == nil {
+		j.running = map[string]*runningJob{}
+	}
+	if _, ok := j.running[inputJob.Id]; ok {
+		return false
+	}
+	j.running[inputJob.Id] = &runningJob{userKey: inputJob.UserKey, cancel: cancel}
+	return true
+}
+
+func (j *JobRunner) untrackJob(jobId string) {
+	j.runningMu.Lock()
+	defer j.runningMu.Unlock()
+	if running, ok := j.running[jobId]; ok {
+		running.cancel()
+		delete(j.running, jobId)
+	}
+}
+
+// CancelJob cancels a running job. Users can only cancel their own jobs, admins can cancel any.
+// False if there's no such job running (any more), or it isn't theirs.
+func (j *JobRunner) CancelJob(jobId string, userKey string, isAdmin bool) bool {
+	j.runningMu.Lock()
+	defer j.runningMu.Unlock()
+	running, ok := j.running[jobId]
+	if !ok || (!isAdmin && running.userKey != userKey) {
+		return false
+	}
+	running.cancel()
+	return true
+}
+
+func (j *JobRunner) RunRenderJob(ctx context.Context, job *job.RenderJob, updates chan job.JobStatus) {
 	if updates != nil {
 		defer close(updates)
 	}
@@ -58,7 +210,7 @@ func (j *JobRunner) RunRenderJob(job *job.RenderJob, updates chan job.JobStatus)
 	}
 	job.Log().Trace().Msgf("debug here job output dir: %s", job.OutputDir)
 
-	err = j.Tuner.RenderResume(job, updates)
+	err = j.Tuner.RenderResume(ctx, job, updates)
 	if err != nil {
 		job.Log().Error().Msgf("Error from resume rendering: %v", err)
 		tuner.SendJobErrorUpdate(updates, fmt.Sprintf("Error from resume tuning: %v", err))
@@ -66,10 +218,10 @@ func (j *JobRunner) RunRenderJob(job *job.RenderJob, updates chan job.JobStatus)
 	}
 }
 
-func (j *JobRunner) RunRenderStreaming(inputJob *job.RenderJob) chan job.JobStatus {
+func (j *JobRunner) RunRenderStreaming(ctx context.Context, inputJob *job.RenderJob) chan job.JobStatus {
 	inputJob.Log().Info().Msgf("running job")
 	updates := make(chan job.JobStatus)
-	go j.RunRenderJob(inputJob, updates)
+	go j.RunRenderJob(ctx, inputJob, updates)
 
 	return updates
 }
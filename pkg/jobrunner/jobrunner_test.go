@@ -0,0 +1,87 @@
+package jobrunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/render"
+	"pdfinspector/pkg/tuner"
+	"testing"
+	"time"
+)
+
+func TestCancelJob(t *testing.T) {
+	runner := &JobRunner{}
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.trackJob(&job.Job{Id: "job1", UserKey: "alice"}, cancel)
+
+	assert.False(t, runner.CancelJob("job2", "alice", false), "no such job")
+	assert.False(t, runner.CancelJob("job1", "bob", false), "not bob's job")
+	assert.NoError(t, ctx.Err())
+
+	assert.True(t, runner.CancelJob("job1", "alice", false))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	runner.untrackJob("job1")
+	assert.False(t, runner.CancelJob("job1", "", true), "finished jobs can't be cancelled, not even by admins")
+}
+
+func TestAdminsCanCancelAnyJob(t *testing.T) {
+	runner := &JobRunner{}
+	ctx, cancel := context.WithCancel(context.Background())
+	runner.trackJob(&job.Job{Id: "job1", UserKey: "alice"}, cancel)
+
+	assert.True(t, runner.CancelJob("job1", "", true))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestResumeJobStreamingWontRunAJobTwice(t *testing.T) {
+	runner := &JobRunner{}
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner.trackJob(&job.Job{Id: "job1", UserKey: "alice"}, cancel)
+
+	jobId := "job1"
+	resumed := &job.Job{}
+	resumed.PrepareDefault(&jobId)
+	updates, ok := runner.ResumeJobStreaming(context.Background(), &tuner.Checkpoint{Job: resumed})
+	assert.False(t, ok)
+	assert.Nil(t, updates)
+}
+
+func TestIsServerSideFailure(t *testing.T) {
+	serverSide := []error{
+		fmt.Errorf("LLM provider had a server error: %w", llm.ErrServer),
+		fmt.Errorf("LLM provider is rate limiting us: %w", llm.ErrRateLimited),
+		&render.GotenbergHTTPError{HttpResponseCode: 503},
+		errors.New("Error during pdf to image dump: Error running docker command: exit status 1"),
+		tuner.NewSchemaValidationError(nil),
+		fmt.Errorf("LLM request timed out: %w", context.DeadlineExceeded),
+	}
+	for _, err := range serverSide {
+		assert.True(t, isServerSideFailure(err), err.Error())
+	}
+
+	userSide := []error{
+		fmt.Errorf("request was too long for the model context: %w", llm.ErrContextLength),
+		&tuner.CompletionError{Phase: "attempt_0", Refusal: "no"},
+		&tuner.CompletionError{Phase: "attempt_0", FinishReason: "length"},
+		fmt.Errorf("LLM request was cancelled: %w", context.Canceled),
+	}
+	for i, err := range userSide {
+		assert.False(t, isServerSideFailure(err), "user side failure %d", i)
+	}
+}
+
+func TestTuningDoneOnlyCountsCancellingAsCancelled(t *testing.T) {
+	runner := &JobRunner{}
+	deadline, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	timedOut := job.NewDefaultJob()
+	runner.tuningDone(deadline, timedOut, deadline.Err(), nil)
+	assert.False(t, timedOut.Cancelled)
+	assert.ErrorIs(t, timedOut.ServerSideFailure, context.DeadlineExceeded, "a job we ran out of time for gets its credit back")
+}
@@ -0,0 +1,265 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const ANTHROPIC_DEFAULT_BASE_URL = "https://api.anthropic.com/v1"
+const ANTHROPIC_API_VERSION = "2023-06-01"
+
+// the messages api insists on max_tokens, openai doesn't. resumes can be wordy.
+const ANTHROPIC_DEFAULT_MAX_TOKENS = 8192
+
+// AnthropicClient implements LLMClient against the Anthropic messages API.
+// There is no response_format there, so structured output is done by forcing the model to call a single tool
+// whose input_schema is our response schema, and then treating the tool input as the content.
+type AnthropicClient struct {
+	BaseURL    string
+	ApiKey     string
+	HttpClient *http.Client
+}
+
+func NewAnthropicClient(apiKey string) *AnthropicClient {
+	return &AnthropicClient{
+		BaseURL:    ANTHROPIC_DEFAULT_BASE_URL,
+		ApiKey:     apiKey,
+		HttpClient: &http.Client{},
+	}
+}
+
+func (c *AnthropicClient) Name() string {
+	return "anthropic"
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (c *AnthropicClient) buildRequestBody(request *ChatRequest) map[string]interface{} {
+	//system prompt is a top level field, not a message.
+	var systemParts []string
+	var messages []ChatMessage
+	for _, message := range request.Messages {
+		if message.Role == "system" {
+			systemParts = append(systemParts, message.Content)
+			continue
+		}
+		messages = append(messages, message)
+	}
+
+	maxTokens := request.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = ANTHROPIC_DEFAULT_MAX_TOKENS
+	}
+	data := map[string]interface{}{
+		"model":       request.Model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": request.Temperature,
+	}
+	if len(systemParts) > 0 {
+		data["system"] = strings.Join(systemParts, "\n")
+	}
+	if request.ResponseSchema != nil {
+		data["tools"] = []map[string]interface{}{
+			{
+				"name":         request.ResponseSchema.Name,
+				"description":  "Respond with the structured output.",
+				"input_schema": request.ResponseSchema.Schema,
+			},
+		}
+		data["tool_choice"] = map[string]interface{}{
+			"type": "tool",
+			"name": request.ResponseSchema.Name,
+		}
+	}
+	if request.User != "" {
+		data["metadata"] = map[string]interface{}{
+			"user_id": request.User,
+		}
+	}
+	return data
+}
+
+func (c *AnthropicClient) ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	body := c.buildRequestBody(request)
+	handler := streamHandlerFromContext(ctx)
+	if handler != nil {
+		body["stream"] = true
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize API request body to JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/messages", c.BaseURL), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.ApiKey)
+	req.Header.Set("anthropic-version", ANTHROPIC_API_VERSION)
+
+	log.Debug().Msgf("sending chat completion request to %s", c.Name())
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && handler != nil {
+		return c.readStream(resp.Body, handler)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(c.Name(), resp, respBody)
+	}
+
+	var decoded anthropicResponse
+	err = json.Unmarshal(respBody, &decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize API response: %v", err)
+	}
+
+	return decoded.toChatResponse(), nil
+}
+
+type anthropicStreamEvent struct {
+	Message *anthropicResponse `json:"message"` //message_start
+	Delta   struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"` //content_block_delta and message_delta
+	Usage *struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"` //message_delta
+}
+
+// readStream puts the streamed events back together into an anthropicResponse, so it goes through the same toChatResponse as ever.
+// The tool input arrives as partial_json fragments which only make valid JSON once they're all joined up.
+func (c *AnthropicClient) readStream(body io.Reader, handler StreamHandler) (*ChatResponse, error) {
+	decoded := &anthropicResponse{}
+	var toolInput, text strings.Builder
+	tokens := 0
+
+	err := readServerSentEvents(body, func(event, data string) error {
+		if event == "error" {
+			return newStreamAPIError(c.Name(), data)
+		}
+		var streamEvent anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
+			return fmt.Errorf("failed to deserialize stream event: %v", err)
+		}
+		switch event {
+		case "message_start":
+			if streamEvent.Message != nil {
+				decoded.Model = streamEvent.Message.Model
+				decoded.Usage = streamEvent.Message.Usage
+			}
+		case "content_block_delta":
+			delta := streamEvent.Delta.PartialJSON
+			if streamEvent.Delta.Type == "text_delta" {
+				delta = streamEvent.Delta.Text
+				text.WriteString(delta)
+			} else {
+				toolInput.WriteString(delta)
+			}
+			if delta != "" {
+				tokens++
+				handler(delta, tokens)
+			}
+		case "message_delta":
+			if streamEvent.Delta.StopReason != "" {
+				decoded.StopReason = streamEvent.Delta.StopReason
+			}
+			if streamEvent.Usage != nil {
+				decoded.Usage.OutputTokens = streamEvent.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStreamDone
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if toolInput.Len() > 0 {
+		decoded.Content = append(decoded.Content, anthropicContentBlock{Type: "tool_use", Input: json.RawMessage(toolInput.String())})
+	}
+	if text.Len() > 0 {
+		decoded.Content = append(decoded.Content, anthropicContentBlock{Type: "text", Text: text.String()})
+	}
+	return decoded.toChatResponse(), nil
+}
+
+// toChatResponse squishes the anthropic content blocks into a single openai-ish choice.
+// With a forced tool call the tool input is the structured output, otherwise we just join up the text blocks.
+func (r *anthropicResponse) toChatResponse() *ChatResponse {
+	var content string
+	var textParts []string
+	for _, block := range r.Content {
+		switch block.Type {
+		case "tool_use":
+			content = string(block.Input)
+		case "text":
+			textParts = append(textParts, block.Text)
+		}
+	}
+	if content == "" {
+		content = strings.Join(textParts, "")
+	}
+
+	return &ChatResponse{
+		Model: r.Model,
+		Choices: []ChatChoice{{
+			Index: 0,
+			Message: ChatMessage{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: anthropicStopReasonToFinishReason(r.StopReason),
+		}},
+		Usage: Usage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			TotalTokens:      r.Usage.InputTokens + r.Usage.OutputTokens,
+		},
+	}
+}
+
+func anthropicStopReasonToFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "end_turn", "tool_use", "stop_sequence":
+		return "stop"
+	}
+	return stopReason
+}
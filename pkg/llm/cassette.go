@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pdfinspector/pkg/cassette"
+)
+
+const CASSETTE_KIND = "llm"
+
+// CassetteClient records completions to a cassette, or replays them from one without calling the wrapped client at all.
+type CassetteClient struct {
+	Client   LLMClient
+	Cassette *cassette.Cassette
+}
+
+func NewCassetteClient(client LLMClient, c *cassette.Cassette) *CassetteClient {
+	return &CassetteClient{
+		Client:   client,
+		Cassette: c,
+	}
+}
+
+func (c *CassetteClient) Name() string {
+	return fmt.Sprintf("%s (cassette %s)", c.Client.Name(), c.Cassette.Mode)
+}
+
+func (c *CassetteClient) ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	key, err := cassette.Key(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Cassette.Replaying() {
+		data, err := c.Cassette.Replay(CASSETTE_KIND, key)
+		if err != nil {
+			return nil, err
+		}
+		var response ChatResponse
+		err = json.Unmarshal(data, &response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to deserialize cassette recording: %v", err)
+		}
+		return &response, nil
+	}
+
+	response, err := c.Client.ChatCompletion(ctx, request)
+	if err != nil || !c.Cassette.Recording() {
+		return response, err
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize response for cassette: %v", err)
+	}
+	err = c.Cassette.Record(CASSETTE_KIND, key, data)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for the kinds of API failure we care to handle differently. APIError unwraps to one of these
+// so callers can just do errors.Is(err, llm.ErrRateLimited) etc without caring which provider it came from.
+var (
+	ErrRateLimited   = errors.New("llm rate limited")
+	ErrQuotaExceeded = errors.New("llm quota exceeded")
+	ErrContextLength = errors.New("llm context length exceeded")
+	ErrServer        = errors.New("llm server error")
+	ErrRequest       = errors.New("llm request error")
+)
+
+// APIError is a non-200 response from a provider.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	RetryAfter time.Duration //zero if the provider didn't tell us
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (http %d, %s): %s", e.Provider, e.StatusCode, e.kind.Error(), e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Retryable is true for the stuff that might work if we just wait a bit. Quota is not one of those.
+func (e *APIError) Retryable() bool {
+	return e.kind == ErrRateLimited || e.kind == ErrServer
+}
+
+// IsRetryable decides if an error from a ChatCompletion call is worth another go.
+// Besides retryable api errors we also retry timeouts and transport level failures, but never a cancelled job.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// providerErrorBody covers both the openai `{"error":{"message","type","code"}}` and anthropic `{"type":"error","error":{"type","message"}}` shapes.
+type providerErrorBody struct {
+	Error struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"` //openai sometimes sends a string here and sometimes null
+	} `json:"error"`
+}
+
+// newAPIError builds an APIError from a non-200 response and figures out what kind of failure it was.
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header),
+		Message:    strings.TrimSpace(string(body)),
+	}
+	var decoded providerErrorBody
+	if err := json.Unmarshal(body, &decoded); err == nil && decoded.Error.Message != "" {
+		apiErr.Message = decoded.Error.Message
+		apiErr.Type = decoded.Error.Type
+		if code, ok := decoded.Error.Code.(string); ok {
+			apiErr.Code = code
+		}
+	}
+	apiErr.kind = classifyAPIError(apiErr)
+	return apiErr
+}
+
+func classifyAPIError(e *APIError) error {
+	lowerMessage := strings.ToLower(e.Message)
+	switch {
+	case e.Code == "insufficient_quota" || e.Type == "insufficient_quota" || e.Code == "billing_hard_limit_reached":
+		return ErrQuotaExceeded
+	case e.Code == "context_length_exceeded" || strings.Contains(lowerMessage, "context length") || strings.Contains(lowerMessage, "prompt is too long"):
+		return ErrContextLength
+	case e.StatusCode == http.StatusTooManyRequests || e.Type == "rate_limit_error":
+		return ErrRateLimited
+	case e.StatusCode >= 500 || e.Type == "overloaded_error":
+		//anthropic uses a 529 for overloaded
+		return ErrServer
+	}
+	return ErrRequest
+}
+
+// parseRetryAfter understands Retry-After in seconds or as an http date, and the openai specific retry-after-ms.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if parsed, err := strconv.ParseFloat(ms, 64); err == nil && parsed > 0 {
+			return time.Duration(parsed * float64(time.Millisecond))
+		}
+	}
+	retryAfter := header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(retryAfter, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if when, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(when); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
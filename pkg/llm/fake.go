@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// FakeClient is an in-process LLMClient for tests and for running the pipeline without spending api credit.
+// It hands back Responses in order (the last one repeats once we run out), or defers to Handler if that is set.
+// Every request it receives is kept in Requests so tests can look at what got sent. Like a real client it gives up
+// with the context's error if that's already done.
+type FakeClient struct {
+	Responses []string
+	Handler   func(request *ChatRequest) (*ChatResponse, error)
+
+	Requests []*ChatRequest
+	mu       sync.Mutex
+}
+
+func NewFakeClient(responses ...string) *FakeClient {
+	return &FakeClient{Responses: responses}
+}
+
+func (c *FakeClient) Name() string {
+	return "fake"
+}
+
+func (c *FakeClient) ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Requests = append(c.Requests, request)
+
+	if c.Handler != nil {
+		return c.Handler(request)
+	}
+	if len(c.Responses) == 0 {
+		return nil, errors.New("fake llm client has no responses configured")
+	}
+	idx := len(c.Requests) - 1
+	if idx >= len(c.Responses) {
+		idx = len(c.Responses) - 1
+	}
+
+	return &ChatResponse{
+		Model: request.Model,
+		Choices: []ChatChoice{{
+			Message: ChatMessage{
+				Role:    "assistant",
+				Content: c.Responses[idx],
+			},
+			FinishReason: "stop",
+		}},
+	}, nil
+}
@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"context"
+)
+
+// LLMClient interface defines the operations we need from a chat completion provider.
+// Structured output (a response that conforms to a supplied JSON schema) is the main thing we actually use.
+type LLMClient interface {
+	ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error)
+	// Name of the provider, mostly just for logging.
+	Name() string
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	Refusal string `json:"refusal,omitempty"` //only in responses, when the model declined to produce the structured output
+}
+
+// ResponseSchema describes the JSON schema that the completion content must follow.
+type ResponseSchema struct {
+	Name   string      `json:"name"`
+	Strict bool        `json:"strict"`
+	Schema interface{} `json:"schema"`
+}
+
+// ChatRequest is the provider agnostic version of what we send. Each client translates it into whatever its API wants.
+type ChatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	ResponseSchema *ResponseSchema `json:"response_schema,omitempty"`
+	Temperature    float64         `json:"temperature"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// ChatResponse is deliberately shaped like the OpenAI chat completion response (the parts of it we care about)
+// so that the responses we write to disk look the same no matter which provider produced them.
+type ChatResponse struct {
+	Model   string       `json:"model,omitempty"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   Usage        `json:"usage"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatChoice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason,omitempty"`
+}
+
+// Content is a shortcut to the first choice message content, or empty string if there were no choices.
+func (r *ChatResponse) Content() string {
+	if r == nil || len(r.Choices) == 0 {
+		return ""
+	}
+	return r.Choices[0].Message.Content
+}
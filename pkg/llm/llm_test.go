@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pdfinspector/pkg/cassette"
+	"testing"
+)
+
+func testRequest() *ChatRequest {
+	return &ChatRequest{
+		Model: "some-model",
+		Messages: []ChatMessage{
+			{Role: "system", Content: "be helpful"},
+			{Role: "user", Content: "do the thing"},
+		},
+		ResponseSchema: &ResponseSchema{
+			Name:   "candidate_resume",
+			Strict: true,
+			Schema: map[string]interface{}{"type": "object"},
+		},
+		Temperature: 0.7,
+		User:        "someone",
+	}
+}
+
+func TestOpenAICompatibleClientShapesRequestAndParsesResponse(t *testing.T) {
+	var gotBody map[string]interface{}
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &gotBody)
+		w.Write([]byte(`{"model":"some-model","choices":[{"index":0,"message":{"role":"assistant","content":"{\"a\":1}"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAICompatibleClient(server.URL+"/v1/", "sekrit")
+	response, err := client.ChatCompletion(context.Background(), testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1/chat/completions", gotPath)
+	assert.Equal(t, "Bearer sekrit", gotAuth)
+	assert.Equal(t, "json_schema", gotBody["response_format"].(map[string]interface{})["type"])
+	assert.Equal(t, "candidate_resume", gotBody["response_format"].(map[string]interface{})["json_schema"].(map[string]interface{})["name"])
+	assert.Equal(t, "someone", gotBody["user"])
+	assert.Equal(t, `{"a":1}`, response.Content())
+	assert.Equal(t, "stop", response.Choices[0].FinishReason)
+}
+
+func TestAnthropicClientUsesForcedToolForStructuredOutput(t *testing.T) {
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "sekrit", r.Header.Get("x-api-key"))
+		assert.Equal(t, ANTHROPIC_API_VERSION, r.Header.Get("anthropic-version"))
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &gotBody)
+		w.Write([]byte(`{"model":"some-model","stop_reason":"tool_use","content":[{"type":"tool_use","name":"candidate_resume","input":{"a":1}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("sekrit")
+	client.BaseURL = server.URL + "/v1"
+	response, err := client.ChatCompletion(context.Background(), testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, "be helpful", gotBody["system"])
+	assert.Len(t, gotBody["messages"], 1)
+	assert.Equal(t, float64(ANTHROPIC_DEFAULT_MAX_TOKENS), gotBody["max_tokens"])
+	assert.Equal(t, "candidate_resume", gotBody["tool_choice"].(map[string]interface{})["name"])
+	assert.Equal(t, `{"a":1}`, response.Content())
+	assert.Equal(t, "stop", response.Choices[0].FinishReason)
+}
+
+func TestFakeClientRepeatsLastResponse(t *testing.T) {
+	client := NewFakeClient("one", "two")
+	for _, expected := range []string{"one", "two", "two"} {
+		response, err := client.ChatCompletion(context.Background(), testRequest())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, response.Content())
+	}
+	assert.Len(t, client.Requests, 3)
+}
+
+func TestEstimateCostUSDUsesLongestPrefix(t *testing.T) {
+	assert.InDelta(t, 0.75, EstimateCostUSD("gpt-4o-mini-2024-07-18", 1_000_000, 1_000_000), 0.0001)
+	assert.InDelta(t, 12.5, EstimateCostUSD("gpt-4o", 1_000_000, 1_000_000), 0.0001)
+	assert.Equal(t, 0.0, EstimateCostUSD("llama3:8b", 1_000_000, 1_000_000))
+}
+
+func TestCassetteClientReplaysWithoutCallingProvider(t *testing.T) {
+	dir := t.TempDir()
+	recorder, _ := cassette.New(dir, cassette.ModeRecord, cassette.MatchRequest)
+	recordClient := NewCassetteClient(NewFakeClient(`{"recorded":true}`), recorder)
+	_, err := recordClient.ChatCompletion(context.Background(), testRequest())
+	assert.NoError(t, err)
+
+	player, _ := cassette.New(dir, cassette.ModeReplay, cassette.MatchRequest)
+	provider := NewFakeClient()
+	replayClient := NewCassetteClient(provider, player)
+	response, err := replayClient.ChatCompletion(context.Background(), testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"recorded":true}`, response.Content())
+	assert.Len(t, provider.Requests, 0)
+}
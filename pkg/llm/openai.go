@@ -0,0 +1,189 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const OPENAI_DEFAULT_BASE_URL = "https://api.openai.com/v1"
+
+// OpenAIClient implements LLMClient against the OpenAI chat completions API.
+// Anything that speaks the same protocol (Ollama, vLLM, LM Studio etc) can be used by pointing BaseURL at it.
+type OpenAIClient struct {
+	BaseURL    string
+	ApiKey     string
+	HttpClient *http.Client
+}
+
+func NewOpenAIClient(apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		BaseURL:    OPENAI_DEFAULT_BASE_URL,
+		ApiKey:     apiKey,
+		HttpClient: &http.Client{},
+	}
+}
+
+// NewOpenAICompatibleClient is for local servers etc that implement the OpenAI API, they often don't need a key at all.
+func NewOpenAICompatibleClient(baseURL, apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		ApiKey:     apiKey,
+		HttpClient: &http.Client{},
+	}
+}
+
+func (c *OpenAIClient) Name() string {
+	if c.BaseURL == OPENAI_DEFAULT_BASE_URL {
+		return "openai"
+	}
+	return fmt.Sprintf("openai-compatible (%s)", c.BaseURL)
+}
+
+// buildRequestBody translates our ChatRequest into the map we've always sent to OpenAI.
+func (c *OpenAIClient) buildRequestBody(request *ChatRequest) map[string]interface{} {
+	data := map[string]interface{}{
+		"model":       request.Model,
+		"messages":    request.Messages,
+		"temperature": request.Temperature,
+	}
+	if request.ResponseSchema != nil {
+		data["response_format"] = map[string]interface{}{
+			"type":        "json_schema",
+			"json_schema": request.ResponseSchema,
+		}
+	}
+	if request.MaxTokens > 0 {
+		data["max_tokens"] = request.MaxTokens
+	}
+	if request.User != "" {
+		data["user"] = request.User
+	}
+	return data
+}
+
+func (c *OpenAIClient) ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	body := c.buildRequestBody(request)
+	handler := streamHandlerFromContext(ctx)
+	if handler != nil {
+		body["stream"] = true
+		//otherwise there's no usage at all in a streamed response
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize API request body to JSON: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/chat/completions", c.BaseURL), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.ApiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.ApiKey))
+	}
+
+	log.Debug().Msgf("sending chat completion request to %s", c.Name())
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && handler != nil {
+		return c.readStream(resp.Body, handler)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(c.Name(), resp, respBody)
+	}
+
+	var chatResponse ChatResponse
+	err = json.Unmarshal(respBody, &chatResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize API response: %v", err)
+	}
+	return &chatResponse, nil
+}
+
+type openAIStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"` //some compatible servers report failures in the stream
+}
+
+// readStream assembles the streamed chunks back into the same ChatResponse a non streaming call would have returned.
+func (c *OpenAIClient) readStream(body io.Reader, handler StreamHandler) (*ChatResponse, error) {
+	response := &ChatResponse{}
+	var content, refusal strings.Builder
+	var finishReason string
+	tokens := 0
+
+	err := readServerSentEvents(body, func(event, data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to deserialize stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return newStreamAPIError(c.Name(), data)
+		}
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			response.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+			refusal.WriteString(choice.Delta.Refusal)
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				tokens++
+				handler(choice.Delta.Content, tokens)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response.Choices = []ChatChoice{{
+		Index: 0,
+		Message: ChatMessage{
+			Role:    "assistant",
+			Content: content.String(),
+			Refusal: refusal.String(),
+		},
+		FinishReason: finishReason,
+	}}
+	return response, nil
+}
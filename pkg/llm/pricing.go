@@ -0,0 +1,36 @@
+package llm
+
+import "strings"
+
+// modelPrice is USD per million tokens.
+type modelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// modelPrices is a best effort list, these change whenever the vendors feel like it so treat the cost as an estimate.
+// Longest matching prefix wins so that dated model snapshots (gpt-4o-mini-2024-07-18 etc) get priced too.
+var modelPrices = map[string]modelPrice{
+	"gpt-4o-mini":       {Prompt: 0.15, Completion: 0.60},
+	"gpt-4o":            {Prompt: 2.50, Completion: 10.00},
+	"gpt-4.1-mini":      {Prompt: 0.40, Completion: 1.60},
+	"gpt-4.1":           {Prompt: 2.00, Completion: 8.00},
+	"claude-3-5-haiku":  {Prompt: 0.80, Completion: 4.00},
+	"claude-3-5-sonnet": {Prompt: 3.00, Completion: 15.00},
+	"claude-sonnet-4":   {Prompt: 3.00, Completion: 15.00},
+}
+
+// EstimateCostUSD gives a rough dollar cost for some token counts, zero for models we don't know (eg local ones).
+func EstimateCostUSD(model string, promptTokens, completionTokens int) float64 {
+	var best string
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return 0
+	}
+	price := modelPrices[best]
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1_000_000
+}
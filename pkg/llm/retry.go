@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"math/rand"
+	"time"
+)
+
+// RetryNotifier gets told about each retry before we go to sleep, so that callers can let the user know what's going on.
+type RetryNotifier func(retry int, maxRetries int, wait time.Duration, err error)
+
+type retryNotifierKey struct{}
+
+// WithRetryNotifier attaches a RetryNotifier to the context for the calls made with it.
+// The client is shared between jobs so this is how a single job gets to hear about its own retries.
+func WithRetryNotifier(ctx context.Context, notifier RetryNotifier) context.Context {
+	return context.WithValue(ctx, retryNotifierKey{}, notifier)
+}
+
+func retryNotifierFromContext(ctx context.Context) RetryNotifier {
+	notifier, _ := ctx.Value(retryNotifierKey{}).(RetryNotifier)
+	return notifier
+}
+
+// RetryingClient wraps another LLMClient with per-call timeouts and retries using jittered exponential backoff.
+// When the provider says how long to wait (Retry-After) we wait at least that long.
+type RetryingClient struct {
+	Client      LLMClient
+	MaxRetries  int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	CallTimeout time.Duration //zero means no per-call timeout beyond whatever the parent context has
+
+	sleep func(ctx context.Context, d time.Duration) error //swappable for tests
+}
+
+func NewRetryingClient(client LLMClient, maxRetries int, callTimeout time.Duration) *RetryingClient {
+	return &RetryingClient{
+		Client:      client,
+		MaxRetries:  maxRetries,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    30 * time.Second,
+		CallTimeout: callTimeout,
+	}
+}
+
+func (c *RetryingClient) Name() string {
+	return c.Client.Name()
+}
+
+func (c *RetryingClient) ChatCompletion(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	notifier := retryNotifierFromContext(ctx)
+	for retry := 0; ; retry++ {
+		response, err := c.callOnce(ctx, request)
+		if err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			//job was cancelled or ran out of time, no point carrying on.
+			return nil, ctx.Err()
+		}
+		if !IsRetryable(err) || retry >= c.MaxRetries {
+			return nil, err
+		}
+
+		wait := c.backoff(retry, err)
+		log.Info().Msgf("retryable error from %s (retry %d of %d in %s): %v", c.Name(), retry+1, c.MaxRetries, wait, err)
+		if notifier != nil {
+			notifier(retry+1, c.MaxRetries, wait, err)
+		}
+		if err := c.doSleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *RetryingClient) callOnce(ctx context.Context, request *ChatRequest) (*ChatResponse, error) {
+	if c.CallTimeout <= 0 {
+		return c.Client.ChatCompletion(ctx, request)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, c.CallTimeout)
+	defer cancel()
+	return c.Client.ChatCompletion(callCtx, request)
+}
+
+// backoff is "equal jitter" exponential backoff, bumped up to Retry-After if the provider supplied one.
+func (c *RetryingClient) backoff(retry int, err error) time.Duration {
+	delay := c.BaseDelay << retry
+	if delay > c.MaxDelay || delay <= 0 {
+		delay = c.MaxDelay
+	}
+	wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+		wait = apiErr.RetryAfter
+	}
+	return wait
+}
+
+func (c *RetryingClient) doSleep(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIClientReturnsTypedErrors(t *testing.T) {
+	tests := []struct {
+		status     int
+		body       string
+		retryAfter string
+		expected   error
+		retryable  bool
+	}{
+		{429, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`, "7", ErrRateLimited, true},
+		{429, `{"error":{"message":"pay up","type":"insufficient_quota","code":"insufficient_quota"}}`, "", ErrQuotaExceeded, false},
+		{400, `{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`, "", ErrContextLength, false},
+		{503, `upstream connect error`, "", ErrServer, true},
+		{401, `{"error":{"message":"bad key","type":"invalid_request_error","code":"invalid_api_key"}}`, "", ErrRequest, false},
+	}
+
+	for _, tc := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+		client := NewOpenAICompatibleClient(server.URL, "")
+		_, err := client.ChatCompletion(context.Background(), testRequest())
+		server.Close()
+
+		assert.ErrorIs(t, err, tc.expected)
+		assert.Equal(t, tc.retryable, IsRetryable(err))
+		if tc.retryAfter != "" {
+			var apiErr *APIError
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, 7*time.Second, apiErr.RetryAfter)
+		}
+	}
+}
+
+func TestRetryingClientRetriesThenSucceeds(t *testing.T) {
+	calls := 0
+	fake := &FakeClient{Handler: func(request *ChatRequest) (*ChatResponse, error) {
+		calls++
+		if calls < 3 {
+			return nil, &APIError{StatusCode: 429, RetryAfter: 5 * time.Second, kind: ErrRateLimited}
+		}
+		return &ChatResponse{Choices: []ChatChoice{{Message: ChatMessage{Content: "ok"}}}}, nil
+	}}
+
+	var slept []time.Duration
+	var notified []int
+	client := NewRetryingClient(fake, 4, time.Second)
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	ctx := WithRetryNotifier(context.Background(), func(retry int, maxRetries int, wait time.Duration, err error) {
+		notified = append(notified, retry)
+	})
+
+	response, err := client.ChatCompletion(ctx, testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", response.Content())
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, notified)
+	for _, d := range slept {
+		assert.GreaterOrEqual(t, d, 5*time.Second) //honoured Retry-After
+	}
+}
+
+func TestRetryingClientGivesUpOnNonRetryable(t *testing.T) {
+	calls := 0
+	fake := &FakeClient{Handler: func(request *ChatRequest) (*ChatResponse, error) {
+		calls++
+		return nil, &APIError{StatusCode: 429, kind: ErrQuotaExceeded}
+	}}
+	client := NewRetryingClient(fake, 4, time.Second)
+	_, err := client.ChatCompletion(context.Background(), testRequest())
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamHandler receives content deltas as they arrive from a streaming completion.
+// tokens is a running count of completion tokens so far. It's approximate (one per delta), providers only tell us the real number at the end.
+type StreamHandler func(delta string, tokens int)
+
+type streamHandlerKey struct{}
+
+// WithStreamHandler asks for the calls made with this context to be streamed, with each delta handed to the handler.
+// The complete response is still assembled and returned from ChatCompletion as usual, so callers don't need to change
+// how they deal with the result. Clients that can't stream just ignore it.
+func WithStreamHandler(ctx context.Context, handler StreamHandler) context.Context {
+	return context.WithValue(ctx, streamHandlerKey{}, handler)
+}
+
+func streamHandlerFromContext(ctx context.Context) StreamHandler {
+	handler, _ := ctx.Value(streamHandlerKey{}).(StreamHandler)
+	return handler
+}
+
+// errStreamDone is how an event callback says it has seen the end of the stream.
+var errStreamDone = errors.New("end of stream")
+
+// readServerSentEvents calls fn with the event name and data of each server sent event in body,
+// until the body runs out or fn returns an error. errStreamDone is not treated as an error.
+func readServerSentEvents(body io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(body)
+	//a single delta is tiny, but the final event from some servers repeats the whole thing
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event, data = "", nil
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				if errors.Is(err, errStreamDone) {
+					return nil
+				}
+				return err
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+	if err := dispatch(); err != nil && !errors.Is(err, errStreamDone) {
+		return err
+	}
+	return nil
+}
+
+// newStreamAPIError is for errors that show up as an event part way through a stream, after we already got a 200.
+func newStreamAPIError(provider string, data string) *APIError {
+	apiErr := &APIError{
+		Provider:   provider,
+		StatusCode: http.StatusOK,
+		Message:    strings.TrimSpace(data),
+	}
+	var decoded providerErrorBody
+	if err := json.Unmarshal([]byte(data), &decoded); err == nil && decoded.Error.Message != "" {
+		apiErr.Message = decoded.Error.Message
+		apiErr.Type = decoded.Error.Type
+		if code, ok := decoded.Error.Code.(string); ok {
+			apiErr.Code = code
+		}
+	}
+	apiErr.kind = classifyAPIError(apiErr)
+	return apiErr
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIClientStreamsDeltasAndAssemblesResponse(t *testing.T) {
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &gotBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"model":"some-model","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`{"model":"some-model","choices":[{"index":0,"delta":{"content":"{\"a\""}}]}`,
+			`{"model":"some-model","choices":[{"index":0,"delta":{"content":":1}"},"finish_reason":"stop"}]}`,
+			`{"model":"some-model","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer server.Close()
+
+	var deltas []string
+	ctx := WithStreamHandler(context.Background(), func(delta string, tokens int) {
+		deltas = append(deltas, delta)
+		assert.Equal(t, len(deltas), tokens)
+	})
+	client := NewOpenAICompatibleClient(server.URL, "")
+	response, err := client.ChatCompletion(ctx, testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, true, gotBody["stream"])
+	assert.Equal(t, []string{`{"a"`, `:1}`}, deltas)
+	assert.Equal(t, `{"a":1}`, response.Content())
+	assert.Equal(t, "stop", response.Choices[0].FinishReason)
+	assert.Equal(t, 12, response.Usage.TotalTokens)
+}
+
+func TestAnthropicClientStreamsToolInput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range [][2]string{
+			{"message_start", `{"type":"message_start","message":{"model":"some-model","usage":{"input_tokens":10,"output_tokens":1}}}`},
+			{"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","name":"candidate_resume","input":{}}}`},
+			{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"a\""}}`},
+			{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":":1}"}}`},
+			{"message_delta", `{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":5}}`},
+			{"message_stop", `{"type":"message_stop"}`},
+		} {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event[0], event[1])
+		}
+	}))
+	defer server.Close()
+
+	tokens := 0
+	ctx := WithStreamHandler(context.Background(), func(delta string, count int) {
+		tokens = count
+	})
+	client := NewAnthropicClient("sekrit")
+	client.BaseURL = server.URL
+	response, err := client.ChatCompletion(ctx, testRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tokens)
+	assert.Equal(t, `{"a":1}`, response.Content())
+	assert.Equal(t, "length", response.Choices[0].FinishReason)
+	assert.Equal(t, 15, response.Usage.TotalTokens)
+}
+
+func TestStreamErrorEventIsTyped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	client := NewAnthropicClient("sekrit")
+	client.BaseURL = server.URL
+	_, err := client.ChatCompletion(WithStreamHandler(context.Background(), func(string, int) {}), testRequest())
+	assert.ErrorIs(t, err, ErrServer)
+	assert.True(t, IsRetryable(err))
+}
@@ -0,0 +1,115 @@
+package prompts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+)
+
+// Experiments are A/B(/C...) tests between prompt sets, defined in <dir>/experiments.json. A variant is just a prompt set,
+// so a different ordering of the compose prompt is a set with a BASE of default and one overridden template.
+// Jobs get assigned a variant deterministically from their id, so the same job always gets the same variant.
+const EXPERIMENTS_FILENAME = "experiments.json"
+
+type Variant struct {
+	Name      string `json:"name"`
+	PromptSet string `json:"prompt_set"`
+	Weight    int    `json:"weight"` //relative to the other variants, doesn't need to add up to 100
+}
+
+type Experiment struct {
+	Name     string    `json:"name"`
+	Enabled  bool      `json:"enabled"`
+	Layouts  []string  `json:"layouts,omitempty"` //empty means any layout
+	Variants []Variant `json:"variants"`
+}
+
+// AppliesTo is true if the experiment is running and covers the layout.
+func (e *Experiment) AppliesTo(layout string) bool {
+	if !e.Enabled {
+		return false
+	}
+	if len(e.Layouts) == 0 {
+		return true
+	}
+	for _, l := range e.Layouts {
+		if l == layout {
+			return true
+		}
+	}
+	return false
+}
+
+// Assign picks the variant for a job. The experiment name goes into the hash too, so that a job isn't
+// always in the first variant of every experiment just because it happened to be in the first of one.
+func (e *Experiment) Assign(jobID string) Variant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + "/" + jobID))
+	point := int(h.Sum32() % uint32(total))
+	for _, v := range e.Variants {
+		if point < v.Weight {
+			return v
+		}
+		point -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1] //unreachable really, validate makes sure total > 0
+}
+
+// ExperimentFor returns the first running experiment that covers the layout, or nil.
+func (l *Library) ExperimentFor(layout string) *Experiment {
+	for i := range l.Experiments {
+		if l.Experiments[i].AppliesTo(layout) {
+			return &l.Experiments[i]
+		}
+	}
+	return nil
+}
+
+// loadExperiments reads the experiments file if there is one, no file just means no experiments.
+func (l *Library) loadExperiments() error {
+	data, err := os.ReadFile(filepath.Join(l.Dir, EXPERIMENTS_FILENAME))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", EXPERIMENTS_FILENAME, err)
+	}
+	var experiments []Experiment
+	err = json.Unmarshal(data, &experiments)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %v", EXPERIMENTS_FILENAME, err)
+	}
+
+	names := map[string]bool{}
+	for _, experiment := range experiments {
+		if experiment.Name == "" || names[experiment.Name] {
+			return fmt.Errorf("experiments need a unique name, got '%s'", experiment.Name)
+		}
+		names[experiment.Name] = true
+		if len(experiment.Variants) == 0 {
+			return fmt.Errorf("experiment %s has no variants", experiment.Name)
+		}
+		variantNames := map[string]bool{}
+		for _, variant := range experiment.Variants {
+			if variant.Name == "" || variantNames[variant.Name] {
+				return fmt.Errorf("experiment %s variants need a unique name, got '%s'", experiment.Name, variant.Name)
+			}
+			variantNames[variant.Name] = true
+			if variant.Weight <= 0 {
+				return fmt.Errorf("experiment %s variant %s needs a weight above zero", experiment.Name, variant.Name)
+			}
+			if _, err := l.Set(variant.PromptSet); err != nil {
+				return fmt.Errorf("experiment %s variant %s: %v", experiment.Name, variant.Name, err)
+			}
+		}
+	}
+	l.Experiments = experiments
+	return nil
+}
@@ -0,0 +1,73 @@
+package prompts
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeExperiments(t *testing.T, dir string, content string) {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, EXPERIMENTS_FILENAME), []byte(content), 0644))
+}
+
+func TestVariantSetOverridesItsBase(t *testing.T) {
+	dir := t.TempDir()
+	writePromptSet(t, filepath.Join(dir, "default"), "1", map[string]string{"a": "default a", "b": "default b"})
+	writePromptSet(t, filepath.Join(dir, "reordered"), "1", map[string]string{"b": "reordered b"})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "reordered", BASE_FILENAME), []byte("default\n"), 0644))
+
+	library, err := Load(dir, []string{"a", "b"})
+	assert.NoError(t, err)
+	set, err := library.Set("reordered")
+	assert.NoError(t, err)
+	a, _ := set.Render("a", Data{})
+	b, _ := set.Render("b", Data{})
+	assert.Equal(t, "default a", a)
+	assert.Equal(t, "reordered b", b)
+}
+
+func TestExperimentAssignmentIsStickyAndWeighted(t *testing.T) {
+	dir := t.TempDir()
+	writePromptSet(t, filepath.Join(dir, "default"), "1", map[string]string{"a": "a"})
+	writePromptSet(t, filepath.Join(dir, "other"), "1", map[string]string{"a": "other a"})
+	writeExperiments(t, dir, `[
+		{"name": "off", "enabled": false, "variants": [{"name": "x", "prompt_set": "default", "weight": 1}]},
+		{"name": "order", "enabled": true, "layouts": ["chrono"], "variants": [
+			{"name": "control", "prompt_set": "default", "weight": 3},
+			{"name": "treatment", "prompt_set": "other", "weight": 1}
+		]}
+	]`)
+
+	library, err := Load(dir, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, library.ExperimentFor("coverletter"))
+	experiment := library.ExperimentFor("chrono")
+	if assert.NotNil(t, experiment) {
+		assert.Equal(t, "order", experiment.Name)
+	}
+
+	assert.Equal(t, experiment.Assign("some-job-id"), experiment.Assign("some-job-id"))
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[experiment.Assign(fmt.Sprintf("job-%d", i)).Name]++
+	}
+	assert.InDelta(t, 3000, counts["control"], 200)
+	assert.InDelta(t, 1000, counts["treatment"], 200)
+}
+
+func TestLoadRejectsBrokenExperiments(t *testing.T) {
+	for name, experiments := range map[string]string{
+		"unknown set":    `[{"name": "e", "enabled": true, "variants": [{"name": "v", "prompt_set": "nope", "weight": 1}]}]`,
+		"zero weight":    `[{"name": "e", "enabled": true, "variants": [{"name": "v", "prompt_set": "default", "weight": 0}]}]`,
+		"no variants":    `[{"name": "e", "enabled": true}]`,
+		"duplicate name": `[{"name": "e", "variants": [{"name": "v", "prompt_set": "default", "weight": 1}]}, {"name": "e", "variants": [{"name": "v", "prompt_set": "default", "weight": 1}]}]`,
+	} {
+		dir := t.TempDir()
+		writePromptSet(t, filepath.Join(dir, "default"), "1", map[string]string{"a": "a"})
+		writeExperiments(t, dir, experiments)
+		_, err := Load(dir, nil)
+		assert.Error(t, err, name)
+	}
+}
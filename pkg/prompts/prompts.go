@@ -0,0 +1,241 @@
+package prompts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Prompts live in text/template files so they can be changed without a rebuild. They are grouped into sets:
+//
+//	<dir>/<set>/VERSION     version id of the set, bump it whenever the prompts in the set change
+//	<dir>/<set>/BASE        optional, name of another set to start from. Only the templates that differ need to be in this one.
+//	<dir>/<set>/*.tmpl      one template per file, named after the file (chrono_main.tmpl is "chrono_main")
+//
+// All the templates in a set are parsed together so they can {{template}} each other.
+const DEFAULT_SET = "default"
+const VERSION_FILENAME = "VERSION"
+const BASE_FILENAME = "BASE"
+const TEMPLATE_EXT = ".tmpl"
+
+// Data is everything a prompt template can refer to. Not every field is filled in for every prompt,
+// eg ResumeText is only there for extraction, ReduceByPct only for the length corrections.
+type Data struct {
+	Layout          string
+	JobDescription  string
+	MainPrompt      string
+	Keywords        []string
+	BaselineJSON    string
+	Supplement      string //resumedata from a users template, to inform a cover letter
+	ResumeText      string
+	AcceptableRatio int      //percent of the page that needs filling
+	ContentRatio    int      //percent of the last page the previous attempt filled
+	NumberOfPages   int      //that the previous attempt rendered to
+	TargetPages     int      //that we're after, see the pages func
+	SchemaErrors    []string //what's wrong with output that didn't match the layout schema
+	Fabrications    []string //details the fabrication guard couldn't find in the baseline
+	ReduceByPct     int
+	IncreaseByPct   int
+}
+
+// sampleData is used to try out every template at load time, so a typo in a field name fails startup instead of a job.
+var sampleData = Data{
+	Layout:          "chrono",
+	JobDescription:  "sample job description",
+	MainPrompt:      "sample main prompt",
+	Keywords:        []string{"go", "kubernetes"},
+	BaselineJSON:    "{}",
+	Supplement:      "{}",
+	ResumeText:      "sample resume text",
+	AcceptableRatio: 88,
+	ContentRatio:    50,
+	NumberOfPages:   2,
+	TargetPages:     2,
+	SchemaErrors:    []string{"(root): skills is required"},
+	Fabrications:    []string{`employer "Initech" at work_history[0].company`},
+	ReduceByPct:     10,
+	IncreaseByPct:   10,
+}
+
+var funcs = template.FuncMap{
+	"join": func(items []string, sep string) string {
+		return strings.Join(items, sep)
+	},
+	//pages is "one page" for a target of 1 (or unset), "2 pages" etc otherwise
+	"pages": func(n int) string {
+		if n <= 1 {
+			return "one page"
+		}
+		return fmt.Sprintf("%d pages", n)
+	},
+}
+
+type Set struct {
+	Name    string
+	Version string
+	Hash    string //of the template files, so that an edit without a version bump can still be told apart
+
+	templates *template.Template
+}
+
+// ID identifies exactly which prompts were used, it's what gets recorded with a job.
+func (s *Set) ID() string {
+	return fmt.Sprintf("%s@%s+%s", s.Name, s.Version, s.Hash[:8])
+}
+
+// Has is true if the set defines the named template.
+func (s *Set) Has(name string) bool {
+	return s.templates.Lookup(name) != nil
+}
+
+// Render executes the named template. Leading and trailing whitespace is trimmed so the files can end with a newline.
+func (s *Set) Render(name string, data Data) (string, error) {
+	var buf bytes.Buffer
+	err := s.templates.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render prompt %s from set %s: %v", name, s.ID(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+type Library struct {
+	Dir         string
+	Sets        map[string]*Set
+	Experiments []Experiment
+}
+
+// Load reads every set under dir, and checks that each one has all the required templates and that they render.
+// Then the experiments, if any, which can only refer to sets that loaded fine.
+func Load(dir string, required []string) (*Library, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompts dir: %v", err)
+	}
+	library := &Library{
+		Dir:  dir,
+		Sets: map[string]*Set{},
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		set, err := loadSet(filepath.Join(dir, entry.Name()), entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		err = set.validate(required)
+		if err != nil {
+			return nil, err
+		}
+		library.Sets[set.Name] = set
+		log.Info().Msgf("loaded prompt set %s", set.ID())
+	}
+	if len(library.Sets) == 0 {
+		return nil, fmt.Errorf("no prompt sets found in %s", dir)
+	}
+	err = library.loadExperiments()
+	if err != nil {
+		return nil, err
+	}
+	return library, nil
+}
+
+// Set returns the named set, or an error if there is no such thing.
+func (l *Library) Set(name string) (*Set, error) {
+	set, ok := l.Sets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt set: %s", name)
+	}
+	return set, nil
+}
+
+func loadSet(dir string, name string) (*Set, error) {
+	version, err := os.ReadFile(filepath.Join(dir, VERSION_FILENAME))
+	if err != nil {
+		return nil, fmt.Errorf("prompt set %s needs a %s file: %v", name, VERSION_FILENAME, err)
+	}
+	files, err := templateFiles(dir, map[string]bool{})
+	if err != nil {
+		return nil, fmt.Errorf("prompt set %s: %v", name, err)
+	}
+
+	hash := sha256.New()
+	templates := template.New(name).Funcs(funcs).Option("missingkey=error")
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %v", file, err)
+		}
+		templateName := strings.TrimSuffix(filepath.Base(file), TEMPLATE_EXT)
+		_, err = templates.New(templateName).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template %s: %v", file, err)
+		}
+		fmt.Fprintf(hash, "%s\n%s\n", templateName, content)
+	}
+
+	return &Set{
+		Name:      name,
+		Version:   strings.TrimSpace(string(version)),
+		Hash:      hex.EncodeToString(hash.Sum(nil)),
+		templates: templates,
+	}, nil
+}
+
+// templateFiles lists the template files of a set, those of its base set (and so on) first so that the set's own ones win.
+func templateFiles(dir string, seen map[string]bool) ([]string, error) {
+	if seen[dir] {
+		return nil, fmt.Errorf("%s is its own base", filepath.Base(dir))
+	}
+	seen[dir] = true
+
+	var files []string
+	base, err := os.ReadFile(filepath.Join(dir, BASE_FILENAME))
+	if err == nil {
+		baseDir := filepath.Join(filepath.Dir(dir), strings.TrimSpace(string(base)))
+		files, err = templateFiles(baseDir, seen)
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	own, err := filepath.Glob(filepath.Join(dir, "*"+TEMPLATE_EXT))
+	if err != nil {
+		return nil, err
+	}
+	if len(own) == 0 && len(files) == 0 {
+		_, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("no such prompt set dir: %v", err)
+		}
+	}
+	sort.Strings(own)
+	return append(files, own...), nil
+}
+
+func (s *Set) validate(required []string) error {
+	for _, name := range required {
+		if !s.Has(name) {
+			return fmt.Errorf("prompt set %s is missing required template %s", s.Name, name)
+		}
+	}
+	for _, tmpl := range s.templates.Templates() {
+		if tmpl.Tree == nil {
+			continue //just the empty root
+		}
+		_, err := s.Render(tmpl.Name(), sampleData)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
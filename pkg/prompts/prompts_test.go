@@ -0,0 +1,65 @@
+package prompts
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePromptSet(t *testing.T, dir string, version string, templates map[string]string) {
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, VERSION_FILENAME), []byte(version+"\n"), 0644))
+	for name, content := range templates {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name+TEMPLATE_EXT), []byte(content), 0644))
+	}
+}
+
+func TestLoadRendersWithNamedVariables(t *testing.T) {
+	dir := t.TempDir()
+	writePromptSet(t, filepath.Join(dir, "default"), "3", map[string]string{
+		"too_long": "Too long, reduce by {{.ReduceByPct}}%.",
+		"compose":  "{{template \"too_long\" .}} Keywords: {{join .Keywords \", \"}}\n",
+	})
+
+	library, err := Load(dir, []string{"too_long", "compose"})
+	assert.NoError(t, err)
+	set, err := library.Set(DEFAULT_SET)
+	assert.NoError(t, err)
+	assert.Regexp(t, `^default@3\+[0-9a-f]{8}$`, set.ID())
+
+	rendered, err := set.Render("compose", Data{ReduceByPct: 12, Keywords: []string{"go", "gcp"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Too long, reduce by 12%. Keywords: go, gcp", rendered)
+
+	_, err = library.Set("nope")
+	assert.Error(t, err)
+}
+
+func TestLoadRejectsBrokenSets(t *testing.T) {
+	missing := t.TempDir()
+	writePromptSet(t, filepath.Join(missing, "default"), "1", map[string]string{"too_long": "ok"})
+	_, err := Load(missing, []string{"too_long", "too_short"})
+	assert.ErrorContains(t, err, "missing required template too_short")
+
+	typo := t.TempDir()
+	writePromptSet(t, filepath.Join(typo, "default"), "1", map[string]string{"too_long": "reduce by {{.ReduceByPercent}}%"})
+	_, err = Load(typo, []string{"too_long"})
+	assert.ErrorContains(t, err, "ReduceByPercent")
+
+	unversioned := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(unversioned, "default"), 0755))
+	_, err = Load(unversioned, nil)
+	assert.ErrorContains(t, err, VERSION_FILENAME)
+}
+
+func TestHashChangesWithContent(t *testing.T) {
+	dir := t.TempDir()
+	writePromptSet(t, filepath.Join(dir, "default"), "1", map[string]string{"a": "one"})
+	first, err := Load(dir, nil)
+	assert.NoError(t, err)
+	writePromptSet(t, filepath.Join(dir, "default"), "1", map[string]string{"a": "two"})
+	second, err := Load(dir, nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Sets["default"].ID(), second.Sets["default"].ID())
+}
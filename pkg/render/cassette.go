@@ -0,0 +1,67 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"pdfinspector/pkg/cassette"
+	"pdfinspector/pkg/job"
+)
+
+const CASSETTE_KIND = "render"
+
+// CassetteRenderer records rendered PDFs to a cassette, or replays them from one without calling the wrapped renderer at all.
+// The key is what actually gets rendered (layout plus the resumedata) rather than anything with the job id in it.
+type CassetteRenderer struct {
+	Renderer Renderer
+	Cassette *cassette.Cassette
+}
+
+func NewCassetteRenderer(renderer Renderer, c *cassette.Cassette) *CassetteRenderer {
+	return &CassetteRenderer{
+		Renderer: renderer,
+		Cassette: c,
+	}
+}
+
+func (r *CassetteRenderer) Name() string {
+	return fmt.Sprintf("%s (cassette %s)", r.Renderer.Name(), r.Cassette.Mode)
+}
+
+func (r *CassetteRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	key, err := cassetteKey(j, r.Renderer.Name(), resumedata)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Cassette.Replaying() {
+		pdf, err := r.Cassette.Replay(CASSETTE_KIND, key)
+		if err != nil {
+			return nil, err
+		}
+		j.Log().Info().Msgf("replayed PDF for attempt %d from cassette", attempt)
+		return pdf, nil
+	}
+
+	pdf, err := r.Renderer.Render(ctx, j, attempt, resumedata)
+	if err != nil || !r.Cassette.Recording() {
+		return pdf, err
+	}
+	err = r.Cassette.Record(CASSETTE_KIND, key, pdf)
+	if err != nil {
+		return nil, err
+	}
+	return pdf, nil
+}
+
+// cassetteKey is what a render gets recorded under. The renderers don't make the same PDF, so which one it was is part of it.
+func cassetteKey(j *job.Job, rendererName string, resumedata []byte) (string, error) {
+	keyed := map[string]interface{}{
+		"layout":     j.Layout,
+		"resumedata": string(resumedata),
+		"renderer":   rendererName,
+	}
+	if j.PrintOptions.Set() {
+		keyed["print"] = j.PrintOptions
+	}
+	return cassette.Key(keyed)
+}
@@ -0,0 +1,271 @@
+package render
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"io"
+	"os"
+	"os/exec"
+	"pdfinspector/pkg/document"
+	"pdfinspector/pkg/job"
+	"strings"
+	"time"
+)
+
+// ChromiumRenderer prints the HTML from the document package to PDF with a headless chromium that we start ourselves
+// and drive over the devtools protocol (CDP), so there's no gotenberg to run. Meant for single binary deployments
+// where chromium is installed next to us. A fresh browser is started for every render, which is slower but means
+// nothing is left over from one job to the next.
+type ChromiumRenderer struct {
+	Path          string //the chromium (or chrome) binary
+	LaunchTimeout time.Duration
+
+	launch func(ctx context.Context) (wsURL string, stop func(), err error) //swappable for tests
+}
+
+func NewChromiumRenderer(path string) *ChromiumRenderer {
+	r := &ChromiumRenderer{
+		Path:          path,
+		LaunchTimeout: 30 * time.Second,
+	}
+	r.launch = r.launchChromium
+	return r
+}
+
+func (r *ChromiumRenderer) Name() string {
+	return "chromium"
+}
+
+func (r *ChromiumRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	html, err := document.RenderHTML(resumedata)
+	if err != nil {
+		return nil, err
+	}
+	saveHTML(j, attempt, html)
+
+	wsURL, stop, err := r.launch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start chromium: %w", err)
+	}
+	defer stop()
+	j.Log().Info().Msgf("Will have chromium at %s print %d bytes of html for attempt %d", wsURL, len(html), attempt)
+	return printToPDF(ctx, wsURL, html, j.PrintOptions)
+}
+
+// launchChromium starts a headless chromium on a port of its choosing, and waits for it to say where its devtools are.
+func (r *ChromiumRenderer) launchChromium(ctx context.Context) (string, func(), error) {
+	userDataDir, err := os.MkdirTemp("", "pdfinspector-chromium-")
+	if err != nil {
+		return "", nil, err
+	}
+	cmd := exec.CommandContext(ctx, r.Path,
+		"--headless=new",
+		"--disable-gpu",
+		"--no-sandbox", //we're usually root in a container, where chromium won't start with the sandbox
+		"--no-first-run",
+		"--remote-debugging-port=0",
+		"--user-data-dir="+userDataDir,
+		"about:blank",
+	)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		os.RemoveAll(userDataDir)
+		return "", nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		os.RemoveAll(userDataDir)
+		return "", nil, err
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(userDataDir)
+	}
+
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "DevTools listening on ") {
+				found <- strings.TrimPrefix(line, "DevTools listening on ")
+				break
+			}
+		}
+		close(found)
+		//chromium blocks if nobody reads what it writes
+		io.Copy(io.Discard, stderr)
+	}()
+
+	select {
+	case wsURL, ok := <-found:
+		if !ok {
+			stop()
+			return "", nil, errors.New("chromium exited without saying where its devtools are")
+		}
+		return wsURL, stop, nil
+	case <-time.After(r.LaunchTimeout):
+		stop()
+		return "", nil, fmt.Errorf("chromium didn't start within %s", r.LaunchTimeout)
+	case <-ctx.Done():
+		stop()
+		return "", nil, ctx.Err()
+	}
+}
+
+// printToPDF opens a tab on the browser at wsURL, loads the html into it and prints it.
+func printToPDF(ctx context.Context, wsURL string, html []byte, print job.PrintOptions) ([]byte, error) {
+	conn, err := dialCDP(ctx, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var target struct {
+		TargetId string `json:"targetId"`
+	}
+	err = conn.call("", "Target.createTarget", map[string]interface{}{"url": "about:blank"}, &target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.call("", "Target.closeTarget", map[string]interface{}{"targetId": target.TargetId}, nil)
+	var session struct {
+		SessionId string `json:"sessionId"`
+	}
+	err = conn.call("", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetId, "flatten": true}, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.call(session.SessionId, "Page.enable", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	//a data url rather than Page.setDocumentContent, so there's a load event to wait for
+	dataURL := "data:text/html;base64," + base64.StdEncoding.EncodeToString(html)
+	err = conn.call(session.SessionId, "Page.navigate", map[string]interface{}{"url": dataURL}, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.waitFor(session.SessionId, "Page.loadEventFired")
+	if err != nil {
+		return nil, err
+	}
+
+	var printed struct {
+		Data string `json:"data"`
+	}
+	err = conn.call(session.SessionId, "Page.printToPDF", cdpPrintParams(print), &printed)
+	if err != nil {
+		return nil, err
+	}
+	pdf, err := base64.StdEncoding.DecodeString(printed.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PDF from chromium: %v", err)
+	}
+	return pdf, nil
+}
+
+// cdpConn is just enough of the devtools protocol to send commands and wait for events, one at a time.
+type cdpConn struct {
+	ws     *websocket.Conn
+	nextId int
+	events []cdpMessage //that arrived while waiting on something else
+	done   chan struct{}
+}
+
+type cdpMessage struct {
+	Id        int             `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	SessionId string          `json:"sessionId,omitempty"`
+	Params    interface{}     `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func dialCDP(ctx context.Context, wsURL string) (*cdpConn, error) {
+	wsConfig, err := websocket.NewConfig(wsURL, "http://localhost/")
+	if err != nil {
+		return nil, err
+	}
+	ws, err := wsConfig.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to chromium devtools: %v", err)
+	}
+	//the printed PDF comes back in a single message
+	ws.MaxPayloadBytes = 64 << 20
+	conn := &cdpConn{ws: ws, done: make(chan struct{})}
+	go func() {
+		//unblocks whatever is waiting on chromium if the job gets cancelled
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-conn.done:
+		}
+	}()
+	return conn, nil
+}
+
+func (c *cdpConn) Close() error {
+	close(c.done)
+	return c.ws.Close()
+}
+
+// call sends a command and waits for its result, which is decoded into result if that isn't nil.
+func (c *cdpConn) call(sessionId string, method string, params interface{}, result interface{}) error {
+	c.nextId++
+	id := c.nextId
+	err := websocket.JSON.Send(c.ws, cdpMessage{Id: id, Method: method, SessionId: sessionId, Params: params})
+	if err != nil {
+		return fmt.Errorf("failed to send %s to chromium: %v", method, err)
+	}
+	for {
+		var message cdpMessage
+		err = websocket.JSON.Receive(c.ws, &message)
+		if err != nil {
+			return fmt.Errorf("failed to get %s result from chromium: %v", method, err)
+		}
+		if message.Id != id {
+			if message.Method != "" {
+				c.events = append(c.events, message)
+			}
+			continue
+		}
+		if message.Error != nil {
+			return fmt.Errorf("chromium couldn't %s: %s (%d)", method, message.Error.Message, message.Error.Code)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(message.Result, result)
+	}
+}
+
+// waitFor waits for an event, which might have already turned up while waiting on a call.
+func (c *cdpConn) waitFor(sessionId string, method string) error {
+	for i, event := range c.events {
+		if event.Method == method && event.SessionId == sessionId {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			return nil
+		}
+	}
+	for {
+		var message cdpMessage
+		err := websocket.JSON.Receive(c.ws, &message)
+		if err != nil {
+			return fmt.Errorf("failed waiting for %s from chromium: %v", method, err)
+		}
+		if message.Method == method && message.SessionId == sessionId {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeChromium answers the devtools commands the renderer sends, like a browser would.
+func fakeChromium(t *testing.T, navigated *string) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		for {
+			var message struct {
+				Id        int                    `json:"id"`
+				Method    string                 `json:"method"`
+				SessionId string                 `json:"sessionId"`
+				Params    map[string]interface{} `json:"params"`
+			}
+			if websocket.JSON.Receive(ws, &message) != nil {
+				return
+			}
+			result := map[string]interface{}{}
+			switch message.Method {
+			case "Target.createTarget":
+				result["targetId"] = "target1"
+			case "Target.attachToTarget":
+				assert.Equal(t, "target1", message.Params["targetId"])
+				result["sessionId"] = "session1"
+			case "Page.navigate":
+				assert.Equal(t, "session1", message.SessionId)
+				*navigated, _ = message.Params["url"].(string)
+				//the load event can turn up before the navigate result
+				websocket.JSON.Send(ws, map[string]interface{}{"method": "Page.loadEventFired", "sessionId": "session1", "params": map[string]interface{}{}})
+				result["frameId"] = "frame1"
+			case "Page.printToPDF":
+				assert.Equal(t, true, message.Params["printBackground"])
+				assert.Equal(t, 8.5, message.Params["paperWidth"], "letter unless the job says otherwise")
+				assert.Equal(t, 0.39, message.Params["marginTop"])
+				result["data"] = base64.StdEncoding.EncodeToString([]byte("%PDF-1.4 printed"))
+			case "Page.unknown":
+				websocket.JSON.Send(ws, map[string]interface{}{"id": message.Id, "error": map[string]interface{}{"code": -32601, "message": "not found"}})
+				continue
+			}
+			data, _ := json.Marshal(map[string]interface{}{"id": message.Id, "sessionId": message.SessionId, "result": result})
+			websocket.Message.Send(ws, string(data))
+		}
+	}))
+}
+
+func TestChromiumRendererPrintsOverCDP(t *testing.T) {
+	var navigated string
+	server := fakeChromium(t, &navigated)
+	defer server.Close()
+	stopped := false
+	renderer := NewChromiumRenderer("chromium")
+	renderer.launch = func(ctx context.Context) (string, func(), error) {
+		return "ws" + strings.TrimPrefix(server.URL, "http"), func() { stopped = true }, nil
+	}
+
+	pdf, err := renderer.Render(context.Background(), renderTestJob(t), 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 printed", string(pdf))
+	assert.True(t, stopped, "the browser doesn't outlive the render")
+	if assert.True(t, strings.HasPrefix(navigated, "data:text/html;base64,")) {
+		html, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(navigated, "data:text/html;base64,"))
+		assert.Contains(t, string(html), "made things")
+	}
+}
+
+func TestCDPErrors(t *testing.T) {
+	var navigated string
+	server := fakeChromium(t, &navigated)
+	defer server.Close()
+	conn, err := dialCDP(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	err = conn.call("session1", "Page.unknown", nil, nil)
+	assert.ErrorContains(t, err, "not found")
+}
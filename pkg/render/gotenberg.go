@@ -0,0 +1,289 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/document"
+	"pdfinspector/pkg/filesystem"
+	"pdfinspector/pkg/job"
+	"strings"
+)
+
+// GotenbergHTMLRenderer renders the resumedata to HTML itself (see the document package) and has gotenberg turn that
+// into the PDF. There's no react app or json server involved, so no tokens to pass along for them and no waiting for
+// the page to finish loading.
+type GotenbergHTMLRenderer struct {
+	GotenbergURL string
+
+	client func(ctx context.Context, audience string) (*http.Client, error) //swappable for tests
+}
+
+func NewGotenbergHTMLRenderer(gotenbergURL string) *GotenbergHTMLRenderer {
+	return &GotenbergHTMLRenderer{
+		GotenbergURL: gotenbergURL,
+		client:       NewAuthenticatedClient,
+	}
+}
+
+func (r *GotenbergHTMLRenderer) Name() string {
+	return "gotenberg-html"
+}
+
+func (r *GotenbergHTMLRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	html, err := document.RenderHTML(resumedata)
+	if err != nil {
+		return nil, err
+	}
+	saveHTML(j, attempt, html)
+
+	req, err := newGotenbergHTMLRequest(ctx, r.GotenbergURL, html, j.PrintOptions)
+	if err != nil {
+		return nil, err
+	}
+	j.Log().Info().Msgf("Will ask gotenberg at %s to render %d bytes of html for attempt %d", req.URL, len(html), attempt)
+	return sendGotenbergRequest(ctx, r.client, r.GotenbergURL, req)
+}
+
+// newGotenbergHTMLRequest is a request for gotenbergs html route, which wants the page as a file called index.html.
+func newGotenbergHTMLRequest(ctx context.Context, gotenbergURL string, html []byte, print job.PrintOptions) (*http.Request, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	file, err := writer.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index.html form file: %v", err)
+	}
+	_, err = file.Write(html)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to form file: %v", err)
+	}
+	err = writePrintFields(writer, print)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/forms/chromium/convert/html", gotenbergURL), &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
+// writePrintFields adds the form fields for the jobs print options (paper size, margins etc).
+func writePrintFields(writer *multipart.Writer, print job.PrintOptions) error {
+	for _, field := range gotenbergPrintFields(print) {
+		err := writer.WriteField(field[0], field[1])
+		if err != nil {
+			return fmt.Errorf("failed to create %s form field: %v", field[0], err)
+		}
+	}
+	return nil
+}
+
+// GotenbergURLRenderer has gotenberg load the react app, which fetches the resumedata from the json server. So the
+// resumedata first has to go where the json server can get it: gcs, or a local dir for a json server running locally.
+type GotenbergURLRenderer struct {
+	GotenbergURL  string
+	ReactAppURL   string
+	JsonServerURL string
+	Fs            filesystem.FileSystem //the json server reads from gcs when this is gcs, otherwise from LocalJSONDir
+	FsType        string
+	LocalJSONDir  string
+
+	client  func(ctx context.Context, audience string) (*http.Client, error) //swappable for tests
+	idToken func(ctx context.Context, audience string) (string, error)
+}
+
+func NewGotenbergURLRenderer(gotenbergURL, reactAppURL, jsonServerURL string, fs filesystem.FileSystem, fsType string) *GotenbergURLRenderer {
+	return &GotenbergURLRenderer{
+		GotenbergURL:  gotenbergURL,
+		ReactAppURL:   reactAppURL,
+		JsonServerURL: jsonServerURL,
+		Fs:            fs,
+		FsType:        fsType,
+		LocalJSONDir:  "../ResumeData/resumedata/",
+		client:        NewAuthenticatedClient,
+		idToken:       getIDToken,
+	}
+}
+
+func (r *GotenbergURLRenderer) Name() string {
+	return "gotenberg-url"
+}
+
+func (r *GotenbergURLRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	err := r.publishResumedata(j, attempt, resumedata)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Create a new buffer and a multipart writer
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	// Step 2: Add the "url" field to the multipart form
+	urlField, err := writer.CreateFormField("url")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create url form field: %v", err)
+	}
+
+	var urlToRender string
+	if r.FsType == "gcs" {
+		//for server mode with gcs data we need to make sure we pass jsonserver with a hostname value (no https:// prefix), and make sure that the uuid and a slash (uri escaped) get prepended to the attemptN value.
+		jsonServerHostname, err := extractHostname(r.JsonServerURL)
+		if err != nil {
+			return nil, err
+		}
+
+		//note: json server will expect gcp auth token for react server, because react server needs to receive it to load the page, and b/c its headless chrome its going to forward _that_ token to js fetch requests (you can't even override it if you wanted to due to how chrome treats bearer tokens)
+		jsonPathFragment := url.PathEscape(fmt.Sprintf("%s/attempt%d", j.Id, attempt))
+		urlToRender = fmt.Sprintf("%s/?jsonserver=%s&resumedata=%s&layout=%s", r.ReactAppURL, jsonServerHostname, jsonPathFragment, j.Layout)
+	} else {
+		//legacy way, presumably json server is on local host or smth.
+		urlToRender = fmt.Sprintf("%s/?resumedata=attempt%d&layout=%s", r.ReactAppURL, attempt, j.Layout)
+	}
+	_, err = io.WriteString(urlField, urlToRender)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to form field: %v", err)
+	}
+
+	// add a waitForExpression since i got a pdf that just had "Loading..." in it ... bad.
+	waitForExpressionField, err := writer.CreateFormField("waitForExpression")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form field: %v", err)
+	}
+	_, err = io.WriteString(waitForExpressionField, "window.contentLoaded === true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to form field: %v", err)
+	}
+
+	extraHttpHeaders, err := r.getExtraHttpHeadersForGotenbergRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain tokens for react server: %v", err)
+	}
+	err = writer.WriteField("extraHttpHeaders", extraHttpHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create extraHttpHeaders form field: %v", err)
+	}
+	err = writePrintFields(writer, j.PrintOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the multipart writer to finalize the form data
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %v", err)
+	}
+
+	// Step 4: Create a new POST request with the multipart form data
+	gotenbergRequestURL := fmt.Sprintf("%s/forms/chromium/convert/url", r.GotenbergURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", gotenbergRequestURL, &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %v", err)
+	}
+
+	// Step 5: Set the Content-Type header
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	j.Log().Info().Msgf("Will ask gotenberg at %s to render page at %s", gotenbergRequestURL, urlToRender)
+	return sendGotenbergRequest(ctx, r.client, r.GotenbergURL, req)
+}
+
+// publishResumedata puts the resumedata where the json server can read it.
+func (r *GotenbergURLRenderer) publishResumedata(j *job.Job, attempt int, resumedata []byte) error {
+	//TODO !!!!!!!! dont do this!!!!!! not like this!!!!
+	if r.FsType == "gcs" {
+		outputFilePath := fmt.Sprintf("%s/attempt%d.json", j.OutputDir, attempt)
+		j.Log().Info().Msgf("publishing resumedata for the json server to GCS bucket, path: %s", outputFilePath)
+		err := r.Fs.WriteFile(outputFilePath, resumedata)
+		if err != nil {
+			return fmt.Errorf("error writing resumedata for the json server: %w", err)
+		}
+		return nil
+	}
+	// this is/was just a cheesy way to get the attempted resume updated json available to the react project via a local json server service.
+	outputFilePath := filepath.Join(r.LocalJSONDir, fmt.Sprintf("attempt%d.json", attempt))
+	err := os.WriteFile(outputFilePath, resumedata, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing resumedata for the json server: %w", err)
+	}
+	j.Log().Info().Msgf("resumedata for the json server written to: %s", outputFilePath)
+	return nil
+}
+
+func (r *GotenbergURLRenderer) getExtraHttpHeadersForGotenbergRequest(ctx context.Context) (string, error) {
+	//due to GCP internals and not wanting these services wide open to the public internet we have to pass some tokens along.
+	//we need to prepare them here because we can't make gotenberg figure this out.
+
+	// Step 1: Obtain the ID token for the React service
+	reactIDToken, err := r.idToken(ctx, r.ReactAppURL)
+	if err != nil {
+		return "", fmt.Errorf("Error obtaining ID token for React service: %v", err)
+	}
+
+	// Step 2: Prepare the extra HTTP headers as a JSON string
+	extraHeaders := map[string]string{
+		"Authorization": "Bearer " + reactIDToken, //note, due to how chrome works, this will also be the token that gets forwarded to json server in js fetch request, there is no way to change it.
+	}
+	extraHeadersJSON, err := json.Marshal(extraHeaders)
+	if err != nil {
+		return "", fmt.Errorf("Error marshalling extra headers: %v", err)
+	}
+	return string(extraHeadersJSON), nil
+}
+
+func extractHostname(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	// Extract the hostname without protocol and trailing slash
+	hostname := strings.TrimSuffix(parsedURL.Host, "/")
+	return hostname, nil
+}
+
+// sendGotenbergRequest sends a request to gotenberg, whichever route it's for, and returns the PDF that comes back.
+// A 503 is a GotenbergHTTPError, which is worth trying again, see RetryingRenderer.
+func sendGotenbergRequest(ctx context.Context, newClient func(ctx context.Context, audience string) (*http.Client, error), gotenbergURL string, req *http.Request) ([]byte, error) {
+	client, err := newClient(ctx, gotenbergURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authenticated client: %v", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Trace().Msgf("failed to send HTTP request: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			return nil, &GotenbergHTTPError{
+				HttpResponseCode: resp.StatusCode,
+				HttpError:        true,
+				Message:          "Gotenberg gave retryable http error code",
+			}
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	pdf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF from response: %v", err)
+	}
+	return pdf, nil
+}
@@ -0,0 +1,149 @@
+package render
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"testing"
+)
+
+const testResumedata = `{
+	"layout": "chrono",
+	"personal_info": {"name": "Sam", "email": "sam@example.com", "phone": "555", "linkedin": null, "location": "Here", "github": null},
+	"skills": ["go"],
+	"work_history": [{"company": "Acme", "tag": "acme", "location": "Here", "jobtitle": "Gopher", "daterange": "2020 - now",
+		"projects": [{"desc": "made things", "github": null, "location": "Here"}]}],
+	"education_v2": [{"institution": "School", "location": null, "description": "BSc", "graduated": "2019", "notes": null}]
+}`
+
+func renderTestJob(t *testing.T) *job.Job {
+	jobId := "job1"
+	j := &job.Job{}
+	j.PrepareDefault(&jobId)
+	j.Layout = "chrono"
+	j.OutputDir = t.TempDir()
+	return j
+}
+
+func plainClient(ctx context.Context, audience string) (*http.Client, error) {
+	return http.DefaultClient, nil
+}
+
+func TestGotenbergHTMLRendererSendsTheHTMLAsIndexHTML(t *testing.T) {
+	var route string
+	var sent []byte
+	var fields map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = r.URL.Path
+		if assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+			fields = r.MultipartForm.Value
+			if assert.Len(t, r.MultipartForm.File["files"], 1) {
+				header := r.MultipartForm.File["files"][0]
+				assert.Equal(t, "index.html", header.Filename, "gotenberg wants the page to be called index.html")
+				file, _ := header.Open()
+				sent, _ = io.ReadAll(file)
+			}
+		}
+		w.Write([]byte("%PDF-1.4 rendered"))
+	}))
+	defer server.Close()
+	renderer := NewGotenbergHTMLRenderer(server.URL)
+	renderer.client = plainClient
+	j := renderTestJob(t)
+
+	pdf, err := renderer.Render(context.Background(), j, 2, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 rendered", string(pdf))
+	assert.Equal(t, "/forms/chromium/convert/html", route)
+	assert.Empty(t, fields, "no url, waitForExpression or extraHttpHeaders, there's nothing to load")
+	assert.Contains(t, string(sent), "made things")
+	saved, err := os.ReadFile(filepath.Join(j.OutputDir, "attempt2.html"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, sent, saved)
+	}
+}
+
+func TestGotenbergRendererErrors(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	renderer := NewGotenbergHTMLRenderer(server.URL)
+	renderer.client = plainClient
+
+	_, err := renderer.Render(context.Background(), renderTestJob(t), 0, []byte(testResumedata))
+	var httpErr *GotenbergHTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.StatusServiceUnavailable, httpErr.HttpResponseCode)
+	}
+	assert.True(t, IsRetryable(err))
+
+	status = http.StatusBadRequest
+	_, err = renderer.Render(context.Background(), renderTestJob(t), 0, []byte(testResumedata))
+	assert.Error(t, err)
+	assert.False(t, IsRetryable(err))
+
+	_, err = renderer.Render(context.Background(), renderTestJob(t), 0, []byte(`{"layout": "fancy"}`))
+	assert.Error(t, err, "resumedata that can't be rendered doesn't get as far as gotenberg")
+}
+
+func TestGotenbergURLRendererPublishesForTheJSONServer(t *testing.T) {
+	var fields map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/forms/chromium/convert/url", r.URL.Path)
+		if assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+			fields = r.MultipartForm.Value
+		}
+		w.Write([]byte("%PDF-1.4 rendered"))
+	}))
+	defer server.Close()
+	renderer := NewGotenbergURLRenderer(server.URL, "http://react:3000", "http://json:3002", nil, "local")
+	renderer.LocalJSONDir = t.TempDir()
+	renderer.client = plainClient
+	renderer.idToken = func(ctx context.Context, audience string) (string, error) {
+		return "token-for-" + audience, nil
+	}
+	j := renderTestJob(t)
+
+	_, err := renderer.Render(context.Background(), j, 1, []byte(testResumedata))
+	assert.NoError(t, err)
+	published, err := os.ReadFile(filepath.Join(renderer.LocalJSONDir, "attempt1.json"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, testResumedata, string(published))
+	}
+	assert.Equal(t, []string{"http://react:3000/?resumedata=attempt1&layout=chrono"}, fields["url"])
+	assert.Equal(t, []string{"window.contentLoaded === true"}, fields["waitForExpression"])
+	assert.Equal(t, []string{`{"Authorization":"Bearer token-for-http://react:3000"}`}, fields["extraHttpHeaders"])
+}
+
+func TestGotenbergHTMLRendererSendsPrintOptions(t *testing.T) {
+	var fields map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+			fields = r.MultipartForm.Value
+		}
+		w.Write([]byte("%PDF-1.4 rendered"))
+	}))
+	defer server.Close()
+	renderer := NewGotenbergHTMLRenderer(server.URL)
+	renderer.client = plainClient
+	j := renderTestJob(t)
+	margin := 0.5
+	j.PrintOptions = job.PrintOptions{PaperSize: "a4", MarginTop: &margin, Scale: 0.9, PreferCSSPageSize: true}
+
+	_, err := renderer.Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"paperWidth":        {"8.27"},
+		"paperHeight":       {"11.7"},
+		"marginTop":         {"0.5"},
+		"scale":             {"0.9"},
+		"preferCssPageSize": {"true"},
+	}, fields, "only what was set, the rest is left to gotenberg")
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"pdfinspector/pkg/job"
+	"strconv"
+)
+
+// gotenbergPrintFields are the form fields for whichever of the print options are set, always in the same order.
+// Sizes are in inches, which is what gotenberg assumes when there's no unit.
+func gotenbergPrintFields(p job.PrintOptions) [][2]string {
+	inches := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	var fields [][2]string
+	if p.PaperSize != "" {
+		paper := p.Paper()
+		fields = append(fields, [2]string{"paperWidth", inches(paper.Width)}, [2]string{"paperHeight", inches(paper.Height)})
+	}
+	for _, margin := range []struct {
+		name  string
+		value *float64
+	}{{"marginTop", p.MarginTop}, {"marginBottom", p.MarginBottom}, {"marginLeft", p.MarginLeft}, {"marginRight", p.MarginRight}} {
+		if margin.value != nil {
+			fields = append(fields, [2]string{margin.name, inches(*margin.value)})
+		}
+	}
+	if p.Scale != 0 {
+		fields = append(fields, [2]string{"scale", inches(p.Scale)})
+	}
+	if p.PreferCSSPageSize {
+		fields = append(fields, [2]string{"preferCssPageSize", "true"})
+	}
+	return fields
+}
+
+// cdpPrintParams is the params for chromiums Page.printToPDF. It has its own defaults, so everything gets sent.
+func cdpPrintParams(p job.PrintOptions) map[string]interface{} {
+	paper := p.Paper()
+	top, right, bottom, left := p.Margins()
+	scale := p.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return map[string]interface{}{
+		"printBackground":   true,
+		"paperWidth":        paper.Width,
+		"paperHeight":       paper.Height,
+		"marginTop":         top,
+		"marginBottom":      bottom,
+		"marginLeft":        left,
+		"marginRight":       right,
+		"scale":             scale,
+		"preferCSSPageSize": p.PreferCSSPageSize,
+	}
+}
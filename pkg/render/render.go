@@ -0,0 +1,73 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"net/http"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+)
+
+// Renderer turns resumedata into a PDF. Which one a server uses is picked with RENDERER in the service config.
+type Renderer interface {
+	// Render makes the PDF for an attempt of a job. The resumedata is as the renderer gets it, ie with the layout
+	// (and maybe style) keys in it, see insertLayout in the tuner.
+	Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error)
+	// Name of the renderer, for logging and telling recordings apart.
+	Name() string
+}
+
+type GotenbergHTTPError struct {
+	HttpResponseCode int
+	HttpError        bool
+	Message          string
+}
+
+func (e *GotenbergHTTPError) Error() string {
+	return e.Message
+}
+
+// IsRetryable is whether a render that failed with err is worth trying again as is.
+func IsRetryable(err error) bool {
+	var httpErr *GotenbergHTTPError
+	return errors.As(err, &httpErr)
+}
+
+// saveHTML keeps the html that got rendered next to the other outputs, handy for seeing why a render came out the way it did.
+func saveHTML(j *job.Job, attempt int, html []byte) {
+	err := os.MkdirAll(j.OutputDir, 0755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(j.OutputDir, fmt.Sprintf("attempt%d.html", attempt)), html, 0644)
+	}
+	if err != nil {
+		j.Log().Error().Msgf("Error writing attempt html: %v", err)
+	}
+}
+
+// NewAuthenticatedClient is an http client that sends a GCP ID token for the audience, which is what our cloud run services want.
+func NewAuthenticatedClient(ctx context.Context, audience string) (*http.Client, error) {
+	tokenSource, err := idtoken.NewTokenSource(ctx, audience)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken.NewTokenSource: %v", err)
+	}
+	client := oauth2.NewClient(ctx, tokenSource)
+	return client, nil
+}
+
+func getIDToken(ctx context.Context, audience string) (string, error) {
+	tokenSource, err := idtoken.NewTokenSource(ctx, audience)
+	if err != nil {
+		return "", fmt.Errorf("idtoken.NewTokenSource: %v", err)
+	}
+
+	token, err := tokenSource.Token()
+	if err != nil {
+		return "", fmt.Errorf("tokenSource.Token: %v", err)
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"context"
+	"pdfinspector/pkg/job"
+	"time"
+)
+
+// RetryingRenderer wraps another Renderer and tries again (after a pause) when it fails in a way that's worth
+// another go, see IsRetryable. Gotenberg gives a 503 when it's busy, for example.
+type RetryingRenderer struct {
+	Renderer   Renderer
+	MaxRetries int
+	Delay      time.Duration
+
+	sleep func(ctx context.Context, d time.Duration) error //swappable for tests
+}
+
+func NewRetryingRenderer(renderer Renderer, maxRetries int) *RetryingRenderer {
+	return &RetryingRenderer{
+		Renderer:   renderer,
+		MaxRetries: maxRetries,
+		Delay:      1 * time.Second,
+	}
+}
+
+func (r *RetryingRenderer) Name() string {
+	return r.Renderer.Name()
+}
+
+func (r *RetryingRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		pdf, err := r.Renderer.Render(ctx, j, attempt, resumedata)
+		if err == nil {
+			return pdf, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !IsRetryable(err) || retry >= r.MaxRetries {
+			return nil, err
+		}
+		j.Log().Info().Msgf("retryable error from %s (retry %d of %d): %v", r.Name(), retry+1, r.MaxRetries, err)
+		if err := r.doSleep(ctx, r.Delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *RetryingRenderer) doSleep(ctx context.Context, d time.Duration) error {
+	if r.sleep != nil {
+		return r.sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/cassette"
+	"pdfinspector/pkg/job"
+	"testing"
+	"time"
+)
+
+// flakyRenderer fails with the queued errors before it renders.
+type flakyRenderer struct {
+	errs  []error
+	calls int
+}
+
+func (r *flakyRenderer) Name() string {
+	return "flaky"
+}
+
+func (r *flakyRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	r.calls++
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return nil, err
+	}
+	return []byte("%PDF"), nil
+}
+
+func noSleep(ctx context.Context, d time.Duration) error {
+	return nil
+}
+
+func TestRetryingRendererRetriesGotenbergBeingBusy(t *testing.T) {
+	busy := &GotenbergHTTPError{HttpResponseCode: 503}
+	flaky := &flakyRenderer{errs: []error{busy, busy}}
+	renderer := NewRetryingRenderer(flaky, 2)
+	renderer.sleep = noSleep
+
+	pdf, err := renderer.Render(context.Background(), renderTestJob(t), 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF", string(pdf))
+	assert.Equal(t, 3, flaky.calls)
+
+	flaky = &flakyRenderer{errs: []error{busy, busy, busy}}
+	renderer.Renderer = flaky
+	_, err = renderer.Render(context.Background(), renderTestJob(t), 0, nil)
+	assert.ErrorAs(t, err, &busy, "gives up once the retries are used up")
+	assert.Equal(t, 3, flaky.calls)
+}
+
+func TestRetryingRendererDoesntRetryOtherErrors(t *testing.T) {
+	flaky := &flakyRenderer{errs: []error{errors.New("bad resumedata")}}
+	renderer := NewRetryingRenderer(flaky, 2)
+	renderer.sleep = noSleep
+
+	_, err := renderer.Render(context.Background(), renderTestJob(t), 0, nil)
+	assert.EqualError(t, err, "bad resumedata")
+	assert.Equal(t, 1, flaky.calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flaky = &flakyRenderer{errs: []error{&GotenbergHTTPError{HttpResponseCode: 503}}}
+	renderer.Renderer = flaky
+	_, err = renderer.Render(ctx, renderTestJob(t), 0, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestCassetteRendererReplaysWithoutRendering(t *testing.T) {
+	dir := t.TempDir()
+	recording, err := cassette.New(dir, cassette.ModeRecord, cassette.MatchRequest)
+	assert.NoError(t, err)
+	j := renderTestJob(t)
+	_, err = NewCassetteRenderer(NewStubRenderer(), recording).Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+
+	replaying, err := cassette.New(dir, cassette.ModeReplay, cassette.MatchRequest)
+	assert.NoError(t, err)
+	flaky := &flakyRenderer{}
+	renderer := &CassetteRenderer{Renderer: NewStubRenderer(), Cassette: replaying}
+	pdf, err := renderer.Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Contains(t, string(pdf), "(Sam) Tj")
+
+	renderer.Renderer = flaky
+	_, err = renderer.Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.Error(t, err, "a different renderer doesn't get the stubs recording")
+	assert.Equal(t, 0, flaky.calls)
+}
+
+func TestCassetteKeyIsPerRenderer(t *testing.T) {
+	j := renderTestJob(t)
+	html, err := cassetteKey(j, NewGotenbergHTMLRenderer("http://gotenberg").Name(), []byte(testResumedata))
+	assert.NoError(t, err)
+	expected, err := cassette.Key(map[string]interface{}{"layout": j.Layout, "resumedata": testResumedata, "renderer": "gotenberg-html"})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, html)
+
+	url, err := cassetteKey(j, "gotenberg-url", []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.NotEqual(t, html, url)
+}
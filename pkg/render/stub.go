@@ -0,0 +1,116 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"pdfinspector/pkg/document"
+	"pdfinspector/pkg/job"
+	"strings"
+)
+
+// StubRenderer makes a PDF without rendering anything, for tests and for trying things out without gotenberg or a
+// browser around. The same resumedata always gets the same PDF: Pages pages, each with the name, layout and a hash of
+// the resumedata written on it.
+type StubRenderer struct {
+	Pages int
+}
+
+func NewStubRenderer() *StubRenderer {
+	return &StubRenderer{Pages: 1}
+}
+
+func (r *StubRenderer) Name() string {
+	return "stub"
+}
+
+func (r *StubRenderer) Render(ctx context.Context, j *job.Job, attempt int, resumedata []byte) ([]byte, error) {
+	doc, err := document.Decode(resumedata)
+	if err != nil {
+		return nil, err
+	}
+	var name string
+	switch {
+	case doc.Chrono != nil:
+		name = doc.Chrono.PersonalInfo.Name
+	case doc.Functional != nil:
+		name = doc.Functional.PersonalInfo.Name
+	case doc.CoverLetter != nil:
+		name = doc.CoverLetter.PersonalInfo.Name
+	}
+	hash := sha256.Sum256(resumedata)
+	lines := []string{name, fmt.Sprintf("%s %s", doc.Layout, hex.EncodeToString(hash[:8]))}
+	pages := r.Pages
+	if pages < 1 {
+		pages = 1
+	}
+	paper := j.PrintOptions.Paper()
+	return stubPDF(pages, paper, lines), nil
+}
+
+// stubPDF is the smallest PDF that ghostscript and friends are happy with: pages of the paper size with a few lines
+// of Helvetica at the top of each.
+func stubPDF(pages int, paper job.PaperDimensions, lines []string) []byte {
+	//pdf sizes are in points, 72 to the inch
+	points := func(inches float64) float64 {
+		return math.Round(inches*72*100) / 100
+	}
+	width, height := points(paper.Width), points(paper.Height)
+	var objects []string
+	//1 is the catalog, 2 the page tree, 3 the font, then a page and its content for each page
+	kids := make([]string, pages)
+	for p := 0; p < pages; p++ {
+		kids[p] = fmt.Sprintf("%d 0 R", 4+2*p)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for p := 0; p < pages; p++ {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 12 Tf 72 %g Td 14 TL\n", height-72)
+		for _, line := range append(lines, fmt.Sprintf("page %d of %d", p+1, pages)) {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", escapePDFString(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", width, height, 5+2*p),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// escapePDFString makes text safe to go in a PDF (literal) string. Anything outside of ascii is dropped, Helvetica
+// wouldn't have it anyway.
+func escapePDFString(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r >= 32 && r < 127:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
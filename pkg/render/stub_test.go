@@ -0,0 +1,44 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStubRendererIsDeterministic(t *testing.T) {
+	renderer := NewStubRenderer()
+	j := renderTestJob(t)
+
+	pdf, err := renderer.Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	again, err := renderer.Render(context.Background(), j, 3, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Equal(t, pdf, again, "same resumedata, same PDF")
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "(Sam) Tj")
+
+	other, err := renderer.Render(context.Background(), j, 0, []byte(`{"layout": "coverletter", "personal_info": {"name": "Al (the pal)"}}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, pdf, other)
+	assert.Contains(t, string(other), `(Al \(the pal\)) Tj`)
+
+	renderer.Pages = 2
+	twoPages, err := renderer.Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Contains(t, string(twoPages), "/Count 2")
+}
+
+func TestStubRendererUsesThePaperSize(t *testing.T) {
+	j := renderTestJob(t)
+	pdf, err := NewStubRenderer().Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Contains(t, string(pdf), "/MediaBox [0 0 612 792]")
+
+	j.PrintOptions.PaperSize = "a4"
+	pdf, err = NewStubRenderer().Render(context.Background(), j, 0, []byte(testResumedata))
+	assert.NoError(t, err)
+	assert.Contains(t, string(pdf), "/MediaBox [0 0 595.44 842.4]")
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"cloud.google.com/go/storage"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	"io"
+	"net/http"
+	"pdfinspector/pkg/filesystem"
+	"pdfinspector/pkg/job"
+	"sort"
+)
+
+// variantReport is the rolled up outcome of all the jobs that ran with one variant of a prompt experiment.
+type variantReport struct {
+	Variant              string   `json:"variant"`
+	PromptVersions       []string `json:"prompt_versions"` //more than one means the set was edited part way through
+	Jobs                 int      `json:"jobs"`
+	Errors               int      `json:"errors"`
+	Converged            int      `json:"converged"`
+	ConvergedRate        float64  `json:"converged_rate"`
+	MeanAttempts         float64  `json:"mean_attempts"`
+	MeanLastPageRatio    float64  `json:"mean_last_page_content_ratio"`
+	MeanPages            float64  `json:"mean_pages"`
+	TotalTokens          int      `json:"total_tokens"`
+	MeanTokens           float64  `json:"mean_tokens"`
+	TotalEstimatedCost   float64  `json:"total_estimated_cost_usd"`
+	MeanEstimatedCostUSD float64  `json:"mean_estimated_cost_usd"`
+}
+
+type experimentReport struct {
+	Experiment string          `json:"experiment"`
+	Variants   []variantReport `json:"variants"`
+}
+
+// summarizeExperiment aggregates outcomes per variant. The page and ratio means only count jobs that got something rendered.
+func summarizeExperiment(experiment string, outcomes []job.ExperimentOutcome) experimentReport {
+	byVariant := map[string]*variantReport{}
+	versions := map[string]map[string]bool{}
+	rendered := map[string]int{}
+	for _, outcome := range outcomes {
+		report, ok := byVariant[outcome.Variant]
+		if !ok {
+			report = &variantReport{Variant: outcome.Variant}
+			byVariant[outcome.Variant] = report
+			versions[outcome.Variant] = map[string]bool{}
+		}
+		if !versions[outcome.Variant][outcome.PromptVersion] {
+			versions[outcome.Variant][outcome.PromptVersion] = true
+			report.PromptVersions = append(report.PromptVersions, outcome.PromptVersion)
+		}
+		report.Jobs++
+		if outcome.Error != "" {
+			report.Errors++
+		}
+		if outcome.Converged {
+			report.Converged++
+		}
+		report.MeanAttempts += float64(outcome.Attempts)
+		if outcome.NumberOfPages > 0 {
+			rendered[outcome.Variant]++
+			report.MeanPages += float64(outcome.NumberOfPages)
+			report.MeanLastPageRatio += outcome.LastPageContentRatio
+		}
+		report.TotalTokens += outcome.TotalTokens
+		report.TotalEstimatedCost += outcome.EstimatedCostUSD
+	}
+
+	result := experimentReport{Experiment: experiment, Variants: []variantReport{}}
+	for name, report := range byVariant {
+		jobs := float64(report.Jobs)
+		report.ConvergedRate = float64(report.Converged) / jobs
+		report.MeanAttempts /= jobs
+		report.MeanTokens = float64(report.TotalTokens) / jobs
+		report.MeanEstimatedCostUSD = report.TotalEstimatedCost / jobs
+		if rendered[name] > 0 {
+			report.MeanPages /= float64(rendered[name])
+			report.MeanLastPageRatio /= float64(rendered[name])
+		}
+		sort.Strings(report.PromptVersions)
+		result.Variants = append(result.Variants, *report)
+	}
+	sort.Slice(result.Variants, func(i, j int) bool {
+		return result.Variants[i].Variant < result.Variants[j].Variant
+	})
+	return result
+}
+
+// GetExperimentReportHandler gathers up the recorded outcomes of a prompt experiment and reports on each variant. Admin only.
+func (s *pdfInspectorServer) GetExperimentReportHandler(w http.ResponseWriter, r *http.Request) {
+	if isAdmin, _ := r.Context().Value("isAdmin").(bool); !isAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	experiment := chi.URLParam(r, "experiment")
+
+	gcsFs, ok := s.jobRunner.Tuner.Fs.(*filesystem.GCSFileSystem)
+	if !ok {
+		http.Error(w, "Experiment reports need the gcs filesystem", http.StatusInternalServerError)
+		return
+	}
+	bucket := gcsFs.Client.Bucket(s.config.GcsBucket)
+	it := bucket.Objects(r.Context(), &storage.Query{Prefix: job.ExperimentOutcomesPrefix(experiment)})
+
+	var outcomes []job.ExperimentOutcome
+	for {
+		objAttr, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			log.Error().Msgf("error listing experiment outcomes: %v", err)
+			http.Error(w, "Failed to list experiment outcomes", http.StatusInternalServerError)
+			return
+		}
+		rc, err := bucket.Object(objAttr.Name).NewReader(r.Context())
+		if err != nil {
+			log.Error().Msgf("error reading experiment outcome %s: %v", objAttr.Name, err)
+			continue
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			log.Error().Msgf("error reading experiment outcome %s: %v", objAttr.Name, err)
+			continue
+		}
+		var outcome job.ExperimentOutcome
+		if err := json.Unmarshal(data, &outcome); err != nil {
+			log.Error().Msgf("error decoding experiment outcome %s: %v", objAttr.Name, err)
+			continue
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summarizeExperiment(experiment, outcomes))
+}
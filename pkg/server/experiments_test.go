@@ -0,0 +1,31 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/job"
+	"testing"
+)
+
+func TestSummarizeExperiment(t *testing.T) {
+	report := summarizeExperiment("order", []job.ExperimentOutcome{
+		{Variant: "control", PromptVersion: "default@1+aaaaaaaa", Attempts: 2, Converged: true, NumberOfPages: 1, LastPageContentRatio: 0.9, TotalTokens: 1000, EstimatedCostUSD: 0.01},
+		{Variant: "control", PromptVersion: "default@1+aaaaaaaa", Attempts: 4, NumberOfPages: 2, LastPageContentRatio: 0.5, TotalTokens: 3000, EstimatedCostUSD: 0.03},
+		{Variant: "treatment", PromptVersion: "other@1+bbbbbbbb", Attempts: 1, Error: "boom", TotalTokens: 500},
+	})
+
+	assert.Equal(t, "order", report.Experiment)
+	assert.Len(t, report.Variants, 2)
+	control := report.Variants[0]
+	assert.Equal(t, "control", control.Variant)
+	assert.Equal(t, 2, control.Jobs)
+	assert.Equal(t, 0.5, control.ConvergedRate)
+	assert.Equal(t, 3.0, control.MeanAttempts)
+	assert.InDelta(t, 0.7, control.MeanLastPageRatio, 0.0001)
+	assert.Equal(t, 1.5, control.MeanPages)
+	assert.Equal(t, 2000.0, control.MeanTokens)
+	assert.Equal(t, []string{"default@1+aaaaaaaa"}, control.PromptVersions)
+
+	treatment := report.Variants[1]
+	assert.Equal(t, 1, treatment.Errors)
+	assert.Equal(t, 0.0, treatment.MeanPages) //nothing rendered, not a divide by zero
+}
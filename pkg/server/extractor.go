@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"pdfinspector/pkg/job"
 	"pdfinspector/pkg/tuner"
+	"strconv"
 )
 
 func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +77,37 @@ func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http
 	// Get layout parameter from request
 	layout := chi.URLParam(r, "layout")
 
+	//admins can set their own budget, eg {"max_attempts": 2}, and model settings. everyone else gets the server defaults.
+	extractionJob := &tuner.ResumeExtractionJob{
+		FileContent: fileContent,
+		Layout:      layout,
+		UseSystemGs: s.config.UseSystemGs,
+		UserID:      userID,
+	}
+	isAdmin, _ := ctx.Value("isAdmin").(bool)
+	if isAdmin && r.FormValue("budget") != "" {
+		err = json.Unmarshal([]byte(r.FormValue("budget")), &extractionJob.Budget)
+		if err != nil {
+			http.Error(w, "Invalid budget", http.StatusBadRequest)
+			return
+		}
+	}
+	if isAdmin && r.FormValue("temperature") != "" {
+		temperature, err := strconv.ParseFloat(r.FormValue("temperature"), 64)
+		if err != nil {
+			http.Error(w, "Invalid temperature", http.StatusBadRequest)
+			return
+		}
+		extractionJob.Temperature = &temperature
+	}
+	if isAdmin && r.FormValue("max_tokens") != "" {
+		extractionJob.MaxTokens, err = strconv.Atoi(r.FormValue("max_tokens"))
+		if err != nil {
+			http.Error(w, "Invalid max_tokens", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Set headers for streaming response
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -83,24 +115,21 @@ func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http
 
 	updates := make(chan job.JobStatus)
 	finalResult := make(chan job.ExtractResult, 1)
+	usage := job.NewUsageSummary()
+	extractionJob.Usage = usage
 	go func() {
 		//do the actual job and send updates.
 		defer close(updates)
 		updates <- job.JobStatus{Message: "Starting resume processing"}
 
 		// Process the resume contents using the extractResumeContents method
-		extractionResult, err := s.jobRunner.Tuner.ExtractResumeContents(&tuner.ResumeExtractionJob{
-			FileContent: fileContent,
-			Layout:      layout,
-			UseSystemGs: s.config.UseSystemGs,
-			UserID:      userID,
-		}, updates)
+		extractionResult, err := s.jobRunner.Tuner.ExtractResumeContents(r.Context(), extractionJob, updates)
 		log.Trace().Msgf("got resume result: %v", extractionResult)
 		if err == nil {
 			updates <- job.JobStatus{Message: "Extracted resume data into JSON"}
 		} else {
 			log.Error().Msgf("error from extraction: %v", err)
-			finalResult <- job.ExtractResult{JobStatus: job.JobStatus{Message: err.Error(), Error: &tuner.TrueVal}}
+			finalResult <- job.ExtractResult{JobStatus: job.JobStatus{Message: err.Error(), Error: &tuner.TrueVal, BudgetExhausted: extractionJob.BudgetExhausted}}
 			return
 		}
 
@@ -111,13 +140,8 @@ func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http
 			return
 		}
 
-		err = s.validateResumeDataAgainstTemplateSchema(layout, decodedResumeData, false)
-		if err == nil {
-			updates <- job.JobStatus{Message: "ResumeData format appears to be valid"}
-		} else {
-			finalResult <- job.ExtractResult{JobStatus: job.JobStatus{Message: err.Error(), Error: &tuner.TrueVal}}
-			return
-		}
+		//the tuner only hands back extractions that match the layout schema
+		updates <- job.JobStatus{Message: "ResumeData format appears to be valid"}
 
 		candidateNameBestGuess, _ := s.jobRunner.Tuner.GuessCandidateName(decodedResumeData)
 		template := &Template{
@@ -138,27 +162,34 @@ func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http
 
 		finalResult <- job.ExtractResult{
 			JobStatus: job.JobStatus{
-				Message: "Finished successfully - saved template",
+				Message:         "Finished successfully - saved template",
+				BudgetExhausted: extractionJob.BudgetExhausted,
 			},
 			TemplateName: &template.Name,
 		}
 	}()
+	var streamBroken = false //nothing more can be sent, but the updates are still read until the extraction is done
 	for status := range updates {
 		if status.Error != nil {
 			log.Info().Msgf("Resume Data Extract Error: %s", status.Message)
 		} else {
 			log.Info().Msgf("Resume Data Extract Status Update: %s", status.Message)
 		}
+		if streamBroken {
+			continue
+		}
 
 		data, err := json.Marshal(status)
 		if err != nil {
-			http.Error(w, "Error encoding status", http.StatusInternalServerError)
-			return
+			log.Error().Msgf("Error encoding status: %v", err)
+			streamBroken = true
+			continue
 		}
 		_, err = fmt.Fprintf(w, "%s\n", data)
 		if err != nil {
 			log.Debug().Msg("Client connection lost.")
-			return
+			streamBroken = true
+			continue
 		}
 
 		// Flush the response writer to ensure the data is sent immediately
@@ -167,7 +198,20 @@ func (s *pdfInspectorServer) extractResumeHandler(w http.ResponseWriter, r *http
 		}
 	}
 
-	var resumeResult interface{} = <-finalResult
+	extractResult := <-finalResult
+	usageTotals := usage.Totals()
+	extractResult.Usage = &usageTotals
+	if userKey, _ := ctx.Value("userKey").(string); userKey != "" {
+		//the client may well have gone by now, the tokens were still spent
+		err := s.recordApiKeyUsage(context.WithoutCancel(ctx), userKey, usageTotals)
+		if err != nil {
+			log.Error().Msgf("failed to record usage for api key %s: %v", userKey, err)
+		}
+	}
+	if streamBroken {
+		return
+	}
+	var resumeResult interface{} = extractResult
 	finalData, err := json.Marshal(resumeResult)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to encode JSON response")
@@ -93,8 +93,12 @@ func (s *pdfInspectorServer) initRoutes() {
 	router.Group(func(protected chi.Router) {
 		protected.Use(s.AuthMiddleware)
 		protected.Post("/streamjob", s.streamJobHandler) // Keep the connection open while running the job and streaming updates
+		protected.Post("/canceljob/{jobId}", s.cancelJobHandler)
+		protected.Post("/resumejob/{jobId}", s.resumeJobHandler) // Carry on an interrupted job from its checkpoint, streaming like /streamjob
 		protected.Post("/extractresumedata/{layout}", s.extractResumeHandler)
 		protected.Post("/streamrender", s.streamRenderHandler)
+		protected.Get("/usage", s.GetUsageHandler)
+		protected.Get("/experiments/{experiment}/report", s.GetExperimentReportHandler)
 
 		//template CRUD
 		protected.Get("/templates", s.ListTemplatesHandler)
@@ -150,21 +154,27 @@ func (s *pdfInspectorServer) streamJobHandler(w http.ResponseWriter, r *http.Req
 		http.Error(w, "Invalid JSON input", http.StatusBadRequest)
 		return
 	}
+	//admins too, a paper size gotenberg doesn't know about just fails the job later on
+	if err := inputJob.PrintOptions.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Bad Request: invalid inputJob: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
 
 	if isAdmin, _ := r.Context().Value("isAdmin").(bool); isAdmin {
 		inputJob.PrepareDefault(inputJob.OverrideJobId)
 		inputJob.IsForAdmin = true
 	} else {
 		inputJob.PrepareDefault(nil)
-		err := inputJob.ValidateForNonAdmin()
+		err := inputJob.ValidateForNonAdmin(s.config.AllowedModels)
 		if err != nil {
 			log.Error().Msgf("invalid inputJob %v", err)
 			http.Error(w, fmt.Sprintf("Bad Request: invalid inputJob: %s", err.Error()), http.StatusBadRequest)
 			return
 		}
 		userKey, _ := r.Context().Value("userKey").(string)
-		//todo: if the inputJob fails return credit.
-		err, inputJob.UserCreditRemaining = s.deductUserCredit(r.Context(), userKey)
+		//given back below if the job fails on our side
+		inputJob.UserCreditDeducted = inputJob.CreditCost(s.config.UserCreditDeduct)
+		err, inputJob.UserCreditRemaining = s.deductUserCredit(r.Context(), userKey, inputJob.UserCreditDeducted)
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -176,32 +186,80 @@ func (s *pdfInspectorServer) streamJobHandler(w http.ResponseWriter, r *http.Req
 		log.Trace().Msgf("streamJobHandler: sso subject userId believed to be %s", inputJob.UserID)
 	}
 
+	// the job stops if the client goes away, since that cancels the request context
+	updates := s.jobRunner.RunJobStreaming(r.Context(), &inputJob)
+	s.streamJobUpdates(w, r, &inputJob, updates)
+}
+
+// resumeJobHandler carries on a job that was interrupted (eg the instance running it went away) from its last checkpoint,
+// streaming the same as streamJobHandler. Users can only resume their own jobs, admins can resume any. It's already been
+// paid for, so no credit is taken.
+func (s *pdfInspectorServer) resumeJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobId := chi.URLParam(r, "jobId")
+	isAdmin, _ := r.Context().Value("isAdmin").(bool)
+	userKey, _ := r.Context().Value("userKey").(string)
+
+	checkpoint, err := s.jobRunner.Tuner.LoadCheckpoint(r.Context(), jobId)
+	if err != nil || (!isAdmin && checkpoint.Job.UserKey != userKey) {
+		if err != nil {
+			log.Info().Msgf("no checkpoint to resume job %s from: %v", jobId, err)
+		}
+		http.Error(w, "No such job to resume", http.StatusNotFound)
+		return
+	}
+	if checkpoint.State != tuner.CHECKPOINT_RUNNING {
+		http.Error(w, fmt.Sprintf("Job is %s, only an interrupted job can be resumed", checkpoint.State), http.StatusConflict)
+		return
+	}
+	//running on this server is caught below, but it could be running on another instance too
+	if checkpoint.MayStillBeRunning(time.Now()) {
+		retryAfter := checkpoint.Updated.Add(tuner.CHECKPOINT_STALE_AFTER).Sub(time.Now())
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Job may still be running, it can be resumed once it's been quiet for a while", http.StatusConflict)
+		return
+	}
+	updates, ok := s.jobRunner.ResumeJobStreaming(r.Context(), checkpoint)
+	if !ok {
+		http.Error(w, "Job is still running", http.StatusConflict)
+		return
+	}
+	log.Info().Msgf("resuming job %s from attempt %d", jobId, checkpoint.NextAttempt)
+	s.streamJobUpdates(w, r, checkpoint.Job, updates)
+}
+
+// streamJobUpdates streams a running jobs updates to the client until it's done, then records its usage, gives back the
+// credit if it failed on our side, and finishes with the JobResult.
+func (s *pdfInspectorServer) streamJobUpdates(w http.ResponseWriter, r *http.Request, inputJob *job.Job, updates chan job.JobStatus) {
 	// Set headers for streaming response
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.WriteHeader(http.StatusOK)
 
-	// Create a channel to communicate inputJob status updates
 	// Stream status updates to the client
 	var encounteredError = false
-	for status := range s.jobRunner.RunJobStreaming(&inputJob) {
-		// Create a JobStatus struct with the status message
+	var streamBroken = false //nothing more can be sent, but the updates are still read until the job is done
+	for status := range updates {
+		if status.Error != nil {
+			encounteredError = true
+		}
+		if streamBroken {
+			continue
+		}
 
 		// Marshal the status update to JSON
 		data, err := json.Marshal(status)
 		if err != nil {
-			http.Error(w, "Error encoding status", http.StatusInternalServerError)
-			return
+			log.Error().Msgf("Error encoding status: %v", err)
+			streamBroken = true
+			continue
 		}
 
 		// Write the JSON status update to the response
-		if status.Error != nil {
-			encounteredError = true
-		}
 		_, err = fmt.Fprintf(w, "%s\n", data)
 		if err != nil {
 			log.Debug().Msg("Client connection lost.")
-			return
+			streamBroken = true
+			continue
 		}
 
 		// Flush the response writer to ensure the data is sent immediately
@@ -210,20 +268,58 @@ func (s *pdfInspectorServer) streamJobHandler(w http.ResponseWriter, r *http.Req
 		}
 	}
 
-	var finalResult interface{}
-	if encounteredError {
+	//the client may well have gone by now (that's what cancels the request context), the usage and any refund still count
+	usageTotals := inputJob.Usage.Totals()
+	if inputJob.UserKey != "" {
+		err := s.recordApiKeyUsage(context.WithoutCancel(r.Context()), inputJob.UserKey, usageTotals)
+		if err != nil {
+			log.Error().Msgf("failed to record usage for api key %s: %v", inputJob.UserKey, err)
+		}
+	}
+
+	var refund *job.CreditRefund
+	if inputJob.ServerSideFailure != nil && inputJob.UserKey != "" && inputJob.UserCreditDeducted > 0 {
+		var err error
+		refund, err = s.refundUserCredit(context.WithoutCancel(r.Context()), inputJob.UserKey, inputJob.Id, inputJob.UserCreditDeducted, inputJob.ServerSideFailure.Error())
+		if err != nil {
+			log.Error().Msgf("failed to refund credit to api key %s for job %s: %v", inputJob.UserKey, inputJob.Id, err)
+		}
+	}
+
+	if streamBroken {
+		return
+	}
+
+	var finalResult job.JobResult
+	if inputJob.Cancelled {
+		finalResult = job.JobResult{
+			Status:  "Cancelled",
+			Details: "The inputJob was cancelled before it completed.",
+			Usage:   &usageTotals,
+		}
+	} else if encounteredError && refund != nil {
+		finalResult = job.JobResult{
+			Status:  "Failed",
+			Details: fmt.Sprintf("The inputJob failed with an error on our side, %d credit has been refunded.", refund.Amount),
+			Usage:   &usageTotals,
+			Refund:  refund,
+		}
+	} else if encounteredError {
 		// Final result after inputJob non completion
 		finalResult = job.JobResult{
 			Status:  "Failed",
 			Details: "The inputJob failed with an error.",
+			Usage:   &usageTotals,
 		}
 	} else {
 		// Final result after inputJob completion
 		finalResult = job.JobResult{
 			Status:  "Completed",
 			Details: "The inputJob was successfully completed.",
+			Usage:   &usageTotals,
 		}
 	}
+	finalResult.BudgetExhausted = inputJob.BudgetExhausted
 
 	// Marshal the final result to JSON
 	finalData, err := json.Marshal(finalResult)
@@ -248,6 +344,10 @@ func (s *pdfInspectorServer) streamRenderHandler(w http.ResponseWriter, r *http.
 		http.Error(w, "Invalid JSON input", http.StatusBadRequest)
 		return
 	}
+	if err := inputJob.PrintOptions.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Bad Request: invalid inputJob: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
 	inputJob.PrepareDefault(nil, r.Context())
 
 	// Set headers for streaming response
@@ -258,13 +358,15 @@ func (s *pdfInspectorServer) streamRenderHandler(w http.ResponseWriter, r *http.
 	// Create a channel to communicate inputJob status updates
 	// Stream status updates to the client
 	var encounteredError = false
-	for status := range s.jobRunner.RunRenderStreaming(&inputJob) {
+	updates := s.jobRunner.RunRenderStreaming(r.Context(), &inputJob)
+	for status := range updates {
 		// Create a JobStatus struct with the status message
 
 		// Marshal the status update to JSON
 		data, err := json.Marshal(status)
 		if err != nil {
 			http.Error(w, "Error encoding status", http.StatusInternalServerError)
+			drainUpdates(updates)
 			return
 		}
 
@@ -275,6 +377,7 @@ func (s *pdfInspectorServer) streamRenderHandler(w http.ResponseWriter, r *http.
 		_, err = fmt.Fprintf(w, "%s\n", data)
 		if err != nil {
 			log.Debug().Msg("Client connection lost.")
+			drainUpdates(updates)
 			return
 		}
 
@@ -315,17 +418,60 @@ func (s *pdfInspectorServer) streamRenderHandler(w http.ResponseWriter, r *http.
 	}
 }
 
+// cancelJobHandler stops a running job. Its stream (if anyone is still reading it) ends with a Cancelled result.
+func (s *pdfInspectorServer) cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobId := chi.URLParam(r, "jobId")
+	isAdmin, _ := r.Context().Value("isAdmin").(bool)
+	userKey, _ := r.Context().Value("userKey").(string)
+	if !s.jobRunner.CancelJob(jobId, userKey, isAdmin) {
+		http.Error(w, "No such running job", http.StatusNotFound)
+		return
+	}
+	log.Info().Msgf("cancelled job %s", jobId)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Job cancelled"))
+}
+
 func (s *pdfInspectorServer) legacyJobOutputHandler(w http.ResponseWriter, r *http.Request) {
 	resultPath := strings.Join([]string{"outputs", chi.URLParam(r, "genId"), "Resume.pdf"}, "/")
 	s.returnOutputFromGcs(w, r, resultPath, "Resume.pdf")
 }
 
+// jobOutputHandler sends back one of the formats the output was saved in, sent with the filename asked for. The format
+// is the format query param if there is one (?format=docx), otherwise the filenames extension, otherwise the PDF.
 func (s *pdfInspectorServer) jobOutputHandler(w http.ResponseWriter, r *http.Request) {
-	resultPath := strings.Join([]string{"outputs", chi.URLParam(r, "genId"), tuner.TUNER_DEFAULT_OUTPUT_FILENAME}, "/")
 	fileName := chi.URLParam(r, "filename")
+	format, fileName, err := outputFormatForRequest(r.URL.Query().Get("format"), fileName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resultPath := strings.Join([]string{"outputs", chi.URLParam(r, "genId"), format.Filename()}, "/")
 	s.returnOutputFromGcs(w, r, resultPath, fileName)
 }
 
+// outputFormatForRequest works out the format for jobOutputHandler, and makes sure the filename has the right
+// extension for it (so asking for Resume.pdf?format=docx gets you Resume.docx).
+func outputFormatForRequest(formatParam, fileName string) (tuner.OutputFormat, string, error) {
+	ext := filepath.Ext(fileName)
+	extFormat, extIsFormat := tuner.GetOutputFormat(strings.TrimPrefix(ext, "."))
+	if formatParam == "" {
+		if extIsFormat {
+			return extFormat, fileName, nil
+		}
+		format, _ := tuner.GetOutputFormat(tuner.OUTPUT_FORMAT_PDF)
+		return format, fileName, nil
+	}
+	format, ok := tuner.GetOutputFormat(formatParam)
+	if !ok {
+		return tuner.OutputFormat{}, "", fmt.Errorf("Unknown output format: %s", formatParam)
+	}
+	if extIsFormat {
+		fileName = strings.TrimSuffix(fileName, ext)
+	}
+	return format, fileName + "." + format.Name, nil
+}
+
 func (s *pdfInspectorServer) returnOutputFromGcs(w http.ResponseWriter, r *http.Request, resultPath, fileName string) {
 	//fileName is the filename that we should use to send it back to client with
 	//resultPath is where in GCS it actually is. (ug usually Output.pdf or for legacy was Resume.pdf before I decided to be more generic after introducing cover letter ha ha)
@@ -345,6 +491,10 @@ func (s *pdfInspectorServer) returnOutputFromGcs(w http.ResponseWriter, r *http.
 	log.Info().Msgf("Send back with filename: %s", fileName)
 	ext := filepath.Ext(fileName)
 	mimeType := mime.TypeByExtension(ext)
+	if format, ok := tuner.GetOutputFormat(strings.TrimPrefix(ext, ".")); ok {
+		//docx etc aren't in go's builtin list, and what's in the systems list varies
+		mimeType = format.MimeType
+	}
 
 	// Fallback to application/octet-stream if we can't determine the MIME type
 	if mimeType == "" {
@@ -370,7 +520,10 @@ func (s *pdfInspectorServer) returnOutputFromGcs(w http.ResponseWriter, r *http.
 	}
 }
 
-func (s *pdfInspectorServer) deductUserCredit(ctx context.Context, userKey string) (error, int) {
+// MAX_REFUND_TRIES is how many times a refund is attempted when the credit file keeps changing underneath it.
+const MAX_REFUND_TRIES = 3
+
+func (s *pdfInspectorServer) deductUserCredit(ctx context.Context, userKey string, deductionAmount int) (error, int) {
 	//this is really just a best effort to create some kind of locking mechanism with gcs in the absence of anything stateful
 	//because i dont want to pay for a "real" solution (eg hosted database record locking or smth)
 
@@ -412,14 +565,13 @@ func (s *pdfInspectorServer) deductUserCredit(ctx context.Context, userKey strin
 	}
 	//
 	log.Info().Msgf("user %s has %d credit", userKey, currentCredit)
-	deductionAmount := s.config.UserCreditDeduct
 	// Step 3: Check if the user has enough credit
 	if currentCredit-deductionAmount < 0 {
 		// Deny the request if doing so would put us into negative balance
 		return fmt.Errorf("insufficient credit, request denied"), 0
 	}
 
-	// Step 4: Deduct one credit
+	// Step 4: Deduct the credit
 	newCredit := currentCredit - deductionAmount
 
 	// Prepare the new credit data
@@ -434,6 +586,123 @@ func (s *pdfInspectorServer) deductUserCredit(ctx context.Context, userKey strin
 	return nil, newCredit
 }
 
+// refundUserCredit gives back the credit deducted for a job that failed on our side, with the same generation match as
+// deductUserCredit so a job starting at the same moment can't clobber it. Unlike a deduction a refund is owed, so a
+// concurrent modification gets retried rather than failing. The refund is recorded under job.CreditRefundPath before the
+// credit goes back, and only if there's no record there already, so a job can't be refunded twice. A job that already
+// was gets the earlier refund back.
+func (s *pdfInspectorServer) refundUserCredit(ctx context.Context, userKey string, jobId string, amount int, reason string) (*job.CreditRefund, error) {
+	creditFilePath := fmt.Sprintf("users/%s/credit", userKey)
+	gcsFs, ok := s.jobRunner.Tuner.Fs.(*filesystem.GCSFileSystem)
+	if !ok {
+		log.Error().Msg("s.Fs is not of type *GCSFilesystem")
+		return nil, errors.New("couldnt get gcs client")
+	}
+	bucket := gcsFs.Client.Bucket(s.config.GcsBucket)
+	object := bucket.Object(creditFilePath)
+	record := bucket.Object(job.CreditRefundPath(userKey, jobId))
+
+	refund := &job.CreditRefund{
+		JobId:   jobId,
+		Amount:  amount,
+		Reason:  reason,
+		Created: time.Now(),
+	}
+	err := writeRefundRecord(ctx, record.If(storage.Conditions{DoesNotExist: true}), refund)
+	if errors.Is(err, ErrObjectAlreadyExists) {
+		log.Info().Msgf("job %s has already been refunded", jobId)
+		rc, err := record.NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read earlier refund: %w", err)
+		}
+		defer rc.Close()
+		earlier := &job.CreditRefund{}
+		if err := json.NewDecoder(rc).Decode(earlier); err != nil {
+			return nil, fmt.Errorf("failed to decode earlier refund: %w", err)
+		}
+		return earlier, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	var newCredit int
+	for try := 0; ; try++ {
+		newCredit, err = s.addUserCredit(ctx, object, amount)
+		if err == nil {
+			break
+		}
+		if try+1 >= MAX_REFUND_TRIES {
+			//take the record back out, or the refund could never be tried again
+			if deleteErr := record.Delete(ctx); deleteErr != nil {
+				log.Error().Msgf("failed to remove refund record for job %s after the refund failed: %v", jobId, deleteErr)
+			}
+			return nil, fmt.Errorf("failed to refund credit after %d tries, possible concurrent modification: %w", MAX_REFUND_TRIES, err)
+		}
+		log.Info().Msgf("refund for job %s collided with another credit change, trying again: %v", jobId, err)
+	}
+
+	refund.CreditRemaining = newCredit
+	log.Info().Msgf("refunded %d credit to user %s for job %s, now has %d", refund.Amount, userKey, jobId, newCredit)
+	err = writeRefundRecord(ctx, record, refund)
+	if err != nil {
+		//the credit is back, which is what matters
+		log.Error().Msgf("failed to update refund record for job %s: %v", jobId, err)
+	}
+	return refund, nil
+}
+
+// addUserCredit adds to the credit file if it hasn't changed since it was read, returning the new balance.
+func (s *pdfInspectorServer) addUserCredit(ctx context.Context, object *storage.ObjectHandle, amount int) (int, error) {
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get generation number: %w", err)
+	}
+	rc, err := object.NewReader(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read credit file: %w", err)
+	}
+	fileData, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read credit file: %w", err)
+	}
+	currentCredit, err := strconv.Atoi(strings.TrimSpace(string(fileData)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid credit format: %w", err)
+	}
+
+	newCredit := currentCredit + amount
+	wc := object.If(storage.Conditions{GenerationMatch: attrs.Generation}).NewWriter(ctx)
+	_, err = wc.Write([]byte(fmt.Sprintf("%d", newCredit)))
+	if err == nil {
+		err = wc.Close() //the generation match is only checked here
+	}
+	return newCredit, err
+}
+
+// writeRefundRecord saves the refund to the (possibly conditional) object. ErrObjectAlreadyExists if the object was
+// only to be written if it didn't exist, and it does.
+func writeRefundRecord(ctx context.Context, object *storage.ObjectHandle, refund *job.CreditRefund) error {
+	refundJSON, err := json.Marshal(refund)
+	if err != nil {
+		return err
+	}
+	wc := object.NewWriter(ctx)
+	wc.ContentType = "application/json"
+	_, err = wc.Write(refundJSON)
+	if err != nil {
+		wc.Close()
+		return err
+	}
+	// the precondition is only checked on Close()
+	err = wc.Close()
+	if err != nil && strings.Contains(err.Error(), "conditionNotMet") {
+		return ErrObjectAlreadyExists
+	}
+	return err
+}
+
 func (s *pdfInspectorServer) GetJsonSchemaHandler(w http.ResponseWriter, r *http.Request) {
 	layout := chi.URLParam(r, "layout")
 	log.Info().Msgf("here in GetJsonSchemaHandler for %s", layout)
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"cloud.google.com/go/storage"
 	"context"
+	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"pdfinspector/pkg/config"
+	"pdfinspector/pkg/job"
 	"pdfinspector/pkg/jobrunner"
 	"pdfinspector/pkg/tuner"
 	"strings"
@@ -189,3 +193,79 @@ func TestGetBestApiKeyForUser(t *testing.T) {
 		})
 	}
 }
+
+func TestOutputFormatForRequest(t *testing.T) {
+	for _, tc := range []struct {
+		formatParam, fileName string
+		expectedFile          string
+		expectedFileName      string
+	}{
+		{"", "Resume.pdf", "Output.pdf", "Resume.pdf"},
+		{"", "Cover Letter.docx", "Output.docx", "Cover Letter.docx"},
+		{"", "Resume", "Output.pdf", "Resume"},
+		{"docx", "Resume.pdf", "Output.docx", "Resume.docx"},
+		{"docx", "Sam.Smith", "Output.docx", "Sam.Smith.docx"},
+		{"pdf", "Resume.pdf", "Output.pdf", "Resume.pdf"},
+		{"", "Resume.txt", "Output.txt", "Resume.txt"},
+		{"md", "Cover Letter.pdf", "Output.md", "Cover Letter.md"},
+	} {
+		format, fileName, err := outputFormatForRequest(tc.formatParam, tc.fileName)
+		if err != nil {
+			t.Errorf("Unexpected error for %q %q: %v", tc.formatParam, tc.fileName, err)
+			continue
+		}
+		if format.Filename() != tc.expectedFile || fileName != tc.expectedFileName {
+			t.Errorf("For %q %q expected %s sent as %s, got %s sent as %s", tc.formatParam, tc.fileName, tc.expectedFile, tc.expectedFileName, format.Filename(), fileName)
+		}
+	}
+
+	_, _, err := outputFormatForRequest("xls", "Resume.pdf")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+// brokenResponseWriter takes the headers and then fails every write, like a client that has gone away.
+type brokenResponseWriter struct {
+	header http.Header
+	writes int
+}
+
+func (w *brokenResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *brokenResponseWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("client went away")
+}
+
+func (w *brokenResponseWriter) WriteHeader(statusCode int) {}
+
+func TestStreamJobUpdatesWaitsForTheJobAfterTheClientGoes(t *testing.T) {
+	server := &pdfInspectorServer{
+		jobRunner: &jobrunner.JobRunner{Tuner: &tuner.Tuner{Fs: NewMockFileSystem()}},
+		config:    &config.ServiceConfig{},
+	}
+	inputJob := job.NewDefaultJob()
+	updates := make(chan job.JobStatus)
+	finished := make(chan bool)
+	go func() {
+		for i := 0; i < 3; i++ {
+			updates <- job.JobStatus{Message: "working"}
+		}
+		close(finished) //every update has been taken, it's unbuffered
+		close(updates)
+	}()
+
+	w := &brokenResponseWriter{header: http.Header{}}
+	server.streamJobUpdates(w, httptest.NewRequest(http.MethodPost, "/streamjob", nil), inputJob, updates)
+	select {
+	case <-finished:
+	default:
+		t.Errorf("Expected every update to have been read before returning")
+	}
+	if w.writes != 1 {
+		t.Errorf("Expected nothing more to be written after the first write failed, got %d writes", w.writes)
+	}
+}
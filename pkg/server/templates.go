@@ -8,12 +8,10 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
-	"github.com/xeipuuv/gojsonschema"
 	"google.golang.org/api/iterator"
 	"io"
 	"net/http"
 	"path/filepath"
-	"pdfinspector/pkg/tuner"
 	"sort"
 	"strings"
 	"time"
@@ -164,7 +162,7 @@ func (s *pdfInspectorServer) getValidatedTemplateFromRequest(w http.ResponseWrit
 	}
 
 	// Step 2: Validate 'resumedata' against the schema.
-	err := s.validateResumeDataAgainstTemplateSchema(template.Layout, template.ResumeData, true)
+	err := s.jobRunner.Tuner.ValidateResumeData(template.Layout, template.ResumeData, true)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Schema validation error: %s", err.Error()), http.StatusInternalServerError)
 		return nil, err
@@ -172,34 +170,6 @@ func (s *pdfInspectorServer) getValidatedTemplateFromRequest(w http.ResponseWrit
 	return &template, nil
 }
 
-func (s *pdfInspectorServer) validateResumeDataAgainstTemplateSchema(layout string, resumeData interface{}, allowRendererFields bool) error {
-	//Validate 'resumedata' against the schema.
-	var schemaInterface interface{}
-	var err error
-	if allowRendererFields {
-		schemaInterface, err = s.jobRunner.Tuner.GetRendererJsonSchema(layout)
-	} else {
-		schemaInterface, err = s.jobRunner.Tuner.GetExpectedResponseJsonSchema(layout)
-	}
-	if err != nil {
-		return err
-	}
-	schemaLoader := gojsonschema.NewGoLoader(schemaInterface)
-	documentLoader := gojsonschema.NewGoLoader(resumeData)
-	log.Trace().Msgf("here with schema: %#v", schemaInterface)
-	log.Trace().Msgf("here with resumeData: %#v", resumeData)
-	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
-	log.Trace().Msgf("validateResumeDataAgainstTemplateSchema err? %#v", err)
-	log.Trace().Msgf("validateResumeDataAgainstTemplateSchema result? %#v", result)
-	if err != nil {
-		return err
-	}
-	if !result.Valid() {
-		return tuner.NewSchemaValidationError(result.Errors())
-	}
-	return nil
-}
-
 func (s *pdfInspectorServer) getTemplateObjectName(r *http.Request) string {
 	userID, _ := r.Context().Value("ssoSubject").(string)
 	//templateID := chi.URLParam(r, "templateID")
@@ -225,11 +225,19 @@ func getResponseTemplatesDir() string {
 	return filepath.Join(testsDir, "../../response_templates")
 }
 
+func getPromptsDir() string {
+	testsDir, err := os.Getwd()
+	if err != nil {
+		panic("wat")
+	}
+	return filepath.Join(testsDir, "../../prompts")
+}
+
 var testServer *pdfInspectorServer
 
 func TestMain(m *testing.M) {
 	// Set up the server once for all tests
-	testServer = NewPdfInspectorServer(&config.ServiceConfig{SchemasPath: getResponseTemplatesDir()})
+	testServer = NewPdfInspectorServer(&config.ServiceConfig{SchemasPath: getResponseTemplatesDir(), PromptsPath: getPromptsDir(), PromptSet: "default"})
 	// Run all tests
 	m.Run()
 }
@@ -245,7 +253,7 @@ func TestValidateInvalidResumeDataAgainstTemplateSchema(t *testing.T) {
 	assert.NoError(t, err, "Failed to unmarshal resume data")
 
 	// Call the function to validate the resume data against the schema
-	err = testServer.validateResumeDataAgainstTemplateSchema("functional", resumeData, false)
+	err = testServer.jobRunner.Tuner.ValidateResumeData("functional", resumeData, false)
 	err_spew := spew.Sprint(err)
 	t.Logf("error details: %#v", spew.Sprint(err))
 	assert.True(t, errors.Is(err, &tuner.SchemaValidationError{}))
@@ -261,7 +269,7 @@ func TestValidateResumeDataWithoutRendererFieldsAgainstResponseTemplateSchema(t
 	assert.NoError(t, err, "Failed to unmarshal resume data")
 
 	// Call the function to validate the resume data against the schema
-	err = testServer.validateResumeDataAgainstTemplateSchema("chrono", resumeData, false)
+	err = testServer.jobRunner.Tuner.ValidateResumeData("chrono", resumeData, false)
 	assert.Nil(t, err)
 }
 
@@ -272,7 +280,7 @@ func TestValidateChronoResumeDataWithRendererFieldsAgainstRendererTemplateSchema
 	assert.NoError(t, err, "Failed to unmarshal resume data")
 
 	// Call the function to validate the resume data against the schema
-	err = testServer.validateResumeDataAgainstTemplateSchema("chrono", resumeData, true)
+	err = testServer.jobRunner.Tuner.ValidateResumeData("chrono", resumeData, true)
 	if err != nil {
 		t.Logf("err: %s", err.Error())
 	}
@@ -286,7 +294,7 @@ func TestValidateFunctionalResumeDataWithRendererFieldsAgainstRendererTemplateSc
 	assert.NoError(t, err, "Failed to unmarshal resume data")
 
 	// Call the function to validate the resume data against the schema
-	err = testServer.validateResumeDataAgainstTemplateSchema("functional", resumeData, true)
+	err = testServer.jobRunner.Tuner.ValidateResumeData("functional", resumeData, true)
 	if err != nil {
 		t.Logf("err: %s", err.Error())
 	}
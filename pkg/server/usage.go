@@ -0,0 +1,115 @@
+package server
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"pdfinspector/pkg/filesystem"
+	"pdfinspector/pkg/job"
+)
+
+// apiKeyUsage is the running total of llm usage for an api key, kept in gcs next to the credit file.
+type apiKeyUsage struct {
+	Jobs int `json:"jobs"`
+	job.TokenUsage
+}
+
+func apiKeyUsagePath(apiKey string) string {
+	return fmt.Sprintf("users/%s/usage", apiKey)
+}
+
+// recordApiKeyUsage adds a jobs usage to the api keys running total. Same generation matching approach as deductUserCredit
+// so that two jobs finishing at the same time don't clobber each other, we just have another go if that happens.
+func (s *pdfInspectorServer) recordApiKeyUsage(ctx context.Context, apiKey string, usage job.TokenUsage) error {
+	gcsFs, ok := s.jobRunner.Tuner.Fs.(*filesystem.GCSFileSystem)
+	if !ok {
+		return errors.New("couldnt get gcs client")
+	}
+	obj := gcsFs.Client.Bucket(s.config.GcsBucket).Object(apiKeyUsagePath(apiKey))
+
+	maxTries := 3
+	var err error
+	for i := 0; i < maxTries; i++ {
+		err = s.tryRecordApiKeyUsage(ctx, obj, usage)
+		if err == nil {
+			return nil
+		}
+		log.Info().Msgf("retrying usage record for api key %s after: %v", apiKey, err)
+	}
+	return err
+}
+
+func (s *pdfInspectorServer) tryRecordApiKeyUsage(ctx context.Context, obj *storage.ObjectHandle, usage job.TokenUsage) error {
+	var current apiKeyUsage
+	conditions := storage.Conditions{DoesNotExist: true}
+
+	attrs, err := obj.Attrs(ctx)
+	if err == nil {
+		conditions = storage.Conditions{GenerationMatch: attrs.Generation}
+		rc, err := obj.If(conditions).NewReader(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read usage file: %w", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read usage file: %w", err)
+		}
+		if err := json.Unmarshal(data, &current); err != nil {
+			return fmt.Errorf("invalid usage format: %w", err)
+		}
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to get usage file attrs: %w", err)
+	}
+
+	current.Jobs++
+	current.TokenUsage.Add(usage)
+	newData, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	wc := obj.If(conditions).NewWriter(ctx)
+	if _, err := wc.Write(newData); err != nil {
+		wc.Close()
+		return fmt.Errorf("failed to write usage, possible concurrent modification: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to write usage, possible concurrent modification: %w", err)
+	}
+	return nil
+}
+
+// GetUsageHandler reports the running llm usage totals for the callers api key. Admins can look at any key with ?apikey=,
+// without it they get their own like everyone else.
+func (s *pdfInspectorServer) GetUsageHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey, _ := r.Context().Value("userKey").(string)
+	if isAdmin, _ := r.Context().Value("isAdmin").(bool); isAdmin && r.URL.Query().Get("apikey") != "" {
+		apiKey = r.URL.Query().Get("apikey")
+	}
+	if apiKey == "" {
+		http.Error(w, "Bad Request: no api key to report usage for", http.StatusBadRequest)
+		return
+	}
+
+	usage := apiKeyUsage{}
+	data, err := s.jobRunner.Tuner.Fs.ReadFile(r.Context(), apiKeyUsagePath(apiKey))
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		http.Error(w, "Failed to read usage", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &usage); err != nil {
+			http.Error(w, "Failed to decode usage", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
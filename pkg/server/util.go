@@ -10,6 +10,8 @@ import (
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/iterator"
 	"net/http"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/tuner"
 	"sort"
 	"strings"
 	"time"
@@ -18,6 +20,7 @@ import (
 type generationInfo struct {
 	Name    string    `json:"name"`
 	Created time.Time `json:"created"`
+	Formats []string  `json:"formats"` //what the output can be downloaded as, see jobOutputHandler
 }
 
 // Custom JSON struct to format the date as yyyy-mm-dd hh:mm
@@ -32,6 +35,15 @@ type attemptInfo struct {
 	Data    string
 }
 
+// drainUpdates keeps reading a jobs updates in the background after we've stopped streaming them, so that the job
+// (which should be stopping too, as the request context is done) never blocks sending one.
+func drainUpdates(updates chan job.JobStatus) {
+	go func() {
+		for range updates {
+		}
+	}()
+}
+
 // CreateCustomToken creates a JWT with 'sub' and 'apikey'
 func (s *pdfInspectorServer) CreateCustomToken(sub string) (string, error) {
 	claims := jwt.MapClaims{
@@ -117,9 +129,18 @@ func (s *pdfInspectorServer) ListSSOUserGenerations(ctx context.Context, userId
 		// Append the object name to the slice
 		// Extract the genId by stripping the prefix
 		genId := strings.TrimPrefix(objAttr.Name, prefix)
+		var record []byte
+		if objAttr.Size > 0 {
+			//older generations have an empty marker, no need to read those
+			record, err = s.readTemplateFromGCS(ctx, objAttr.Name)
+			if err != nil {
+				log.Error().Msgf("failed to read generation record %s: %v", objAttr.Name, err)
+			}
+		}
 		genIds = append(genIds, generationInfo{
 			Name:    genId,
 			Created: objAttr.Created,
+			Formats: tuner.ParseGenerationRecord(record).Formats,
 		})
 	}
 	return genIds, nil
@@ -17,7 +17,9 @@ import (
 
 func TestGCSObjectListing(t *testing.T) {
 	serviceConfig := &config.ServiceConfig{
-		GcsBucket: "my-stinky-bucket",
+		GcsBucket:   "my-stinky-bucket",
+		PromptsPath: getPromptsDir(),
+		PromptSet:   "default",
 	}
 
 	tuner := tuner.NewTuner(serviceConfig)
@@ -0,0 +1,48 @@
+package tuner
+
+import (
+	"errors"
+	"fmt"
+	"pdfinspector/pkg/job"
+)
+
+// ErrBudgetExhausted is when a budget ran out before there was anything to go with.
+var ErrBudgetExhausted = errors.New("job budget exhausted")
+
+// DefaultBudget is the budget jobs get from config, for whatever they don't set themselves.
+func (t *Tuner) DefaultBudget() job.Budget {
+	return job.Budget{
+		MaxAttempts:    t.config.BudgetMaxAttempts,
+		MaxWallSeconds: t.config.BudgetMaxWallSeconds,
+		MaxTokens:      t.config.BudgetMaxTokens,
+	}
+}
+
+// DefaultExtractionBudget is DefaultBudget but with extractions own number of attempts, they're cheaper and fail differently.
+func (t *Tuner) DefaultExtractionBudget() job.Budget {
+	budget := t.DefaultBudget()
+	budget.MaxAttempts = t.config.ExtractMaxAttempts
+	return budget
+}
+
+// describeBudget is the limit of a budget, for telling the user which one ran out.
+func describeBudget(budget job.Budget, exhausted string) string {
+	switch exhausted {
+	case job.BUDGET_WALL_TIME:
+		return fmt.Sprintf("%d seconds", budget.MaxWallSeconds)
+	case job.BUDGET_TOKENS:
+		return fmt.Sprintf("%d tokens", budget.MaxTokens)
+	}
+	return exhausted
+}
+
+// sendBudgetExhausted puts which budget ran out in the job stream, flagged so a client can tell it apart from other updates.
+func sendBudgetExhausted(updates chan job.JobStatus, budget job.Budget, exhausted string) {
+	if updates == nil {
+		return
+	}
+	updates <- job.JobStatus{
+		Message:         fmt.Sprintf("used up the %s budget of %s, going with the best result so far", exhausted, describeBudget(budget, exhausted)),
+		BudgetExhausted: exhausted,
+	}
+}
@@ -0,0 +1,106 @@
+package tuner
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/config"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"testing"
+)
+
+func TestTuningStopsWithTheBestSoFarWhenTheTokenBudgetRunsOut(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Budget.MaxTokens = 1000
+	testJob.Usage.Record("attempt_0", job.TokenUsage{Calls: 1, TotalTokens: 1200})
+	assert.NoError(t, os.WriteFile(filepath.Join(testJob.OutputDir, "attempt0.pdf"), []byte("%PDF"), 0644))
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		NextMessages: []llm.ChatMessage{{Role: "user", Content: "tune it"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.5}},
+		Scores:       []AttemptScore{{Attempt: 0, Total: 1.5}},
+		State:        CHECKPOINT_RUNNING,
+	}
+
+	err := tuner.ContinueTuneResumeContents(context.Background(), checkpoint, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, job.BUDGET_TOKENS, testJob.BudgetExhausted)
+	assert.Empty(t, fake.Requests)
+}
+
+func TestTuningFailsIfABudgetRunsOutBeforeAnythingWasRendered(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Budget.MaxTokens = 1000
+	testJob.Usage.Record("attempt_0", job.TokenUsage{Calls: 1, TotalTokens: 1200})
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		NextMessages: []llm.ChatMessage{{Role: "user", Content: "tune it"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{Skipped: true}},
+		Scores:       []AttemptScore{{Attempt: 0, Skipped: true}},
+		State:        CHECKPOINT_RUNNING,
+	}
+
+	err := tuner.ContinueTuneResumeContents(context.Background(), checkpoint, nil)
+	assert.ErrorIs(t, err, ErrBudgetExhausted)
+	assert.Equal(t, job.BUDGET_TOKENS, testJob.BudgetExhausted)
+}
+
+func TestUsingUpTheAttemptsIsNotABudgetRunningOut(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Budget.MaxAttempts = 1
+	assert.NoError(t, os.WriteFile(filepath.Join(testJob.OutputDir, "attempt0.pdf"), []byte("%PDF"), 0644))
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		NextMessages: []llm.ChatMessage{{Role: "user", Content: "tune it"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.5}},
+		Scores:       []AttemptScore{{Attempt: 0, Total: 1.5}},
+		State:        CHECKPOINT_RUNNING,
+	}
+	updates := make(chan job.JobStatus, 10)
+
+	err := tuner.ContinueTuneResumeContents(context.Background(), checkpoint, updates)
+	assert.NoError(t, err)
+	assert.Empty(t, testJob.BudgetExhausted)
+	assert.Empty(t, fake.Requests)
+	close(updates)
+	for update := range updates {
+		assert.Empty(t, update.BudgetExhausted)
+	}
+}
+
+func TestTuningFailsIfNoAttemptCouldBeRendered(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Budget.MaxAttempts = 1
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		NextMessages: []llm.ChatMessage{{Role: "user", Content: "tune it"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{Skipped: true}},
+		Scores:       []AttemptScore{{Attempt: 0, Skipped: true}},
+		State:        CHECKPOINT_RUNNING,
+	}
+
+	err := tuner.ContinueTuneResumeContents(context.Background(), checkpoint, nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrBudgetExhausted)
+	assert.Empty(t, testJob.BudgetExhausted)
+}
+
+func TestExtractionHasItsOwnAttemptDefault(t *testing.T) {
+	tuner := &Tuner{config: &config.ServiceConfig{BudgetMaxAttempts: 3, ExtractMaxAttempts: 7, BudgetMaxWallSeconds: 60}}
+	assert.Equal(t, job.Budget{MaxAttempts: 7, MaxWallSeconds: 60}, tuner.DefaultExtractionBudget())
+	assert.Equal(t, job.Budget{MaxAttempts: 3, MaxWallSeconds: 60}, tuner.DefaultBudget())
+}
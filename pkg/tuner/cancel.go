@@ -0,0 +1,34 @@
+package tuner
+
+import (
+	"os"
+	"pdfinspector/pkg/job"
+)
+
+const CANCELLED_FILENAME = "cancelled.json"
+
+// RecordCancelledJob notes that a job was cancelled next to whatever outputs it got to, so it can be told apart from one that
+// failed or is still going. On gcs the local output dir is only scratch space for rendering, so that gets cleaned up too.
+func (t *Tuner) RecordCancelledJob(j *job.Job, reason string) {
+	result := job.JobResult{
+		Status:  "Cancelled",
+		Details: reason,
+	}
+	if j.Usage != nil {
+		totals := j.Usage.Totals()
+		result.Usage = &totals
+	}
+	resultJSON, err := serializeToJSON(result)
+	if err != nil {
+		j.Log().Error().Msgf("Error serializing cancelled job result: %v", err)
+	} else {
+		t.saveJobOutputFile(j, CANCELLED_FILENAME, resultJSON)
+	}
+
+	if t.config.FsType == "gcs" && j.OutputDir != "" {
+		err = os.RemoveAll(j.OutputDir)
+		if err != nil {
+			j.Log().Error().Msgf("Error cleaning up local files of cancelled job: %v", err)
+		}
+	}
+}
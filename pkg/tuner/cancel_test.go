@@ -0,0 +1,43 @@
+package tuner
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"testing"
+)
+
+func TestRenderCandidateStopsWhenCancelled(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := fabricationTestJob(t)
+	testJob.Usage = job.NewUsageSummary()
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	candidate := tuner.renderCandidate(ctx, testJob, request, 0, 0, nil)
+	assert.True(t, errors.Is(candidate.err, context.Canceled))
+	var completionErr *CompletionError
+	assert.False(t, errors.As(candidate.err, &completionErr), "a cancel isn't just an unusable attempt, it needs to stop the job")
+	assert.Empty(t, fake.Requests)
+}
+
+func TestRecordCancelledJob(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := fabricationTestJob(t)
+	testJob.Usage = job.NewUsageSummary()
+	testJob.Usage.Record("attempt_0", job.TokenUsage{Calls: 1, TotalTokens: 100})
+
+	tuner.RecordCancelledJob(testJob, "stopped")
+	recorded, err := os.ReadFile(filepath.Join(testJob.OutputDir, CANCELLED_FILENAME))
+	assert.NoError(t, err, "outside of gcs the outputs are the record, so they stay")
+	decoded, err := DecodeJSON(string(recorded))
+	assert.NoError(t, err)
+	assert.Equal(t, "Cancelled", decoded.(map[string]interface{})["status"])
+	assert.Equal(t, float64(100), decoded.(map[string]interface{})["usage"].(map[string]interface{})["total_tokens"])
+}
@@ -0,0 +1,206 @@
+package tuner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"strings"
+	"sync"
+)
+
+// Candidates are extra completions asked for in parallel for the same attempt, each rendered and inspected on its own,
+// with only the best one carrying on as the attempt. Every file we write is numbered by attempt, so each candidate gets
+// its own number ("slot"): the first candidate is the attempt itself and the rest are offset by CANDIDATE_SLOT_STRIDE,
+// eg candidate 2 of attempt 3 is written as attempt203.json/pdf, out203-001.png and so on.
+const CANDIDATE_SLOT_STRIDE = 100
+
+// MAX_ADMIN_CANDIDATES is as many candidates as any job can have, admin or not (non-admins are held to job.MAX_CANDIDATES).
+// Any more and the candidates slots would run into the pruned renders, see PRUNE_SLOT_BASE.
+const MAX_ADMIN_CANDIDATES = PRUNE_SLOT_BASE/CANDIDATE_SLOT_STRIDE - 1
+
+// KEYWORD_COVERAGE_WEIGHT is how much keyword coverage counts against page fit when picking a candidate.
+// A candidate with every keyword beats one with none only if it's within 10% of a page as close to the aim.
+const KEYWORD_COVERAGE_WEIGHT = 0.1
+
+type attemptCandidate struct {
+	slot         int
+	content      string
+	result       inspectResult
+	reverted     bool  //a fabrication revert turn was run on the content
+	fabrications int   //how many details the fabrication guard flagged in the content
+	err          error //a *CompletionError if the completion itself was unusable, *SchemaValidationError if it couldn't be repaired to fit the schema
+}
+
+func candidateSlot(attempt, candidate int) int {
+	return candidate*CANDIDATE_SLOT_STRIDE + attempt
+}
+
+func candidatePhase(attempt, candidate int) string {
+	if candidate == 0 {
+		return fmt.Sprintf("attempt_%d", attempt)
+	}
+	return fmt.Sprintf("attempt_%d_candidate_%d", attempt, candidate)
+}
+
+// renderCandidates asks for, renders and inspects the jobs number of candidates for an attempt, all at the same time.
+func (t *Tuner) renderCandidates(ctx context.Context, job *job.Job, request *llm.ChatRequest, attempt int, updates chan job.JobStatus) []attemptCandidate {
+	count := job.Candidates
+	if count < 1 {
+		count = 1
+	}
+	if count == 1 {
+		SendJobUpdate(updates, fmt.Sprintf("asking for an attempt %d", attempt))
+	} else {
+		SendJobUpdate(updates, fmt.Sprintf("asking for an attempt %d, %d candidates", attempt, count))
+	}
+
+	candidates := make([]attemptCandidate, count)
+	var wg sync.WaitGroup
+	for c := 0; c < count; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			candidates[c] = t.renderCandidate(ctx, job, request, attempt, c, updates)
+		}(c)
+	}
+	wg.Wait()
+	return candidates
+}
+
+// renderCandidate is a single go at an attempt: get the completion and render it.
+func (t *Tuner) renderCandidate(ctx context.Context, job *job.Job, request *llm.ChatRequest, attempt int, candidate int, updates chan job.JobStatus) attemptCandidate {
+	slot := candidateSlot(attempt, candidate)
+	phase := candidatePhase(attempt, candidate)
+	label := strings.ReplaceAll(phase, "_", " ")
+	failed := func(err error) attemptCandidate {
+		return attemptCandidate{slot: slot, err: err}
+	}
+
+	output, err := t.makeAPIRequest(ctx, request, slot, "api_response_raw", job.OutputDir, job.Usage, phase, updates)
+	if err != nil {
+		return failed(err)
+	}
+
+	//openai api should have responded to our request with a json text that can be used as resumedata input. extract it.
+	content, err := extractCompletionContent(output, phase)
+	if err != nil {
+		job.Log().Info().Msgf("%s completion was unusable: %v", label, err)
+		return failed(err)
+	}
+
+	err = validateJSON(content)
+	if err != nil {
+		job.Log().Error().Msgf("Error validating JSON content: %v", err)
+		return failed(err)
+	}
+	set, err := t.jobPromptSet(job)
+	if err != nil {
+		return failed(err)
+	}
+	content, err = t.repairAgainstSchema(ctx, request, content, job.Layout, set, slot, job.OutputDir, job.Usage, phase, updates)
+	if err != nil {
+		job.Log().Info().Msgf("%s output doesn't fit the schema: %v", label, err)
+		return failed(err)
+	}
+	content, reverted := t.guardAgainstFabrications(ctx, job, request, content, set, slot, phase, updates)
+	job.Log().Info().Msgf("Got %d bytes of JSON content (matching the %s schema) out of the %s response", len(content), job.Layout, label)
+	SendJobUpdate(updates, fmt.Sprintf("got JSON for %s, will request PDF", label))
+
+	result, err := t.renderResumeData(ctx, job, content, slot, label, updates)
+	if err != nil {
+		return failed(err)
+	}
+	return attemptCandidate{slot: slot, content: content, result: result, reverted: reverted, fabrications: len(fabricationsIn(job, content))}
+}
+
+// renderResumeData writes out the resumedata under the slot number, renders it, dumps it to png with ghostscript
+// and sees how it fits the page.
+func (t *Tuner) renderResumeData(ctx context.Context, job *job.Job, content string, slot int, label string, updates chan job.JobStatus) (inspectResult, error) {
+	err := WriteAttemptResumedataJSON(content, job, slot)
+	if err != nil {
+		job.Log().Error().Msgf("Error writing resumedata JSON for %s: %v", label, err)
+	}
+
+	//we should be able to render that updated content proposal now, then inspect it with ghostscript
+	err = t.renderAttemptPDF(ctx, job, slot)
+	if err != nil {
+		return inspectResult{}, err
+	}
+	SendJobUpdate(updates, fmt.Sprintf("got PDF for %s, will dump to PNG", label))
+
+	//and the ghostscript dump to pngs ...
+	err = t.rasterizeAttempt(ctx, slot, job.OutputDir)
+	if err != nil {
+		return inspectResult{}, fmt.Errorf("Error during pdf to image dump: %v", err)
+	}
+	SendJobUpdate(updates, fmt.Sprintf("got PNGs for %s, will check it", label))
+
+	result, err := inspectPNGFiles(job.OutputDir, slot, job.PrintOptions)
+	if err != nil {
+		job.Log().Error().Msgf("Error inspecting png files: %v", err)
+		return inspectResult{}, err
+	}
+	job.Log().Info().Msgf("%s inspect result: %#v", label, result)
+	if result.NumberOfPages == 0 {
+		return inspectResult{}, fmt.Errorf("no pages, idk just stop")
+	}
+	return result, nil
+}
+
+// pickBestCandidate returns the index of the candidate the scorer likes best, see AttemptScorer.
+// -1 if none of them made it through to being inspected.
+func pickBestCandidate(candidates []attemptCandidate, scorer AttemptScorer, keywords []string, goal LengthGoal) int {
+	best := -1
+	bestScore := math.Inf(-1)
+	for i, candidate := range candidates {
+		if candidate.err != nil {
+			continue
+		}
+		//anything that got this far matched the schema
+		score := scorer.Score(ScoredAttempt{Result: candidate.result, Content: candidate.content, Keywords: keywords, SchemaValid: true, Fabrications: candidate.fabrications}, goal)
+		if score.Total > bestScore {
+			best, bestScore = i, score.Total
+		}
+	}
+	return best
+}
+
+// keywordCoverage is the fraction of the keywords that show up somewhere in the text of the resumedata, ignoring case.
+func keywordCoverage(content string, keywords []string) float64 {
+	if len(keywords) == 0 {
+		return 0
+	}
+	decoded, err := DecodeJSON(content)
+	if err != nil {
+		return 0
+	}
+	text := strings.ToLower(ExtractText(decoded))
+	found := 0
+	for _, keyword := range keywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			found++
+		}
+	}
+	return float64(found) / float64(len(keywords))
+}
+
+// promoteCandidate makes a winning candidate (or a pruned version of it) the attempt, so that everything after (best attempt selection, saving the pdf)
+// only has to know about attempts.
+func (t *Tuner) promoteCandidate(job *job.Job, candidate attemptCandidate, attempt int) error {
+	if candidate.slot == attempt {
+		return nil
+	}
+	err := WriteAttemptResumedataJSON(candidate.content, job, attempt)
+	if err != nil {
+		return err
+	}
+	pdf, err := os.ReadFile(filepath.Join(job.OutputDir, fmt.Sprintf("attempt%d.pdf", candidate.slot)))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(job.OutputDir, fmt.Sprintf("attempt%d.pdf", attempt)), pdf, 0644)
+}
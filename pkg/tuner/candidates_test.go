@@ -0,0 +1,90 @@
+package tuner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/render"
+	"sync"
+	"testing"
+)
+
+func TestCandidateSlotsDontCollideWithAttempts(t *testing.T) {
+	assert.Equal(t, 3, candidateSlot(3, 0))
+	assert.Equal(t, 203, candidateSlot(3, 2))
+	assert.Equal(t, "attempt_3", candidatePhase(3, 0))
+	assert.Equal(t, "attempt_3_candidate_2", candidatePhase(3, 2))
+}
+
+func TestPickBestCandidatePrefersFitThenKeywords(t *testing.T) {
+	goal := LengthGoal{Pages: 1, AcceptableRatio: 0.88}
+	keywords := []string{"Go", "Kubernetes"}
+
+	candidates := []attemptCandidate{
+		{err: errors.New("gotenberg fell over")},
+		{content: `{"skills":["go","kubernetes"]}`, result: inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.1}},
+		{content: `{"skills":["java"]}`, result: inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.9}},
+	}
+	assert.Equal(t, 2, pickBestCandidate(candidates, defaultAttemptScorer, keywords, goal), "fitting on the page beats the keywords")
+
+	candidates = []attemptCandidate{
+		{content: `{"skills":["java"]}`, result: inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.92}},
+		{content: `{"work":[{"summary":"ran go services on kubernetes"}]}`, result: inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.9}},
+	}
+	assert.Equal(t, 1, pickBestCandidate(candidates, defaultAttemptScorer, keywords, goal), "about as good a fit, more keywords")
+
+	assert.Equal(t, -1, pickBestCandidate([]attemptCandidate{{err: ErrCompletionRefused}}, defaultAttemptScorer, keywords, goal))
+}
+
+func TestKeywordCoverage(t *testing.T) {
+	assert.Equal(t, 0.5, keywordCoverage(`{"skills":["Golang"]}`, []string{"go", "rust"}))
+	assert.Equal(t, 0.0, keywordCoverage(`not json`, []string{"go"}))
+	assert.Equal(t, 0.0, keywordCoverage(`{}`, nil))
+}
+
+func TestCandidatesRenderedAtOnceCheckTheirOwnPDFText(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, _ := schemaTestTuner(t, fake)
+	tuner.Renderer = render.NewStubRenderer()
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Candidates = 2
+	var dumped sync.WaitGroup
+	dumped.Add(2)
+	tuner.rasterize = func(ctx context.Context, attempt int, outputDir string) error {
+		text := "Sam Smith"
+		if attempt == candidateSlot(0, 1) {
+			text = "Uncaught runtime errors"
+		}
+		textPath := filepath.Join(outputDir, pdfTextFilename(attempt))
+		err := os.WriteFile(textPath, []byte(text), 0644)
+		//both candidates have dumped their text before either of them checks it
+		dumped.Done()
+		dumped.Wait()
+		if err != nil {
+			return err
+		}
+		err = checkPDFText(textPath)
+		if err != nil {
+			return err
+		}
+		file, err := os.Create(filepath.Join(outputDir, fmt.Sprintf("out%d-001.png", attempt)))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return png.Encode(file, pageImage(1100, 550))
+	}
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	candidates := tuner.renderCandidates(context.Background(), testJob, request, 0, nil)
+	if assert.Len(t, candidates, 2) {
+		assert.NoError(t, candidates[0].err)
+		assert.Equal(t, 1, candidates[0].result.NumberOfPages)
+		assert.ErrorContains(t, candidates[1].err, "Uncaught runtime errors")
+	}
+}
@@ -0,0 +1,168 @@
+package tuner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"strings"
+	"time"
+)
+
+// A checkpoint is everything the attempt loop in TuneResumeContents needs to carry on from where it got to, saved before
+// every attempt. If the instance running a job goes away mid-job, the job can be picked up again from its checkpoint
+// (see ContinueTuneResumeContents) rather than starting over and being paid for twice.
+const CHECKPOINT_FILENAME = "checkpoint.json"
+
+const (
+	CHECKPOINT_RUNNING   = "running" //still going, or whatever was running it went away. the latter can be resumed.
+	CHECKPOINT_FINISHED  = "finished"
+	CHECKPOINT_FAILED    = "failed"
+	CHECKPOINT_CANCELLED = "cancelled"
+)
+
+// CHECKPOINT_STALE_AFTER is how long a running checkpoint has to go without being saved before whatever was running the job
+// is taken to have gone away. It's saved before every attempt, so this needs to be longer than any one attempt takes (a
+// completion plus schema repairs and a fabrication revert, each up to LLM_CALL_TIMEOUT, then the renders), or a job still
+// running elsewhere could get resumed alongside itself. 15 minutes is the request timeout, nothing runs longer than that.
+const CHECKPOINT_STALE_AFTER = 15 * time.Minute
+
+type Checkpoint struct {
+	Job      *job.Job `json:"job"`
+	Keywords []string `json:"keywords"` //from the notes on the JD, so those don't need taking again
+
+	Messages     []llm.ChatMessage `json:"messages"`      //the system and main prompts, which every attempt starts from
+	NextMessages []llm.ChatMessage `json:"next_messages"` //what gets sent for attempt NextAttempt
+
+	NextAttempt       int                      `json:"next_attempt"`
+	AttemptsLog       []inspectResult          `json:"attempts_log"`
+	Scores            []AttemptScore           `json:"scores"`           //lined up with AttemptsLog
+	RequestedChange   float64                  `json:"requested_change"` //what the length controller asked for last, to be recorded with the next attempt
+	FabricationReport []fabricationReportEntry `json:"fabrication_report,omitempty"`
+
+	State   string    `json:"state"`
+	Updated time.Time `json:"updated"`
+
+	started time.Time //when this run of the job started, for the wall time budget
+}
+
+// MayStillBeRunning is true if the job could still be going somewhere, having saved its checkpoint recently.
+func (c *Checkpoint) MayStillBeRunning(now time.Time) bool {
+	return c.State == CHECKPOINT_RUNNING && now.Sub(c.Updated) < CHECKPOINT_STALE_AFTER
+}
+
+// saveCheckpoint writes the checkpoint next to the other outputs, locally and to gcs if that's what we're using.
+func (t *Tuner) saveCheckpoint(checkpoint *Checkpoint) {
+	checkpoint.Updated = time.Now()
+	checkpointJSON, err := serializeToJSON(checkpoint)
+	if err != nil {
+		checkpoint.Job.Log().Error().Msgf("Error serializing checkpoint: %v", err)
+		return
+	}
+	t.saveJobOutputFile(checkpoint.Job, CHECKPOINT_FILENAME, checkpointJSON)
+}
+
+// saveTuningOutcome is everything that gets saved once tuning stops, however it stopped.
+func (t *Tuner) saveTuningOutcome(checkpoint *Checkpoint, jobErr error) {
+	j := checkpoint.Job
+	t.saveExperimentOutcome(j, checkpoint.AttemptsLog, bestAttemptIndex(checkpoint.Scores), jobErr)
+	t.saveUsageSummary(j)
+	t.saveFabricationReport(j, checkpoint.FabricationReport)
+	if checkpoint.State == "" {
+		//never got as far as the first attempt, there's nothing to resume from
+		return
+	}
+	switch {
+	case jobErr == nil:
+		checkpoint.State = CHECKPOINT_FINISHED
+	case errors.Is(jobErr, context.Canceled), errors.Is(jobErr, context.DeadlineExceeded):
+		checkpoint.State = CHECKPOINT_CANCELLED
+	default:
+		checkpoint.State = CHECKPOINT_FAILED
+	}
+	t.saveCheckpoint(checkpoint)
+}
+
+// saveAttemptPDF copies an attempts PDF to gcs. On gcs the local output dir is only scratch space, and a resumed job
+// could well be on an instance that's never seen it, but it still needs the earlier attempts to pick the best from.
+func (t *Tuner) saveAttemptPDF(j *job.Job, attempt int) {
+	if t.config.FsType != "gcs" {
+		return
+	}
+	filename := fmt.Sprintf("attempt%d.pdf", attempt)
+	data, err := os.ReadFile(filepath.Join(j.OutputDir, filename))
+	if err == nil {
+		err = t.Fs.WriteFile(fmt.Sprintf("%s/%s", j.OutputDir, filename), data)
+	}
+	if err != nil {
+		j.Log().Error().Msgf("Error saving %s to GCS: %v", filename, err)
+	}
+}
+
+// restoreAttemptFiles gets back the PDFs of the attempts made before the checkpoint, where they aren't on the local disk.
+// Any that can't be had are marked skipped, so they aren't picked as the best.
+func (t *Tuner) restoreAttemptFiles(ctx context.Context, checkpoint *Checkpoint) {
+	j := checkpoint.Job
+	err := os.MkdirAll(j.OutputDir, 0755)
+	if err != nil {
+		j.Log().Error().Msgf("Error creating output dir for resumed job: %v", err)
+	}
+	for i := range checkpoint.AttemptsLog {
+		if checkpoint.AttemptsLog[i].Skipped {
+			continue
+		}
+		filename := fmt.Sprintf("attempt%d.pdf", i)
+		localPath := filepath.Join(j.OutputDir, filename)
+		if _, err := os.Stat(localPath); err == nil {
+			continue
+		}
+		var data []byte
+		err = errors.New("not on the local disk")
+		if t.config.FsType == "gcs" {
+			data, err = t.Fs.ReadFile(ctx, fmt.Sprintf("%s/%s", j.OutputDir, filename))
+		}
+		if err == nil {
+			err = os.WriteFile(localPath, data, 0644)
+		}
+		if err != nil {
+			j.Log().Info().Msgf("couldn't restore %s, it won't be considered for the result: %v", filename, err)
+			checkpoint.AttemptsLog[i].Skipped = true
+			if i < len(checkpoint.Scores) {
+				checkpoint.Scores[i].Skipped = true
+			}
+		}
+	}
+}
+
+// LoadCheckpoint reads the checkpoint of a job, from gcs or the local disk depending on which we're using.
+func (t *Tuner) LoadCheckpoint(ctx context.Context, jobId string) (*Checkpoint, error) {
+	if jobId == "" || strings.ContainsAny(jobId, `/\`) || strings.Contains(jobId, "..") {
+		return nil, fmt.Errorf("invalid job id %q", jobId)
+	}
+	var data []byte
+	var err error
+	outputDir := fmt.Sprintf("%s/%s", t.config.LocalPath, jobId)
+	if t.config.FsType == "gcs" {
+		data, err = t.Fs.ReadFile(ctx, fmt.Sprintf("%s/%s", outputDir, CHECKPOINT_FILENAME))
+	} else {
+		data, err = os.ReadFile(filepath.Join(outputDir, CHECKPOINT_FILENAME))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading checkpoint for job %s: %w", jobId, err)
+	}
+	checkpoint := &Checkpoint{}
+	err = json.Unmarshal(data, checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding checkpoint for job %s: %w", jobId, err)
+	}
+	if checkpoint.Job == nil || checkpoint.Job.Id != jobId {
+		return nil, fmt.Errorf("checkpoint for job %s doesn't have the job in it", jobId)
+	}
+	checkpoint.Job.PrepareResumed()
+	checkpoint.Job.OutputDir = outputDir
+	return checkpoint, nil
+}
@@ -0,0 +1,123 @@
+package tuner
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"testing"
+	"time"
+)
+
+func checkpointTestJob(t *testing.T, tuner *Tuner) *job.Job {
+	tuner.config.FsType = "local"
+	tuner.config.LocalPath = t.TempDir()
+	testJob := fabricationTestJob(t)
+	testJob.OutputDir = fmt.Sprintf("%s/%s", tuner.config.LocalPath, testJob.Id)
+	testJob.UserKey = "user-key"
+	testJob.Budget = job.Budget{MaxAttempts: 3}
+	testJob.AcceptableRatio = 0.9
+	temperature := 0.7
+	testJob.Temperature = &temperature
+	assert.NoError(t, os.MkdirAll(testJob.OutputDir, 0755))
+	return testJob
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Usage.Record("attempt_0", job.TokenUsage{Calls: 1, TotalTokens: 100})
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		Keywords:     []string{"go"},
+		Messages:     []llm.ChatMessage{{Role: "system", Content: "be good"}, {Role: "user", Content: "tune it"}},
+		NextMessages: []llm.ChatMessage{{Role: "user", Content: "now shorter"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{NumberOfPages: 2, LastPageContentRatio: 0.1}},
+		State:        CHECKPOINT_RUNNING,
+	}
+	tuner.saveCheckpoint(checkpoint)
+
+	loaded, err := tuner.LoadCheckpoint(context.Background(), testJob.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, checkpoint.Keywords, loaded.Keywords)
+		assert.Equal(t, checkpoint.NextMessages, loaded.NextMessages)
+		assert.Equal(t, checkpoint.AttemptsLog, loaded.AttemptsLog)
+		assert.Equal(t, "user-key", loaded.Job.UserKey)
+		assert.Equal(t, testJob.OutputDir, loaded.Job.OutputDir)
+		assert.NotNil(t, loaded.Job.Log(), "the logger doesn't get saved, it has to be set back up")
+		assert.Equal(t, 100, loaded.Job.Usage.Totals().TotalTokens)
+	}
+
+	_, err = tuner.LoadCheckpoint(context.Background(), "..")
+	assert.Error(t, err)
+	_, err = tuner.LoadCheckpoint(context.Background(), "no-such-job")
+	assert.Error(t, err)
+}
+
+func TestContinueTuneResumeContentsPicksUpFromTheCheckpoint(t *testing.T) {
+	fake := llm.NewFakeClient()
+	fake.Handler = func(request *llm.ChatRequest) (*llm.ChatResponse, error) {
+		return &llm.ChatResponse{Choices: []llm.ChatChoice{{
+			Message:      llm.ChatMessage{Role: "assistant", Refusal: "no thanks"},
+			FinishReason: "stop",
+		}}}, nil
+	}
+	tuner, _ := schemaTestTuner(t, fake)
+	testJob := checkpointTestJob(t, tuner)
+	assert.NoError(t, os.WriteFile(filepath.Join(testJob.OutputDir, "attempt0.pdf"), []byte("%PDF"), 0644))
+	checkpoint := &Checkpoint{
+		Job:          testJob,
+		Messages:     []llm.ChatMessage{{Role: "system", Content: "be good"}, {Role: "user", Content: "tune it"}},
+		NextMessages: []llm.ChatMessage{{Role: "system", Content: "be good"}, {Role: "user", Content: "tune it"}, {Role: "assistant", Content: validChronoResponse}, {Role: "user", Content: "a bit longer"}},
+		NextAttempt:  1,
+		AttemptsLog:  []inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.5}},
+		Scores:       []AttemptScore{{Attempt: 0, Total: 1.5}},
+		State:        CHECKPOINT_RUNNING,
+	}
+
+	err := tuner.ContinueTuneResumeContents(context.Background(), checkpoint, nil)
+	assert.NoError(t, err, "the refusal stops it, but there's still the attempt from before the checkpoint to go with")
+	if assert.Len(t, fake.Requests, 1, "the JD notes and first attempt aren't asked for again") {
+		assert.Equal(t, checkpoint.NextMessages, fake.Requests[0].Messages)
+	}
+	assert.Len(t, checkpoint.AttemptsLog, 2)
+	assert.Len(t, checkpoint.Scores, 2)
+
+	saved, err := tuner.LoadCheckpoint(context.Background(), testJob.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, CHECKPOINT_FINISHED, saved.State)
+	}
+	err = tuner.ContinueTuneResumeContents(context.Background(), saved, nil)
+	assert.Error(t, err, "a finished job can't be resumed")
+}
+
+func TestCheckpointMayStillBeRunningUntilItGoesQuiet(t *testing.T) {
+	now := time.Now()
+	checkpoint := &Checkpoint{State: CHECKPOINT_RUNNING, Updated: now.Add(-time.Minute)}
+	assert.True(t, checkpoint.MayStillBeRunning(now))
+	checkpoint.Updated = now.Add(-CHECKPOINT_STALE_AFTER)
+	assert.False(t, checkpoint.MayStillBeRunning(now))
+	checkpoint = &Checkpoint{State: CHECKPOINT_FAILED, Updated: now}
+	assert.False(t, checkpoint.MayStillBeRunning(now))
+}
+
+func TestRestoreAttemptFilesSkipsWhatCantBeRestored(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	assert.NoError(t, os.WriteFile(filepath.Join(testJob.OutputDir, "attempt1.pdf"), []byte("%PDF"), 0644))
+	checkpoint := &Checkpoint{
+		Job:         testJob,
+		AttemptsLog: []inspectResult{{NumberOfPages: 1}, {NumberOfPages: 1}},
+		Scores:      []AttemptScore{{Attempt: 0}, {Attempt: 1}},
+	}
+
+	tuner.restoreAttemptFiles(context.Background(), checkpoint)
+	assert.True(t, checkpoint.AttemptsLog[0].Skipped)
+	assert.False(t, checkpoint.AttemptsLog[1].Skipped)
+	assert.True(t, checkpoint.Scores[0].Skipped)
+	assert.Equal(t, 1, bestAttemptIndex(checkpoint.Scores))
+}
@@ -0,0 +1,57 @@
+package tuner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pdfinspector/pkg/llm"
+)
+
+// Sentinels for completions that came back fine as far as http goes, but can't be used as they are.
+var (
+	ErrCompletionTruncated = errors.New("LLM response was cut off before it finished")
+	ErrCompletionRefused   = errors.New("LLM refused to produce a response")
+)
+
+// CompletionError is a truncated or refused completion. It unwraps to ErrCompletionTruncated or ErrCompletionRefused
+// so the tuning loop can decide whether to re-ask, and the jobrunner can tell the user exactly what happened.
+type CompletionError struct {
+	Phase        string
+	FinishReason string
+	Refusal      string //what the model said instead, if anything
+	kind         error
+}
+
+func (e *CompletionError) Error() string {
+	if e.Refusal != "" {
+		return fmt.Sprintf("%s: %s (finish_reason %s): %s", e.Phase, e.kind.Error(), e.FinishReason, e.Refusal)
+	}
+	return fmt.Sprintf("%s: %s (finish_reason %s)", e.Phase, e.kind.Error(), e.FinishReason)
+}
+
+func (e *CompletionError) Unwrap() error {
+	return e.kind
+}
+
+// extractCompletionContent pulls the content out of an API response, checking finish_reason and refusal first. A truncated structured output is just broken JSON, so it is better to say so than to fail parsing it.
+func extractCompletionContent(output string, phase string) (string, error) {
+	var apiResponse llm.ChatResponse
+	err := json.Unmarshal([]byte(output), &apiResponse)
+	if err != nil {
+		return "", fmt.Errorf("Error deserializing API response: %v", err)
+	}
+
+	//Extract the message content
+	if len(apiResponse.Choices) == 0 {
+		return "", errors.New("no choices found in the API response")
+	}
+	choice := apiResponse.Choices[0]
+
+	switch {
+	case choice.Message.Refusal != "" || choice.FinishReason == "content_filter" || choice.FinishReason == "refusal":
+		return "", &CompletionError{Phase: phase, FinishReason: choice.FinishReason, Refusal: choice.Message.Refusal, kind: ErrCompletionRefused}
+	case choice.FinishReason == "length":
+		return "", &CompletionError{Phase: phase, FinishReason: choice.FinishReason, kind: ErrCompletionTruncated}
+	}
+	return choice.Message.Content, nil
+}
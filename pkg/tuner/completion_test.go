@@ -0,0 +1,26 @@
+package tuner
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExtractCompletionContentTypesTruncationAndRefusal(t *testing.T) {
+	content, err := extractCompletionContent(`{"choices":[{"message":{"content":"{}"},"finish_reason":"stop"}]}`, "attempt_0")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", content)
+
+	_, err = extractCompletionContent(`{"choices":[{"message":{"content":"{\"basics\":{\"na"},"finish_reason":"length"}]}`, "attempt_1")
+	assert.ErrorIs(t, err, ErrCompletionTruncated)
+
+	_, err = extractCompletionContent(`{"choices":[{"message":{"content":"","refusal":"I can't help with that."},"finish_reason":"stop"}]}`, "attempt_2")
+	assert.ErrorIs(t, err, ErrCompletionRefused)
+	var completionErr *CompletionError
+	assert.True(t, errors.As(err, &completionErr))
+	assert.Equal(t, "attempt_2", completionErr.Phase)
+	assert.Equal(t, "I can't help with that.", completionErr.Refusal)
+
+	_, err = extractCompletionContent(`{"choices":[]}`, "attempt_3")
+	assert.Error(t, err)
+}
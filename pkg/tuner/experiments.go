@@ -0,0 +1,56 @@
+package tuner
+
+import (
+	"pdfinspector/pkg/job"
+	"time"
+)
+
+const EXPERIMENT_OUTCOME_FILENAME = "experiment.json"
+
+// saveExperimentOutcome records how a job that was part of a prompt experiment went, next to its outputs and
+// (on gcs) under the experiment's prefix where the report endpoint gathers them up. Jobs outside experiments are left alone.
+func (t *Tuner) saveExperimentOutcome(j *job.Job, results []inspectResult, best int, jobErr error) {
+	if j.Experiment == "" {
+		return
+	}
+	outcome := newExperimentOutcome(j, results, best, jobErr)
+	outcomeJSON, err := serializeToJSON(outcome)
+	if err != nil {
+		j.Log().Error().Msgf("Error serializing experiment outcome: %v", err)
+		return
+	}
+	t.saveJobOutputFile(j, EXPERIMENT_OUTCOME_FILENAME, outcomeJSON)
+	if t.config.FsType == "gcs" {
+		err = t.Fs.WriteFile(job.ExperimentOutcomePath(j.Experiment, j.Variant, j.Id), []byte(outcomeJSON))
+		if err != nil {
+			j.Log().Error().Msgf("Error writing experiment outcome to GCS: %v", err)
+		}
+	}
+}
+
+// best is the index of the attempt that was picked, -1 if none were.
+func newExperimentOutcome(j *job.Job, results []inspectResult, best int, jobErr error) *job.ExperimentOutcome {
+	outcome := &job.ExperimentOutcome{
+		Experiment:    j.Experiment,
+		Variant:       j.Variant,
+		PromptVersion: j.PromptVersion,
+		JobId:         j.Id,
+		Layout:        j.Layout,
+		Attempts:      len(results),
+		Created:       time.Now(),
+	}
+	if jobErr != nil {
+		outcome.Error = jobErr.Error()
+	}
+	if j.Usage != nil {
+		totals := j.Usage.Totals()
+		outcome.TotalTokens = totals.TotalTokens
+		outcome.EstimatedCostUSD = totals.EstimatedCostUSD
+	}
+	if best >= 0 {
+		outcome.NumberOfPages = results[best].NumberOfPages
+		outcome.LastPageContentRatio = results[best].LastPageContentRatio
+		outcome.Converged = lengthIsAcceptable(results[best], lengthGoalForJob(j.TargetPages, j.AcceptableRatio))
+	}
+	return outcome
+}
@@ -0,0 +1,104 @@
+package tuner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/document"
+	"pdfinspector/pkg/job"
+	"strings"
+)
+
+// OutputFormat is a format the final resume is saved in. They're all saved next to each other as Output.<format>,
+// the PDF from the renderer and the rest made straight from the best attempts resumedata (see saveExports).
+type OutputFormat struct {
+	Name     string
+	MimeType string
+
+	export func(doc *document.Document, page document.PageSetup) ([]byte, error) //nil for the PDF, which is rendered rather than exported
+}
+
+const OUTPUT_FORMAT_PDF = "pdf"
+
+// OUTPUT_FORMATS are in the order they get listed in, pdf first.
+var OUTPUT_FORMATS = []OutputFormat{
+	{Name: OUTPUT_FORMAT_PDF, MimeType: "application/pdf"},
+	{Name: "docx", MimeType: document.DOCX_MIME_TYPE, export: (*document.Document).RenderDOCX},
+	{Name: "txt", MimeType: "text/plain; charset=utf-8", export: textOnly((*document.Document).RenderText)},
+	{Name: "md", MimeType: "text/markdown; charset=utf-8", export: textOnly((*document.Document).RenderMarkdown)},
+}
+
+// textOnly is for the formats that don't have pages.
+func textOnly(export func(doc *document.Document) ([]byte, error)) func(doc *document.Document, page document.PageSetup) ([]byte, error) {
+	return func(doc *document.Document, page document.PageSetup) ([]byte, error) {
+		return export(doc)
+	}
+}
+
+// pageSetup is the jobs print options as the paper and margins for the formats that have pages.
+func pageSetup(print job.PrintOptions) document.PageSetup {
+	paper := print.Paper()
+	top, right, bottom, left := print.Margins()
+	return document.PageSetup{Width: paper.Width, Height: paper.Height, Top: top, Right: right, Bottom: bottom, Left: left}
+}
+
+func GetOutputFormat(name string) (OutputFormat, bool) {
+	for _, format := range OUTPUT_FORMATS {
+		if format.Name == strings.ToLower(name) {
+			return format, true
+		}
+	}
+	return OutputFormat{}, false
+}
+
+// Filename is where the format is saved in the jobs outputs, eg Output.docx.
+func (f OutputFormat) Filename() string {
+	return strings.TrimSuffix(TUNER_DEFAULT_OUTPUT_FILENAME, filepath.Ext(TUNER_DEFAULT_OUTPUT_FILENAME)) + "." + f.Name
+}
+
+// saveExports saves the attempt in each of the formats other than the PDF, on the same paper as the PDF, and returns all
+// the formats there are for the job now (the PDF included). A format that fails is logged and left out, the PDF is still worth having without it.
+func (t *Tuner) saveExports(j *job.Job, attempt int) []string {
+	formats := []string{OUTPUT_FORMAT_PDF}
+	resumedata, err := os.ReadFile(filepath.Join(j.OutputDir, fmt.Sprintf("attempt%d.json", attempt)))
+	if err != nil {
+		j.Log().Error().Msgf("Error reading attempt %d resumedata for exports: %v", attempt, err)
+		return formats
+	}
+	doc, err := document.Decode(resumedata)
+	if err != nil {
+		j.Log().Error().Msgf("Error decoding attempt %d resumedata for exports: %v", attempt, err)
+		return formats
+	}
+	for _, format := range OUTPUT_FORMATS {
+		if format.export == nil {
+			continue
+		}
+		content, err := format.export(doc, pageSetup(j.PrintOptions))
+		if err != nil {
+			j.Log().Error().Msgf("Error exporting attempt %d to %s: %v", attempt, format.Name, err)
+			continue
+		}
+		t.saveJobOutputFile(j, format.Filename(), string(content))
+		formats = append(formats, format.Name)
+	}
+	return formats
+}
+
+// GenerationRecord is what gets written to the sso generation marker, so the generations list can say which formats
+// there are without looking through the outputs.
+type GenerationRecord struct {
+	Formats []string `json:"formats"`
+}
+
+// ParseGenerationRecord reads a generation marker. Generations from before there were other formats have an empty one,
+// and only ever had the PDF.
+func ParseGenerationRecord(content []byte) GenerationRecord {
+	var record GenerationRecord
+	err := json.Unmarshal(content, &record)
+	if err != nil || len(record.Formats) == 0 {
+		return GenerationRecord{Formats: []string{OUTPUT_FORMAT_PDF}}
+	}
+	return record
+}
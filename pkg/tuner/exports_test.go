@@ -0,0 +1,78 @@
+package tuner
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"testing"
+)
+
+func TestSaveExports(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Layout = "chrono"
+	assert.NoError(t, WriteAttemptResumedataJSON(validChronoResponse, testJob, 1))
+
+	formats := tuner.saveExports(testJob, 1)
+	assert.Equal(t, []string{"pdf", "docx", "txt", "md"}, formats)
+	docx, err := os.ReadFile(filepath.Join(testJob.OutputDir, "Output.docx"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "PK", string(docx[:2]), "a docx is a zip")
+	}
+	text, err := os.ReadFile(filepath.Join(testJob.OutputDir, "Output.txt"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(text), "EXPERIENCE\n")
+	}
+	markdown, err := os.ReadFile(filepath.Join(testJob.OutputDir, "Output.md"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(markdown), "## Experience\n")
+	}
+
+	assert.Equal(t, []string{"pdf"}, tuner.saveExports(testJob, 2), "no resumedata for attempt 2, so only the PDF")
+}
+
+func TestSaveExportsPutsTheDOCXOnTheJobsPaper(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	testJob.Layout = "chrono"
+	margin := 1.0
+	testJob.PrintOptions = job.PrintOptions{PaperSize: "a4", MarginTop: &margin}
+	assert.NoError(t, WriteAttemptResumedataJSON(validChronoResponse, testJob, 1))
+
+	tuner.saveExports(testJob, 1)
+	docx, err := os.ReadFile(filepath.Join(testJob.OutputDir, "Output.docx"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	archive, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	reader, err := archive.Open("word/document.xml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := io.ReadAll(reader)
+	assert.Contains(t, string(body), `<w:pgSz w:w="11909" w:h="16848"/><w:pgMar w:top="1440" w:right="562" w:bottom="562" w:left="562"`)
+}
+
+func TestOutputFormats(t *testing.T) {
+	format, ok := GetOutputFormat("DOCX")
+	if assert.True(t, ok) {
+		assert.Equal(t, "Output.docx", format.Filename())
+	}
+	format, _ = GetOutputFormat(OUTPUT_FORMAT_PDF)
+	assert.Equal(t, TUNER_DEFAULT_OUTPUT_FILENAME, format.Filename())
+	_, ok = GetOutputFormat("xls")
+	assert.False(t, ok)
+}
+
+func TestParseGenerationRecord(t *testing.T) {
+	assert.Equal(t, []string{"pdf", "docx"}, ParseGenerationRecord([]byte(`{"formats":["pdf","docx"]}`)).Formats)
+	assert.Equal(t, []string{"pdf"}, ParseGenerationRecord(nil).Formats, "older generations only have the PDF")
+	assert.Equal(t, []string{"pdf"}, ParseGenerationRecord([]byte("nonsense")).Formats)
+}
@@ -1,6 +1,7 @@
 package tuner
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
 	"strings"
+	"time"
 )
 
 type ResumeExtractResult struct {
@@ -24,12 +28,48 @@ type ResumeExtractionJob struct {
 	Layout        string
 	UseSystemGs   bool
 	UserID        string
+	Usage         *job.UsageSummary
+	PromptVersion string //filled in with the exact prompts used, see prompts.Set.ID
+
+	//model settings, leave empty/nil/0 for the layout defaults and then the server config, same as a tuning job
+	Temperature *float64
+	MaxTokens   int
+
+	Budget          job.Budget //whatever isn't set comes from the server defaults
+	BudgetExhausted string     //which budget ran out, if extraction stopped early because of one
+	started         time.Time
+}
+
+// extractTemperature is the jobs temperature if it has one, then the layouts, then the server default.
+func (t *Tuner) extractTemperature(job *ResumeExtractionJob) float64 {
+	if job.Temperature != nil {
+		return *job.Temperature
+	}
+	defaults, err := t.GetLayoutDefaults(job.Layout)
+	if err == nil && defaults.Temperature != nil {
+		return *defaults.Temperature
+	}
+	return t.config.LLMTemperature
+}
+
+// extractMaxTokens is the jobs max tokens per call if it has one, then the layouts, then the server default.
+func (t *Tuner) extractMaxTokens(job *ResumeExtractionJob) int {
+	if job.MaxTokens != 0 {
+		return job.MaxTokens
+	}
+	defaults, err := t.GetLayoutDefaults(job.Layout)
+	if err == nil && defaults.MaxTokens != 0 {
+		return defaults.MaxTokens
+	}
+	return t.config.LLMMaxTokens
 }
 
 const MIN_ACCEPTABLE_RATIO = float64(0.9)
 const MAX_ACCEPTABLE_RATIO = float64(1.1)
 
-func (t *Tuner) ExtractResumeContents(job *ResumeExtractionJob, updates chan job.JobStatus) (*ResumeExtractResult, error) {
+func (t *Tuner) ExtractResumeContents(ctx context.Context, job *ResumeExtractionJob, updates chan job.JobStatus) (*ResumeExtractResult, error) {
+	job.started = time.Now()
+	job.Budget.Fill(t.DefaultExtractionBudget())
 	SendJobUpdate(updates, "getting idk")
 	expectResponseSchema, err := t.GetExpectedResponseJsonSchema(job.Layout)
 	if err != nil {
@@ -64,14 +104,14 @@ func (t *Tuner) ExtractResumeContents(job *ResumeExtractionJob, updates chan job
 	// MSYS_NO_PATHCONV=1 docker run --rm -v /$(pwd)/output:/workspace minidocks/ghostscript:latest gs -sDEVICE=pngalpha -o /workspace/out-%03d.png -r144 /workspace/attempt.pdf
 	var cmd *exec.Cmd
 	if job.UseSystemGs {
-		cmd = exec.Command(
+		cmd = exec.CommandContext(ctx,
 			"gs",
 			"-sDEVICE=txtwrite",
 			"-o", filepath.Join(outputDirFullpath, "pdf-txtwrite.txt"),
 			filepath.Join(outputDirFullpath, "input.pdf"),
 		)
 	} else {
-		cmd = exec.Command("docker", "run", "--rm",
+		cmd = exec.CommandContext(ctx, "docker", "run", "--rm",
 			"-v", fmt.Sprintf("%s:/workspace", outputDirFullpath),
 			"minidocks/ghostscript:latest",
 			"gs",
@@ -111,7 +151,19 @@ func (t *Tuner) ExtractResumeContents(job *ResumeExtractionJob, updates chan job
 	}
 	log.Trace().Msgf("read this from text file: %s", string(fileBytes))
 	job.extractedText = string(fileBytes)
-	resumeExtractionToLayoutRawJSONText, err := t.openAIResumeExtraction(job, outputDirFullpath)
+	resumeExtractionToLayoutRawJSONText, err := t.openAIResumeExtraction(ctx, job, outputDirFullpath, updates)
+	if job.Usage != nil {
+		usageJSON, serializeErr := serializeToJSON(job.Usage)
+		if serializeErr == nil {
+			serializeErr = WriteValidatedContent(usageJSON, filepath.Join(outputDirFullpath, USAGE_FILENAME))
+		}
+		if serializeErr != nil {
+			log.Error().Msgf("Error writing extraction usage summary: %v", serializeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
 	return &ResumeExtractResult{
 		ResumeJSONRaw:  resumeExtractionToLayoutRawJSONText,
 		ExpectedSchema: expectResponseSchema,
@@ -123,65 +175,85 @@ type extractAttempt struct {
 	lengthRatioRelatedToInput float64
 }
 
-func (t *Tuner) openAIResumeExtraction(job *ResumeExtractionJob, outputDir string) (string, error) {
+func (t *Tuner) openAIResumeExtraction(ctx context.Context, job *ResumeExtractionJob, outputDir string, updates chan job.JobStatus) (string, error) {
 	expectResponseSchema, err := t.GetExpectedResponseJsonSchema(job.Layout)
 	if err != nil {
 		return "", err
 	}
 
-	mainExtractPrompt1 := "Inspect the following resume text and extract all relevant details pertaining to all fields of the included json schema. The response should pay careful attention to mapping input data to sensible output fields and formats while including as much information from the resume text data as possible. "
-	extractPrompts := map[string]string{
-		"chrono":     "Pay attention to the timeline of work history companies and the project work done at each of them. ",
-		"functional": "Pay attention to the general concepts behind the work and projects that were done and be sure to come up with several functional area titles and multiple key contributions within each functional area. ",
+	defaults, err := t.GetLayoutDefaults(job.Layout)
+	if err != nil {
+		return "", err
 	}
-	mainExtractPrompt2 := "The goal is to extract as much information as possible and create a repository of resume data spanning the entire career. "
-	perLayoutExtractPrompt, ok := extractPrompts[job.Layout]
-	if !ok {
+	if defaults.ExtractPromptTemplate == "" {
 		return "", errors.New("could not get main extract prompt?!")
 	}
-	prompt_parts := []string{
-		mainExtractPrompt1,
-		perLayoutExtractPrompt,
-		mainExtractPrompt2,
-		"\n--- start resume text data ---\n",
-		job.extractedText,
-		"\n--- end resume text data ---\n",
+	promptSet, err := t.Prompts.Set(t.config.PromptSet)
+	if err != nil {
+		return "", err
+	}
+	job.PromptVersion = promptSet.ID()
+	log.Info().Msgf("extraction using prompts %s", job.PromptVersion)
+	err = WriteValidatedContent(job.PromptVersion+"\n", filepath.Join(outputDir, PROMPT_VERSION_FILENAME))
+	if err != nil {
+		log.Error().Msgf("Error writing extraction prompt version: %v", err)
+	}
+
+	prompt, err := promptSet.Render(defaults.ExtractPromptTemplate, prompts.Data{Layout: job.Layout, ResumeText: job.extractedText})
+	if err != nil {
+		return "", err
+	}
+	systemPrompt, err := promptSet.Render(PROMPT_EXTRACT_SYSTEM, prompts.Data{})
+	if err != nil {
+		return "", err
 	}
-	prompt := strings.Join(prompt_parts, "")
 
 	roboTries := 0
-	maxRoboTries := 7
 	targetLength := len(stripStringOfWhiteSpace(job.extractedText))
 	var content string
 
-	apiMessages := []map[string]interface{}{
+	apiMessages := []llm.ChatMessage{
 		{
-			"role":    "system",
-			"content": "You are a helpful resume data extraction assistant. The goal is total information extraction. Array fields in the output should be used to their fullest capability.",
+			Role:    "system",
+			Content: systemPrompt,
 		},
 		{
-			"role":    "user",
-			"content": prompt,
+			Role:    "user",
+			Content: prompt,
 		},
 	}
-	data := map[string]interface{}{
-		//"model": "gpt-4o",
-		"model":    "gpt-4o-mini",
-		"messages": apiMessages,
-		"response_format": map[string]interface{}{
-			"type": "json_schema",
-			"json_schema": map[string]interface{}{
-				"name":   "candidate_resume",
-				"strict": true,
-				"schema": expectResponseSchema,
-			},
+	data := &llm.ChatRequest{
+		//Model: "gpt-4o",
+		Model:    t.getExtractModel(job.Layout),
+		Messages: apiMessages,
+		ResponseSchema: &llm.ResponseSchema{
+			Name:   "candidate_resume",
+			Strict: true,
+			Schema: expectResponseSchema,
 		},
-		"temperature": 0.7,
-		//"temperature": 1.0,
-		"user": job.UserID,
+		Temperature: t.extractTemperature(job),
+		MaxTokens:   t.extractMaxTokens(job),
+		//Temperature: 1.0,
+		User: job.UserID,
+	}
+	truncatedPrompt, err := promptSet.Render(PROMPT_EXTRACT_TRUNCATED, prompts.Data{})
+	if err != nil {
+		return "", err
 	}
 	var attemptsOutput []extractAttempt
+	var lastUnusableErr error //the last completion that was cut off or refused, or output that couldn't be repaired to match the schema
 	for {
+		if roboTries >= job.Budget.MaxAttempts {
+			log.Info().Msgf("tried enough now, stopping after %d extraction attempt(s)", roboTries)
+			break
+		}
+		exhausted := job.Budget.Exhausted(job.started, job.Usage.Totals().TotalTokens)
+		if exhausted != "" {
+			log.Info().Msgf("extraction %s budget exhausted after %d attempt(s)", exhausted, roboTries)
+			job.BudgetExhausted = exhausted
+			sendBudgetExhausted(updates, job.Budget, exhausted)
+			break
+		}
 		roboTries++
 		// doooo
 
@@ -194,32 +266,34 @@ func (t *Tuner) openAIResumeExtraction(job *ResumeExtractionJob, outputDir strin
 			return "", fmt.Errorf("Failed to log api request locally: %v", err)
 		}
 
-		exists, output, err := checkForPreexistingAPIOutput(outputDir, "api_response_raw", roboTries)
+		output, err := t.makeAPIRequest(ctx, data, roboTries, "api_response_raw", outputDir, job.Usage, fmt.Sprintf("extraction_%d", roboTries), updates)
 		if err != nil {
-			return "", fmt.Errorf("Error checking for pre-existing API output: %v", err)
-		}
-		if !exists {
-			output, err = t.makeAPIRequest(data, roboTries, "api_response_raw", outputDir)
-			if err != nil {
-				log.Error().Msgf("openai request had error: %s", err.Error())
-				return "", err
-			}
+			log.Error().Msgf("openai request had error: %s", err.Error())
+			return "", err
 		}
 
 		//openai api should have responded to our request with a json text that can be used as resumedata input. extract it.
-		var apiResponse APIResponse
-		err = json.Unmarshal([]byte(output), &apiResponse)
+		content, err = extractCompletionContent(output, fmt.Sprintf("extraction_%d", roboTries))
+		var completionErr *CompletionError
+		if errors.As(err, &completionErr) {
+			lastUnusableErr = err
+			if errors.Is(err, ErrCompletionTruncated) {
+				//same as tuning, nothing useful to show it from a cut off response so ask again from the original prompt for less.
+				SendJobUpdate(updates, fmt.Sprintf("extraction %d response was cut off, asking again for shorter output", roboTries))
+				data.Messages = append(apiMessages[:len(apiMessages):len(apiMessages)], llm.ChatMessage{
+					Role:    "user",
+					Content: truncatedPrompt,
+				})
+				continue
+			}
+			//a refusal is unlikely to change by asking again. go with the best earlier attempt, if there was one.
+			SendJobUpdate(updates, fmt.Sprintf("extraction %d: %v", roboTries, err))
+			break
+		}
 		if err != nil {
-			log.Error().Msgf("Error deserializing API response: %v", err)
+			log.Error().Msgf("Error extracting content from API response: %v", err)
 			return "", err
 		}
-
-		//Extract the message content
-		if len(apiResponse.Choices) == 0 {
-			return "", errors.New("no choices found in the API response")
-		}
-
-		content = apiResponse.Choices[0].Message.Content
 		//write the response here so that if there is an error with it we can see what it was ??
 
 		err = validateJSON(content)
@@ -227,7 +301,18 @@ func (t *Tuner) openAIResumeExtraction(job *ResumeExtractionJob, outputDir strin
 			log.Error().Msgf("Error validating JSON content: %v", err)
 			return "", err
 		}
-		log.Info().Msgf("Got %d bytes of JSON content (at least well formed enough to be decodable) out of that last response", len(content))
+		content, err = t.repairAgainstSchema(ctx, data, content, job.Layout, promptSet, roboTries, outputDir, job.Usage, fmt.Sprintf("extraction_%d", roboTries), updates)
+		var schemaErr *SchemaValidationError
+		if errors.As(err, &schemaErr) {
+			//not worth keeping as an attempt, just ask again the same way
+			lastUnusableErr = err
+			SendJobUpdate(updates, fmt.Sprintf("extraction %d never matched the schema", roboTries))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		log.Info().Msgf("Got %d bytes of JSON content (matching the %s schema) out of that last response", len(content), job.Layout)
 
 		var results interface{}
 		err = json.Unmarshal([]byte(content), &results)
@@ -247,43 +332,48 @@ func (t *Tuner) openAIResumeExtraction(job *ResumeExtractionJob, outputDir strin
 			content:                   content,
 			lengthRatioRelatedToInput: ratioExtractToInput,
 		})
-		if roboTries >= maxRoboTries {
-			log.Info().Msgf("tried enough now, stopping.")
-			break
-		}
-
-		tryAgain := false
-		tryAgainPrompt := ""
+		var tryAgainTemplate string
+		var promptData prompts.Data
 		if ratioExtractToInput < MIN_ACCEPTABLE_RATIO {
-			tryAgain = true
-			increaseByPct := int(((float64(targetLength) / float64(extractedContentsStrippedLength)) - 1) * 100)
-			tryAgainPrompt = fmt.Sprintf("extraction was too short, please try again and increase the total output length by ~%d percent, retaining as much relevant information as possible. ", increaseByPct)
-			log.Info().Msgf("we should ask it to try to get more by asking: '%s'", tryAgainPrompt)
+			tryAgainTemplate = PROMPT_EXTRACT_TOO_SHORT
+			promptData.IncreaseByPct = int(((float64(targetLength) / float64(extractedContentsStrippedLength)) - 1) * 100)
 		}
 		if ratioExtractToInput > MAX_ACCEPTABLE_RATIO {
-			tryAgain = true
-			reduceByPct := int((1.0 - (1.0 / ratioExtractToInput)) * 100.0)
-			tryAgainPrompt = fmt.Sprintf("extraction was too long, please try again and reduce the total output length by ~%d percent, while still retaining as much relevant information as possible. ", reduceByPct)
-			log.Info().Msgf("we should ask it to try to get less by asking: '%s'", tryAgainPrompt)
+			tryAgainTemplate = PROMPT_EXTRACT_TOO_LONG
+			promptData.ReduceByPct = int((1.0 - (1.0 / ratioExtractToInput)) * 100.0)
 		}
 
-		if !tryAgain {
+		if tryAgainTemplate == "" {
 			log.Info().Msgf("good enough?")
 			break
 		}
+		tryAgainPrompt, err := promptSet.Render(tryAgainTemplate, promptData)
+		if err != nil {
+			return "", err
+		}
+		log.Info().Msgf("we should ask it to try again by asking: '%s'", tryAgainPrompt)
 
 		log.Info().Msgf("going to try again ...")
-		data["messages"] = append(apiMessages, []map[string]interface{}{
+		data.Messages = append(apiMessages[:len(apiMessages):len(apiMessages)], []llm.ChatMessage{
 			{
-				"role":    "assistant",
-				"content": content,
+				Role:    "assistant",
+				Content: content,
 			}, {
-				"role":    "user",
-				"content": tryAgainPrompt,
+				Role:    "user",
+				Content: tryAgainPrompt,
 			},
 		}...)
 	}
 
+	if len(attemptsOutput) == 0 && lastUnusableErr != nil {
+		return "", lastUnusableErr
+	}
+	if len(attemptsOutput) == 0 && job.BudgetExhausted != "" {
+		return "", fmt.Errorf("%w: used up the %s budget of %s before anything was extracted", ErrBudgetExhausted, job.BudgetExhausted, describeBudget(job.Budget, job.BudgetExhausted))
+	}
+	if len(attemptsOutput) == 0 {
+		return "", fmt.Errorf("nothing was extracted in %d attempt(s)", roboTries)
+	}
 	//this is just a string atm dunno if thats good enough lol
 	return getBestAttemptedExtract(attemptsOutput).content, nil
 }
@@ -6,6 +6,7 @@
 package tuner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -42,6 +43,10 @@ func getSchemasDir() string {
 	wd, _ := os.Getwd()
 	return filepath.Join(wd, "..", "..", "response_templates")
 }
+func getPromptsDir() string {
+	wd, _ := os.Getwd()
+	return filepath.Join(wd, "..", "..", "prompts")
+}
 func getTestAPIKey() string {
 	//well, actually a real api key b/c we are going to use the actual api here.
 	apiKey := os.Getenv("OPENAI_API_KEY")
@@ -83,21 +88,24 @@ func TestOpenAIResumeExtractProducesRoughlyTheCorrectLengthImportedJSON(t *testi
 	charLen := len(fixtureStripped)
 	t.Logf("Loaded %d chars of space-stripped-input", charLen)
 	//engage the 'ai extraction' process
-	testTuner := &Tuner{
-		config: &config.ServiceConfig{
-			SchemasPath:  schemasDir,
-			OpenAiApiKey: testApiKey,
-		},
-		Fs: nil,
-	}
+	testTuner := NewTuner(&config.ServiceConfig{
+		SchemasPath:    schemasDir,
+		PromptsPath:    getPromptsDir(),
+		PromptSet:      "default",
+		OpenAiApiKey:   testApiKey,
+		LLMModel:       "gpt-4o-mini",
+		LLMTemperature: 0.7,
+		LLMMaxRetries:  4,
+		LLMCallTimeout: 180,
+	})
 
-	resultContentJSON, err := testTuner.openAIResumeExtraction(&ResumeExtractionJob{
+	resultContentJSON, err := testTuner.openAIResumeExtraction(context.Background(), &ResumeExtractionJob{
 		FileContent:   nil,
 		extractedText: fixture,
 		Layout:        "functional",
 		UseSystemGs:   false,
 		UserID:        "test-user",
-	}, testOutputDir)
+	}, testOutputDir, nil)
 	if err != nil {
 		t.Fatal(err.Error())
 	}
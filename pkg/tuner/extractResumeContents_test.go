@@ -1,9 +1,15 @@
 package tuner
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
 	"testing"
+	"time"
 )
 
 // TestGuessCandidateName tests the GuessCandidateName function using sample data
@@ -155,3 +161,41 @@ func TestGetBestAttemptExtractPicksLeastBadFromCloseToTarget(t *testing.T) {
 	best := getBestAttemptedExtract(attempts)
 	assert.Equal(t, 0.8, best.lengthRatioRelatedToInput)
 }
+
+func TestResumeExtractionAsksAgainForLessWhenCutOff(t *testing.T) {
+	fake := llm.NewFakeClient()
+	fake.Handler = func(request *llm.ChatRequest) (*llm.ChatResponse, error) {
+		if len(fake.Requests) == 1 {
+			return &llm.ChatResponse{Choices: []llm.ChatChoice{{Message: llm.ChatMessage{Role: "assistant", Content: `{"skills": [`}, FinishReason: "length"}}}, nil
+		}
+		return &llm.ChatResponse{Choices: []llm.ChatChoice{{Message: llm.ChatMessage{Role: "assistant", Content: validChronoResponse}, FinishReason: "stop"}}}, nil
+	}
+	tuner, set := schemaTestTuner(t, fake)
+	decoded, err := DecodeJSON(validChronoResponse)
+	assert.NoError(t, err)
+	extraction := &ResumeExtractionJob{Layout: "chrono", Usage: job.NewUsageSummary(), Budget: job.Budget{MaxAttempts: 3}, started: time.Now()}
+	extraction.extractedText = ExtractText(decoded)
+
+	content, err := tuner.openAIResumeExtraction(context.Background(), extraction, t.TempDir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, validChronoResponse, content)
+	if assert.Len(t, fake.Requests, 2) {
+		truncated, _ := set.Render(PROMPT_EXTRACT_TRUNCATED, prompts.Data{})
+		sent := fake.Requests[1].Messages
+		assert.Len(t, sent, 3, "asked again from the original prompt")
+		assert.Equal(t, truncated, sent[2].Content)
+	}
+}
+
+func TestResumeExtractionStopsOnARefusal(t *testing.T) {
+	fake := llm.NewFakeClient()
+	fake.Handler = func(request *llm.ChatRequest) (*llm.ChatResponse, error) {
+		return &llm.ChatResponse{Choices: []llm.ChatChoice{{Message: llm.ChatMessage{Role: "assistant", Refusal: "no thanks"}, FinishReason: "stop"}}}, nil
+	}
+	tuner, _ := schemaTestTuner(t, fake)
+	extraction := &ResumeExtractionJob{Layout: "chrono", Usage: job.NewUsageSummary(), Budget: job.Budget{MaxAttempts: 3}, started: time.Now(), extractedText: "Sam"}
+
+	_, err := tuner.openAIResumeExtraction(context.Background(), extraction, t.TempDir(), nil)
+	assert.True(t, errors.Is(err, ErrCompletionRefused))
+	assert.Len(t, fake.Requests, 1)
+}
@@ -0,0 +1,276 @@
+package tuner
+
+import (
+	"context"
+	"fmt"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The fabrication guard diffs tuned resumedata against the baseline it came from, and flags the kinds of things a model
+// tends to make up when asked to fit a job description: employers, schools, dates, degrees and figures.
+// It's a plain text comparison, so a reworded employer name gets flagged too. That's on purpose, better a false alarm.
+const FABRICATION_REPORT_FILENAME = "fabrication_report.json"
+
+const (
+	FABRICATED_EMPLOYER    = "employer"
+	FABRICATED_INSTITUTION = "institution"
+	FABRICATED_DATE        = "date"
+	FABRICATED_DEGREE      = "degree"
+	FABRICATED_NUMBER      = "number"
+)
+
+// numbers in text, with any thousands separators or decimals. Single digits are too common ("3 teams") to be worth flagging.
+var numberPattern = regexp.MustCompile(`\d[\d,]*(\.\d+)?`)
+
+type fabricationReportEntry struct {
+	Attempt   int                      `json:"attempt"`
+	Corrected bool                     `json:"corrected"` //a revert turn was run for this attempt, the warnings are whatever survived it
+	Warnings  []job.FabricationWarning `json:"warnings"`
+}
+
+// stringLeaf is a string somewhere in decoded resumedata, along with where it was.
+type stringLeaf struct {
+	path    string //eg work_history[2].company
+	section string //the top level key it's under
+	key     string //the key it's directly under, "" in an array of strings
+	value   string
+}
+
+func stringLeaves(data interface{}) []stringLeaf {
+	var leaves []stringLeaf
+	var walk func(d interface{}, path, section, key string)
+	walk = func(d interface{}, path, section, key string) {
+		switch v := d.(type) {
+		case string:
+			leaves = append(leaves, stringLeaf{path: path, section: section, key: key, value: v})
+		case []interface{}:
+			for i, item := range v {
+				walk(item, fmt.Sprintf("%s[%d]", path, i), section, "")
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				childPath, childSection := k, section
+				if path != "" {
+					childPath = path + "." + k
+				} else {
+					childSection = k
+				}
+				walk(v[k], childPath, childSection, k)
+			}
+		}
+	}
+	walk(data, "", "", "")
+	return leaves
+}
+
+// factKind says which kind of fact a leaf is, or "" if it's just prose (which only gets its numbers checked).
+func factKind(leaf stringLeaf) string {
+	switch leaf.key {
+	case "company":
+		if leaf.section == "company_info" {
+			return "" //the company a cover letter is addressed to comes from the job description
+		}
+		return FABRICATED_EMPLOYER
+	case "institution":
+		return FABRICATED_INSTITUTION
+	case "daterange", "graduated":
+		return FABRICATED_DATE
+	case "description":
+		if strings.HasPrefix(leaf.section, "education") {
+			return FABRICATED_DEGREE
+		}
+	}
+	return ""
+}
+
+// normalizeFact is for comparing facts without caring about case, spacing or which sort of dash.
+func normalizeFact(kind, value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.NewReplacer("–", "-", "—", "-").Replace(value)
+	if kind == FABRICATED_DATE {
+		return strings.Join(strings.Fields(value), "")
+	}
+	return strings.Trim(strings.Join(strings.Fields(value), " "), ".,")
+}
+
+func numbersIn(text string) []string {
+	var numbers []string
+	for _, match := range numberPattern.FindAllString(text, -1) {
+		number := strings.TrimRight(strings.ReplaceAll(match, ",", ""), ".")
+		if len(number) < 2 {
+			continue
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+// findFabrications returns everything in the tuned resumedata that isn't backed by the sources (the baseline, plus any supplement).
+// Facts need to match a fact of the same kind in the sources, numbers just need to appear somewhere in them.
+// Contact details are left alone, a phone number isn't something anyone fabricates by accident.
+func findFabrications(tuned interface{}, sources ...interface{}) []job.FabricationWarning {
+	known := map[string]map[string]bool{}
+	knownNumbers := map[string]bool{}
+	for _, source := range sources {
+		for _, leaf := range stringLeaves(source) {
+			if kind := factKind(leaf); kind != "" {
+				if known[kind] == nil {
+					known[kind] = map[string]bool{}
+				}
+				known[kind][normalizeFact(kind, leaf.value)] = true
+			}
+			for _, number := range numbersIn(leaf.value) {
+				knownNumbers[number] = true
+			}
+		}
+	}
+
+	var warnings []job.FabricationWarning
+	seen := map[string]bool{}
+	flag := func(kind, path, value string) {
+		if seen[kind+"/"+value] {
+			return
+		}
+		seen[kind+"/"+value] = true
+		warnings = append(warnings, job.FabricationWarning{Kind: kind, Field: path, Value: value})
+	}
+	for _, leaf := range stringLeaves(tuned) {
+		if strings.TrimSpace(leaf.value) == "" || leaf.section == "personal_info" {
+			continue
+		}
+		if kind := factKind(leaf); kind != "" {
+			if !known[kind][normalizeFact(kind, leaf.value)] {
+				flag(kind, leaf.path, leaf.value)
+			}
+			continue
+		}
+		for _, number := range numbersIn(leaf.value) {
+			if !knownNumbers[number] {
+				flag(FABRICATED_NUMBER, leaf.path, number)
+			}
+		}
+	}
+	return warnings
+}
+
+// describeFabrications is the warnings as lines for the revert prompt.
+func describeFabrications(warnings []job.FabricationWarning) []string {
+	var descriptions []string
+	for _, warning := range warnings {
+		descriptions = append(descriptions, fmt.Sprintf("%s %q at %s", warning.Kind, warning.Value, warning.Field))
+	}
+	return descriptions
+}
+
+// fabricationSources decodes the baseline and any supplement, which is everything the tuned output is allowed to draw facts from.
+func fabricationSources(j *job.Job) []interface{} {
+	var sources []interface{}
+	baseline, err := DecodeJSON(j.BaselineJSON)
+	if err != nil {
+		return nil
+	}
+	sources = append(sources, baseline)
+	if len(j.SupplementData) > 0 {
+		supplement, err := DecodeJSON(string(j.SupplementData))
+		if err == nil {
+			sources = append(sources, supplement)
+		}
+	}
+	return sources
+}
+
+// fabricationsIn is findFabrications for a jobs content, nil if there's no baseline to check against or the content won't decode.
+func fabricationsIn(j *job.Job, content string) []job.FabricationWarning {
+	sources := fabricationSources(j)
+	if len(sources) == 0 {
+		return nil
+	}
+	decoded, err := DecodeJSON(content)
+	if err != nil {
+		return nil
+	}
+	return findFabrications(decoded, sources...)
+}
+
+// guardAgainstFabrications checks a candidates content against the baseline. If the job asks for it and anything was flagged,
+// the model gets one go at putting things back, which is kept only if it still decodes and fits the schema.
+// Returns the content to carry on with, and whether a revert turn was run.
+func (t *Tuner) guardAgainstFabrications(ctx context.Context, job *job.Job, request *llm.ChatRequest, content string, set *prompts.Set, slot int, phase string, updates chan job.JobStatus) (string, bool) {
+	warnings := fabricationsIn(job, content)
+	if len(warnings) == 0 || !job.RevertFabrications {
+		return content, false
+	}
+	job.Log().Info().Msgf("%s output has %d detail(s) not in the baseline, asking for them to be reverted", phase, len(warnings))
+	SendJobUpdate(updates, fmt.Sprintf("%s output has %d detail(s) not in the baseline, asking for them to be reverted", phase, len(warnings)))
+
+	revertPrompt, err := set.Render(PROMPT_REVERT_FABRICATED, prompts.Data{Fabrications: describeFabrications(warnings)})
+	if err != nil {
+		job.Log().Error().Msgf("Error rendering revert prompt: %v", err)
+		return content, false
+	}
+	revertRequest := *request
+	revertRequest.Messages = append(request.Messages[:len(request.Messages):len(request.Messages)], []llm.ChatMessage{
+		{
+			Role:    "assistant",
+			Content: content,
+		}, {
+			Role:    "user",
+			Content: revertPrompt,
+		},
+	}...)
+
+	revertPhase := phase + "_revert"
+	name := "api_response_revert_raw"
+	output, err := t.makeAPIRequest(ctx, &revertRequest, slot, name, job.OutputDir, job.Usage, revertPhase, updates)
+	var reverted string
+	if err == nil {
+		reverted, err = extractCompletionContent(output, revertPhase)
+	}
+	var revertedDecoded interface{}
+	if err == nil {
+		revertedDecoded, err = DecodeJSON(reverted)
+	}
+	if err == nil {
+		err = t.ValidateResumeData(job.Layout, revertedDecoded, false)
+	}
+	if err != nil {
+		//the unreverted output is still usable, the warnings just stand
+		job.Log().Info().Msgf("%s revert turn didn't give usable output, keeping the original: %v", phase, err)
+		return content, true
+	}
+	return reverted, true
+}
+
+// sendFabricationWarnings puts an attempts warnings in the job stream, structured so a client can show them next to the result.
+func sendFabricationWarnings(updates chan job.JobStatus, attempt int, warnings []job.FabricationWarning) {
+	if updates == nil || len(warnings) == 0 {
+		return
+	}
+	updates <- job.JobStatus{
+		Message:  fmt.Sprintf("attempt %d has %d detail(s) that aren't in the baseline resume", attempt, len(warnings)),
+		Warnings: warnings,
+	}
+}
+
+// saveFabricationReport writes what the guard found for each attempt next to the other outputs.
+func (t *Tuner) saveFabricationReport(j *job.Job, report []fabricationReportEntry) {
+	if len(report) == 0 {
+		return
+	}
+	reportJSON, err := serializeToJSON(report)
+	if err != nil {
+		j.Log().Error().Msgf("Error serializing fabrication report: %v", err)
+		return
+	}
+	t.saveJobOutputFile(j, FABRICATION_REPORT_FILENAME, reportJSON)
+}
@@ -0,0 +1,91 @@
+package tuner
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"strings"
+	"testing"
+)
+
+func TestFindFabrications(t *testing.T) {
+	baseline, err := DecodeJSON(validChronoResponse)
+	assert.NoError(t, err)
+	tuned, err := DecodeJSON(strings.NewReplacer(
+		`"company": "Acme"`, `"company": "Initech"`,
+		`"daterange": "2020 - now"`, `"daterange": "2018 - now"`,
+		`"description": "BSc"`, `"description": "MSc"`,
+		`"institution": "School"`, `"institution": " school. "`,
+		`"made things"`, `"made things 40% faster for 1,200 users in 3 teams"`,
+		`"phone": "555"`, `"phone": "556"`,
+	).Replace(validChronoResponse))
+	assert.NoError(t, err)
+
+	warnings := findFabrications(tuned, baseline)
+	assert.Equal(t, []job.FabricationWarning{
+		{Kind: FABRICATED_DEGREE, Field: "education_v2[0].description", Value: "MSc"},
+		{Kind: FABRICATED_EMPLOYER, Field: "work_history[0].company", Value: "Initech"},
+		{Kind: FABRICATED_DATE, Field: "work_history[0].daterange", Value: "2018 - now"},
+		{Kind: FABRICATED_NUMBER, Field: "work_history[0].projects[0].desc", Value: "40"},
+		{Kind: FABRICATED_NUMBER, Field: "work_history[0].projects[0].desc", Value: "1200"},
+	}, warnings, "the institution only differs in case and punctuation, single digits and contact details are left alone")
+
+	assert.Empty(t, findFabrications(baseline, baseline))
+}
+
+func TestFindFabricationsAllowsNumbersFromAnySource(t *testing.T) {
+	baseline, _ := DecodeJSON(validChronoResponse)
+	supplement, _ := DecodeJSON(`{"resumedata": {"summary": "grew signups by 40%"}}`)
+	tuned, _ := DecodeJSON(strings.Replace(validChronoResponse, `"made things"`, `"made things, grew signups 40%"`, 1))
+
+	assert.Len(t, findFabrications(tuned, baseline), 1)
+	assert.Empty(t, findFabrications(tuned, baseline, supplement))
+}
+
+func fabricationTestJob(t *testing.T) *job.Job {
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.OutputDir = t.TempDir()
+	testJob.BaselineJSON = validChronoResponse
+	return testJob
+}
+
+func TestGuardAgainstFabricationsRevertsWhenAsked(t *testing.T) {
+	fabricated := strings.Replace(validChronoResponse, `"company": "Acme"`, `"company": "Initech"`, 1)
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, set := schemaTestTuner(t, fake)
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	testJob := fabricationTestJob(t)
+	content, reverted := tuner.guardAgainstFabrications(context.Background(), testJob, request, fabricated, set, 0, "attempt_0", nil)
+	assert.False(t, reverted, "reverting is opt in")
+	assert.Equal(t, fabricated, content)
+	assert.Empty(t, fake.Requests)
+
+	testJob.RevertFabrications = true
+	content, reverted = tuner.guardAgainstFabrications(context.Background(), testJob, request, fabricated, set, 0, "attempt_0", nil)
+	assert.True(t, reverted)
+	assert.Equal(t, validChronoResponse, content)
+	if assert.Len(t, fake.Requests, 1) {
+		sent := fake.Requests[0].Messages
+		assert.Len(t, sent, 3)
+		assert.Equal(t, fabricated, sent[1].Content)
+		assert.Contains(t, sent[2].Content, `- employer "Initech" at work_history[0].company`)
+	}
+	assert.Empty(t, fabricationsIn(testJob, content))
+}
+
+func TestGuardAgainstFabricationsKeepsTheOriginalIfTheRevertIsUnusable(t *testing.T) {
+	fabricated := strings.Replace(validChronoResponse, `"company": "Acme"`, `"company": "Initech"`, 1)
+	fake := llm.NewFakeClient(`{"skills": ["go"]}`)
+	tuner, set := schemaTestTuner(t, fake)
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	testJob := fabricationTestJob(t)
+	testJob.RevertFabrications = true
+	content, reverted := tuner.guardAgainstFabrications(context.Background(), testJob, request, fabricated, set, 0, "attempt_0", nil)
+	assert.True(t, reverted)
+	assert.Equal(t, fabricated, content)
+	assert.Len(t, fabricationsIn(testJob, content), 1)
+}
@@ -0,0 +1,174 @@
+package tuner
+
+import (
+	"math"
+)
+
+// MIN_LENGTH_CHANGE_PCT is the smallest change we bother asking for, asking for 1% tends to get back exactly the same thing.
+const MIN_LENGTH_CHANGE_PCT = 3
+const MAX_REDUCE_PCT = 60
+const MAX_INCREASE_PCT = 100
+
+// LengthGoal is what the length controllers steer toward.
+type LengthGoal struct {
+	Pages           int     //every page but the last is full
+	AcceptableRatio float64 //the last page needs to be at least this full
+}
+
+func lengthGoalForJob(pages int, acceptableRatio float64) LengthGoal {
+	if pages < 1 {
+		pages = 1
+	}
+	return LengthGoal{Pages: pages, AcceptableRatio: acceptableRatio}
+}
+
+// LengthInstruction is what a LengthController wants done after an attempt. Stop means the attempt is good enough,
+// otherwise Template is the length correction prompt to send with the Reduce/IncreaseByPct it refers to.
+// An empty Template with no Stop just asks again with the same prompt.
+type LengthInstruction struct {
+	Stop          bool
+	Template      string
+	ReduceByPct   int
+	IncreaseByPct int
+}
+
+// Change is the relative change in length the instruction asks for, what ends up as the next attempts RequestedChange.
+func (i LengthInstruction) Change() float64 {
+	return float64(i.IncreaseByPct-i.ReduceByPct) / 100
+}
+
+// LengthController decides how to correct the length of the next attempt, given every attempt so far (the last one being the
+// most recent). Skipped attempts are in there too, to keep indexes lined up with attempt numbers, and should be ignored.
+type LengthController interface {
+	Next(history []inspectResult, goal LengthGoal) LengthInstruction
+}
+
+// defaultLengthController is used for layouts that don't pick one.
+var defaultLengthController LengthController = &ProportionalController{Gain: 0.5}
+
+// renderedLength puts an attempt on a single scale in pages, eg 1.3 is a full page and 30% of the next.
+func renderedLength(result inspectResult) float64 {
+	return float64(result.NumberOfPages-1) + result.LastPageContentRatio
+}
+
+// aimLength is where we'd like to land, halfway between just acceptable and a completely full last page.
+func aimLength(goal LengthGoal) float64 {
+	return float64(goal.Pages-1) + (goal.AcceptableRatio+1)/2
+}
+
+func lengthIsAcceptable(result inspectResult, goal LengthGoal) bool {
+	return result.NumberOfPages == goal.Pages && result.LastPageContentRatio >= goal.AcceptableRatio
+}
+
+func lastRenderedAttempt(history []inspectResult) (inspectResult, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].Skipped {
+			return history[i], true
+		}
+	}
+	return inspectResult{}, false
+}
+
+// instructionForChange turns a relative change in length (-0.2 is 20% shorter) into the prompt to ask for it with.
+func instructionForChange(last inspectResult, goal LengthGoal, change float64) LengthInstruction {
+	pct := int(math.Round(math.Abs(change) * 100))
+	if pct < MIN_LENGTH_CHANGE_PCT {
+		pct = MIN_LENGTH_CHANGE_PCT
+	}
+	if change < 0 {
+		if pct > MAX_REDUCE_PCT {
+			pct = MAX_REDUCE_PCT
+		}
+		if last.NumberOfPages > goal.Pages+1 {
+			//a percentage doesn't go over well when it's this far off, the too many pages prompt is more heavy handed.
+			return LengthInstruction{Template: PROMPT_TOO_MANY_PAGES, ReduceByPct: pct}
+		}
+		return LengthInstruction{Template: PROMPT_TOO_LONG, ReduceByPct: pct}
+	}
+	if pct > MAX_INCREASE_PCT {
+		pct = MAX_INCREASE_PCT
+	}
+	return LengthInstruction{Template: PROMPT_TOO_SHORT, IncreaseByPct: pct}
+}
+
+// ProportionalController asks for a change proportional to how far the last attempt was from the aim.
+// A Gain under 1 damps it, the model tends to overdo whatever it's asked for.
+type ProportionalController struct {
+	Gain float64
+}
+
+func (c *ProportionalController) Next(history []inspectResult, goal LengthGoal) LengthInstruction {
+	last, ok := lastRenderedAttempt(history)
+	if !ok {
+		return LengthInstruction{}
+	}
+	if lengthIsAcceptable(last, goal) {
+		return LengthInstruction{Stop: true}
+	}
+	length := renderedLength(last)
+	return instructionForChange(last, goal, c.Gain*(aimLength(goal)-length)/length)
+}
+
+// BisectionController uses the closest attempts so far on either side of the acceptable range. Once it has one of each
+// it aims halfway between them, so it can't keep swinging past the target like the proportional one can.
+// Until then it goes straight for the aim. It also keeps track of how hard the model responded to the last change it
+// asked for (asked for 20%, got 36%) and scales the next ask to suit.
+type BisectionController struct{}
+
+// the most we'll believe the model over or under does a change by, a single odd attempt shouldn't send the next ask off a cliff.
+const MIN_RESPONSIVENESS = 0.3
+const MAX_RESPONSIVENESS = 3.0
+
+func (c *BisectionController) Next(history []inspectResult, goal LengthGoal) LengthInstruction {
+	last, ok := lastRenderedAttempt(history)
+	if !ok {
+		return LengthInstruction{}
+	}
+	if lengthIsAcceptable(last, goal) {
+		return LengthInstruction{Stop: true}
+	}
+
+	over, under := math.Inf(1), math.Inf(-1)
+	for _, result := range history {
+		if result.Skipped {
+			continue
+		}
+		length := renderedLength(result)
+		if result.NumberOfPages > goal.Pages {
+			over = math.Min(over, length)
+		} else {
+			under = math.Max(under, length)
+		}
+	}
+
+	target := aimLength(goal)
+	if !math.IsInf(over, 1) && !math.IsInf(under, -1) {
+		target = (over + under) / 2
+	}
+	length := renderedLength(last)
+	return instructionForChange(last, goal, (target-length)/length/responsiveness(history))
+}
+
+// responsiveness is how the change we got compares to the change we asked for, between the last two rendered attempts.
+// 1 when there's nothing to go on.
+func responsiveness(history []inspectResult) float64 {
+	var rendered []inspectResult
+	for i := len(history) - 1; i >= 0 && len(rendered) < 2; i-- {
+		if !history[i].Skipped {
+			rendered = append(rendered, history[i])
+		}
+	}
+	if len(rendered) < 2 {
+		return 1
+	}
+	last, previous := rendered[0], rendered[1]
+	if last.RequestedChange == 0 {
+		return 1
+	}
+	got := renderedLength(last)/renderedLength(previous) - 1
+	ratio := got / last.RequestedChange
+	if ratio <= 0 {
+		return 1 //went the wrong way, nothing sensible to learn from that
+	}
+	return math.Max(MIN_RESPONSIVENESS, math.Min(MAX_RESPONSIVENESS, ratio))
+}
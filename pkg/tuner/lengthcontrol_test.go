@@ -0,0 +1,107 @@
+package tuner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProportionalControllerDampsTheCorrection(t *testing.T) {
+	controller := &ProportionalController{Gain: 0.5}
+	goal := LengthGoal{Pages: 1, AcceptableRatio: 0.88}
+
+	instruction := controller.Next([]inspectResult{{NumberOfPages: 2, LastPageContentRatio: 0.3}}, goal)
+	assert.Equal(t, LengthInstruction{Template: PROMPT_TOO_LONG, ReduceByPct: 14}, instruction)
+
+	instruction = controller.Next([]inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.6}}, goal)
+	assert.Equal(t, LengthInstruction{Template: PROMPT_TOO_SHORT, IncreaseByPct: 28}, instruction)
+
+	instruction = controller.Next([]inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.9}}, goal)
+	assert.True(t, instruction.Stop)
+}
+
+func TestBisectionControllerUsesBothSides(t *testing.T) {
+	controller := &BisectionController{}
+	goal := LengthGoal{Pages: 1, AcceptableRatio: 0.88}
+
+	//only been short so far, go straight for the aim
+	instruction := controller.Next([]inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.6}}, goal)
+	assert.Equal(t, LengthInstruction{Template: PROMPT_TOO_SHORT, IncreaseByPct: 57}, instruction)
+
+	//then overshot, so aim between the two. the skipped attempt doesn't count for anything.
+	instruction = controller.Next([]inspectResult{
+		{NumberOfPages: 1, LastPageContentRatio: 0.6},
+		{Skipped: true},
+		{NumberOfPages: 2, LastPageContentRatio: 0.3},
+	}, goal)
+	assert.Equal(t, LengthInstruction{Template: PROMPT_TOO_LONG, ReduceByPct: 27}, instruction)
+
+	instruction = controller.Next([]inspectResult{{NumberOfPages: 3, LastPageContentRatio: 0.2}}, goal)
+	assert.Equal(t, PROMPT_TOO_MANY_PAGES, instruction.Template)
+	assert.Equal(t, 57, instruction.ReduceByPct)
+}
+
+// a model that always does 1.8x whatever change it's asked for, which is about what we see in practice
+func simulateOvershootingModel(controller LengthController, start float64, attempts int) []inspectResult {
+	goal := LengthGoal{Pages: 1, AcceptableRatio: 0.88}
+	length := start
+	requested := 0.0
+	var history []inspectResult
+	for i := 0; i < attempts; i++ {
+		pages := int(length) + 1
+		history = append(history, inspectResult{NumberOfPages: pages, LastPageContentRatio: length - float64(pages-1), RequestedChange: requested})
+		instruction := controller.Next(history, goal)
+		if instruction.Stop {
+			break
+		}
+		requested = instruction.Change()
+		length = length * (1 + 1.8*requested)
+	}
+	return history
+}
+
+func TestResponsivenessSkipsSkippedAttempts(t *testing.T) {
+	//asked for 20% longer and got 40%, the truncated attempt in between doesn't break that up
+	history := []inspectResult{
+		{NumberOfPages: 1, LastPageContentRatio: 0.5},
+		{Skipped: true},
+		{NumberOfPages: 1, LastPageContentRatio: 0.7, RequestedChange: 0.2},
+		{Skipped: true},
+	}
+	assert.InDelta(t, 2.0, responsiveness(history), 0.001)
+	assert.Equal(t, 1.0, responsiveness(history[:2]), "only one rendered attempt")
+}
+
+func TestBisectionControllerConvergesWithAnOvershootingModel(t *testing.T) {
+	history := simulateOvershootingModel(&BisectionController{}, 0.6, 7)
+	assert.Less(t, len(history), 7)
+	last := history[len(history)-1]
+	assert.Equal(t, 1, last.NumberOfPages)
+	assert.GreaterOrEqual(t, last.LastPageContentRatio, 0.88)
+}
+
+func TestLayoutsHaveLengthControllers(t *testing.T) {
+	tuner := &Tuner{}
+	controller, err := tuner.GetLengthController("chrono")
+	assert.NoError(t, err)
+	assert.IsType(t, &BisectionController{}, controller)
+	controller, err = tuner.GetLengthController("coverletter")
+	assert.NoError(t, err)
+	assert.IsType(t, &ProportionalController{}, controller)
+	_, err = tuner.GetLengthController("nope")
+	assert.Error(t, err)
+}
+
+func TestControllersAimForTheTargetPages(t *testing.T) {
+	goal := lengthGoalForJob(2, 0.88)
+	for _, controller := range []LengthController{&ProportionalController{Gain: 1}, &BisectionController{}} {
+		assert.True(t, controller.Next([]inspectResult{{NumberOfPages: 2, LastPageContentRatio: 0.9}}, goal).Stop)
+
+		//one page over is just too long when we're after two
+		instruction := controller.Next([]inspectResult{{NumberOfPages: 3, LastPageContentRatio: 0.2}}, goal)
+		assert.Equal(t, PROMPT_TOO_LONG, instruction.Template)
+
+		instruction = controller.Next([]inspectResult{{NumberOfPages: 1, LastPageContentRatio: 0.95}}, goal)
+		assert.Equal(t, PROMPT_TOO_SHORT, instruction.Template)
+		assert.Equal(t, MAX_INCREASE_PCT, instruction.IncreaseByPct)
+	}
+}
@@ -3,17 +3,11 @@ package tuner
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/disintegration/imaging"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/oauth2"
-	"google.golang.org/api/idtoken"
 	"image"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"net/url"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -27,191 +21,69 @@ import (
 type inspectResult struct {
 	NumberOfPages        int
 	LastPageContentRatio float64
+	Skipped              bool    //attempt never got rendered (eg the response was truncated), so it can't be picked as best
+	RequestedChange      float64 //length change asked for to get this attempt from the previous one, eg -0.2. 0 for a fresh ask.
 }
 
-type GotenbergHTTPError struct {
-	HttpResponseCode int
-	HttpError        bool
-	Message          string
-}
-
-func (e *GotenbergHTTPError) Error() string {
-	return e.Message
-}
-
-func makePDFRequestAndSave(attempt int, config *config.ServiceConfig, job *job.Job) error {
-	// Step 1: Create a new buffer and a multipart writer
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-	ctx := context.Background()
-	// Step 2: Add the "url" field to the multipart form
-	urlField, err := writer.CreateFormField("url")
-	if err != nil {
-		return fmt.Errorf("failed to create url form field: %v", err)
-	}
-
-	var urlToRender string
-	if config.FsType == "gcs" {
-		//for server mode with gcs data we need to make sure we pass jsonserver with a hostname value (no https:// prefix), and make sure that the uuid and a slash (uri escaped) get prepended to the attemptN value.
-		jsonServerHostname, err := extractHostname(config.JsonServerURL)
-		if err != nil {
-			return err
-		}
-
-		//note: json server will expect gcp auth token for react server, because react server needs to receive it to load the page, and b/c its headless chrome its going to forward _that_ token to js fetch requests (you can't even override it if you wanted to due to how chrome treats bearer tokens)
-		jsonPathFragment := url.PathEscape(fmt.Sprintf("%s/attempt%d", job.Id, attempt))
-		urlToRender = fmt.Sprintf("%s/?jsonserver=%s&resumedata=%s&layout=%s", config.ReactAppURL, jsonServerHostname, jsonPathFragment, job.Layout)
-	} else {
-		//legacy way, presumably json server is on local host or smth.
-		urlToRender = fmt.Sprintf("%s/?resumedata=attempt%d&layout=%s", config.ReactAppURL, attempt, job.Layout)
-	}
-	_, err = io.WriteString(urlField, urlToRender)
-	if err != nil {
-		return fmt.Errorf("failed to write to form field: %v", err)
-	}
-
-	// add a waitForExpression since i got a pdf that just had "Loading..." in it ... bad.
-	waitForExpressionField, err := writer.CreateFormField("waitForExpression")
-	if err != nil {
-		return fmt.Errorf("failed to create form field: %v", err)
-	}
-	_, err = io.WriteString(waitForExpressionField, "window.contentLoaded === true")
+// renderAttemptPDF renders the attempts resumedata (attemptN.json) with the configured renderer and saves it as attemptN.pdf.
+func (t *Tuner) renderAttemptPDF(ctx context.Context, j *job.Job, attempt int) error {
+	resumedata, err := os.ReadFile(filepath.Join(j.OutputDir, fmt.Sprintf("attempt%d.json", attempt)))
 	if err != nil {
-		return fmt.Errorf("failed to write to form field: %v", err)
+		return fmt.Errorf("failed to read attempt resumedata: %v", err)
 	}
-
-	extraHttpHeaders, err := getExtraHttpHeadersForGotenbergRequest(ctx, config)
+	pdf, err := t.Renderer.Render(ctx, j, attempt, resumedata)
 	if err != nil {
-		return fmt.Errorf("failed to obtain tokens for react server: %v", err)
-	}
-	err = writer.WriteField("extraHttpHeaders", extraHttpHeaders)
-	if err != nil {
-		return fmt.Errorf("failed to create extraHttpHeaders form field: %v", err)
-	}
-
-	// Close the multipart writer to finalize the form data
-	err = writer.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close multipart writer: %v", err)
-	}
-
-	// Step 4: Create a new POST request with the multipart form data
-	gotenbergRequestURL := fmt.Sprintf("%s/forms/chromium/convert/url", config.GotenbergURL)
-	req, err := http.NewRequest("POST", gotenbergRequestURL, &requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %v", err)
-	}
-
-	// Step 5: Set the Content-Type header
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	log.Info().Msgf("Will ask gotenberg at %s to render page at %s", gotenbergRequestURL, urlToRender)
-	// Step 6: Send the HTTP request
-	client, err := createAuthenticatedClient(ctx, config.GotenbergURL)
-	if err != nil {
-		return fmt.Errorf("failed to create authenticated client: %v", err)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Trace().Msgf("failed to send HTTP request: %v", err)
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusServiceUnavailable {
-			return &GotenbergHTTPError{
-				HttpResponseCode: resp.StatusCode,
-				HttpError:        true,
-				Message:          "Gotenberg gave retryable http error code",
-			}
-		}
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	// Step 8: Write the response body (PDF) to the output file
-	outputFilePath := filepath.Join(job.OutputDir, fmt.Sprintf("attempt%d.pdf", attempt))
 
 	// Create the output directory if it doesn't exist
-	err = os.MkdirAll(job.OutputDir, 0755)
+	err = os.MkdirAll(j.OutputDir, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
-
-	// Create the output file
-	file, err := os.Create(outputFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer file.Close()
-
-	// Copy the response body to the output file
-	_, err = io.Copy(file, resp.Body)
+	outputFilePath := filepath.Join(j.OutputDir, fmt.Sprintf("attempt%d.pdf", attempt))
+	err = os.WriteFile(outputFilePath, pdf, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write PDF to file: %v", err)
 	}
-
-	log.Info().Msgf("PDF saved to %s", outputFilePath)
-
+	j.Log().Info().Msgf("PDF saved to %s", outputFilePath)
 	return nil
 }
 
-func getExtraHttpHeadersForGotenbergRequest(ctx context.Context, config *config.ServiceConfig) (string, error) {
-	//due to GCP internals and not wanting these services wide open to the public internet we have to pass some tokens along.
-	//we need to prepare them here because we can't make gotenberg figure this out.
-
-	// Step 1: Obtain the ID token for the React service
-	reactIDToken, err := getIDToken(ctx, config.ReactAppURL)
-	if err != nil {
-		return "", fmt.Errorf("Error obtaining ID token for React service: %v", err)
+// rasterizeAttempt dumps attemptN.pdf to a PNG per page (outN-001.png and so on) for inspectPNGFiles. That's ghostscript,
+// unless the tuner was given something else to do it with, which the tests do so they don't need ghostscript around.
+func (t *Tuner) rasterizeAttempt(ctx context.Context, attempt int, outputDir string) error {
+	if t.rasterize != nil {
+		return t.rasterize(ctx, attempt, outputDir)
 	}
+	return dumpPDFToPNG(ctx, attempt, outputDir, t.config)
+}
 
-	// Step 2: Prepare the extra HTTP headers as a JSON string
-	extraHeaders := map[string]string{
-		"Authorization": "Bearer " + reactIDToken, //note, due to how chrome works, this will also be the token that gets forwarded to json server in js fetch request, there is no way to change it.
-	}
-	extraHeadersJSON, err := json.Marshal(extraHeaders)
-	if err != nil {
-		return "", fmt.Errorf("Error marshalling extra headers: %v", err)
-	}
-	return string(extraHeadersJSON), nil
+// pdfTextFilename is where ghostscript dumps the text of attemptN.pdf to. Numbered like the PNGs, since the candidates
+// for an attempt get dumped at the same time.
+func pdfTextFilename(attempt int) string {
+	return fmt.Sprintf("pdf-txtwrite-%d.txt", attempt)
 }
 
-func getIDToken(ctx context.Context, audience string) (string, error) {
-	tokenSource, err := idtoken.NewTokenSource(ctx, audience)
+// checkPDFText looks through the text dumped from a PDF for the frontend having failed to render the resume at all.
+func checkPDFText(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", fmt.Errorf("idtoken.NewTokenSource: %v", err)
+		return fmt.Errorf("error reading pdf txt output %v", err)
 	}
-
-	token, err := tokenSource.Token()
-	if err != nil {
-		return "", fmt.Errorf("tokenSource.Token: %v", err)
+	if strings.Contains(string(data), "Uncaught runtime errors") {
+		return fmt.Errorf("'Uncaught runtime errors' string detected in PDF contents.")
 	}
-
-	return token.AccessToken, nil
-}
-
-func createAuthenticatedClient(ctx context.Context, audience string) (*http.Client, error) {
-	tokenSource, err := idtoken.NewTokenSource(ctx, audience)
-	if err != nil {
-		return nil, fmt.Errorf("idtoken.NewTokenSource: %v", err)
+	if strings.Contains(string(data), "Error loading data: Failed to fetch") {
+		return fmt.Errorf("'Error loading data: Failed to fetch' string detected in PDF contents.")
 	}
-	client := oauth2.NewClient(ctx, tokenSource)
-	return client, nil
-}
-
-func extractHostname(rawURL string) (string, error) {
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil {
-		return "", err
+	if strings.Contains(string(data), "Unsupported resume layout: ") {
+		return fmt.Errorf("'Unsupported resume layout: ' string detected in PDF contents.")
 	}
-
-	// Extract the hostname without protocol and trailing slash
-	hostname := strings.TrimSuffix(parsedURL.Host, "/")
-	return hostname, nil
+	return nil
 }
 
-func dumpPDFToPNG(attempt int, outputDir string, config *config.ServiceConfig) error {
+func dumpPDFToPNG(ctx context.Context, attempt int, outputDir string, config *config.ServiceConfig) error {
 	// Get the current working directory
 	currentDir, err := os.Getwd()
 	if err != nil {
@@ -225,19 +97,19 @@ func dumpPDFToPNG(attempt int, outputDir string, config *config.ServiceConfig) e
 	// MSYS_NO_PATHCONV=1 docker run --rm -v /$(pwd)/output:/workspace minidocks/ghostscript:latest gs -sDEVICE=pngalpha -o /workspace/out-%03d.png -r144 /workspace/attempt.pdf
 	var cmd *exec.Cmd
 	if config.UseSystemGs {
-		cmd = exec.Command(
+		cmd = exec.CommandContext(ctx,
 			"gs",
 			"-sDEVICE=txtwrite",
-			"-o", filepath.Join(outputDirFullpath, "pdf-txtwrite.txt"),
+			"-o", filepath.Join(outputDirFullpath, pdfTextFilename(attempt)),
 			filepath.Join(outputDirFullpath, fmt.Sprintf("attempt%d.pdf", attempt)),
 		)
 	} else {
-		cmd = exec.Command("docker", "run", "--rm",
+		cmd = exec.CommandContext(ctx, "docker", "run", "--rm",
 			"-v", fmt.Sprintf("%s:/workspace", outputDirFullpath),
 			"minidocks/ghostscript:latest",
 			"gs",
 			"-sDEVICE=txtwrite",
-			"-o", "/workspace/pdf-txtwrite.txt",
+			"-o", "/workspace/"+pdfTextFilename(attempt),
 			fmt.Sprintf("/workspace/attempt%d.pdf", attempt),
 		)
 	}
@@ -249,26 +121,15 @@ func dumpPDFToPNG(attempt int, outputDir string, config *config.ServiceConfig) e
 	if err != nil {
 		return fmt.Errorf("Error running docker command: %v\n", err)
 	}
-	log.Trace().Msg("Here before readfile")
-	data, err := os.ReadFile(filepath.Join(outputDirFullpath, "pdf-txtwrite.txt"))
+	err = checkPDFText(filepath.Join(outputDirFullpath, pdfTextFilename(attempt)))
 	if err != nil {
-		return fmt.Errorf("error reading pdf txt output %v", err)
-	}
-	log.Trace().Msg("Here before checking for strings")
-	if strings.Contains(string(data), "Uncaught runtime errors") {
-		return fmt.Errorf("'Uncaught runtime errors' string detected in PDF contents.")
-	}
-	if strings.Contains(string(data), "Error loading data: Failed to fetch") {
-		return fmt.Errorf("'Error loading data: Failed to fetch' string detected in PDF contents.")
-	}
-	if strings.Contains(string(data), "Unsupported resume layout: ") {
-		return fmt.Errorf("'Unsupported resume layout: ' string detected in PDF contents.")
+		return err
 	}
 
 	log.Trace().Msg("Here before proceeding to image dumping")
 
 	if config.UseSystemGs {
-		cmd = exec.Command(
+		cmd = exec.CommandContext(ctx,
 			"gs",
 			"-sDEVICE=pngalpha",
 			"-o", filepath.Join(outputDirFullpath, fmt.Sprintf("out%d-%%03d.png", attempt)),
@@ -277,7 +138,7 @@ func dumpPDFToPNG(attempt int, outputDir string, config *config.ServiceConfig) e
 		)
 	} else {
 		// dump pdf to png files, one per page, 144ppi
-		cmd = exec.Command("docker", "run", "--rm",
+		cmd = exec.CommandContext(ctx, "docker", "run", "--rm",
 			"-v", fmt.Sprintf("%s:/workspace", outputDirFullpath),
 			"minidocks/ghostscript:latest",
 			"gs",
@@ -327,8 +188,9 @@ func dumpPDFToPNG(attempt int, outputDir string, config *config.ServiceConfig) e
 	return nil
 }
 
-// inspectPNGFiles counts all the PNG files in the output directory and calculates the content ratio of the last page
-func inspectPNGFiles(outputDir string, attempt int) (inspectResult, error) {
+// inspectPNGFiles counts all the PNG files in the output directory and calculates the content ratio of the last page.
+// The print options are what the PDF was rendered with, so the ratio can account for the paper size and margins.
+func inspectPNGFiles(outputDir string, attempt int, print job.PrintOptions) (inspectResult, error) {
 	result := inspectResult{}
 
 	// Read the files in the output directory
@@ -368,12 +230,16 @@ func inspectPNGFiles(outputDir string, attempt int) (inspectResult, error) {
 		return result, fmt.Errorf("Failed to open image: %v", err)
 	}
 
-	result.LastPageContentRatio = contentRatio(img)
+	result.LastPageContentRatio = contentRatio(img, print)
 
 	return result, nil
 }
 
-func contentRatio(img image.Image) float64 {
+// contentRatio is how far down the page the content goes. The acceptable ratios for each layout were worked out on
+// letter paper with the default margins, so for any other paper or margins it's how far down the printable area the
+// content goes, put back in terms of that letter page. For letter with the default margins that's just the fraction of
+// the rows, same as it always was.
+func contentRatio(img image.Image, print job.PrintOptions) float64 {
 	// Get image dimensions
 	bounds := img.Bounds()
 	//totalPixels := bounds.Dx() * bounds.Dy()
@@ -395,8 +261,19 @@ func contentRatio(img image.Image) float64 {
 		}
 	}
 	log.Debug().Msgf("lastrow found a pixel on: %v, total rows was %v", lastColoredPixelRow, bounds.Max.Y)
-	lastContentAt := float64(lastColoredPixelRow) / float64(bounds.Max.Y)
-	log.Debug().Msgf("last content found at %.5f of the document.", lastContentAt)
+	if lastColoredPixelRow == 0 {
+		return 0
+	}
+	rows := float64(bounds.Max.Y)
+	paper := print.Paper()
+	top, _, bottom, _ := print.Margins()
+	topRows := top / paper.Height * rows
+	printableRows := rows - topRows - bottom/paper.Height*rows
+	printedAt := math.Max(0, math.Min(1, (float64(lastColoredPixelRow)-topRows)/printableRows))
+
+	letter := job.PAPER_SIZES[job.DEFAULT_PAPER_SIZE]
+	lastContentAt := (job.DEFAULT_MARGIN + printedAt*(letter.Height-2*job.DEFAULT_MARGIN)) / letter.Height
+	log.Debug().Msgf("last content found at %.5f of the printable area, %.5f of the document on letter paper.", printedAt, lastContentAt)
 	return lastContentAt
 }
 
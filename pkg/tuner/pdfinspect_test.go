@@ -0,0 +1,35 @@
+package tuner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"pdfinspector/pkg/job"
+	"testing"
+)
+
+// pageImage is a white page rows tall with black all the way down to row contentTo.
+func pageImage(rows, contentTo int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 10, rows))
+	for y := 0; y < rows; y++ {
+		for x := 0; x < 10; x++ {
+			img.Set(x, y, color.White)
+			if y < contentTo {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestContentRatio(t *testing.T) {
+	assert.Equal(t, 0.0, contentRatio(pageImage(1100, 0), job.PrintOptions{}), "empty page")
+	assert.InDelta(t, 0.5, contentRatio(pageImage(1100, 550), job.PrintOptions{}), 0.001, "letter with the default margins is just the fraction of the rows")
+
+	//half way down the printable area of an a4 page with 1in margins is the same as half way down the letter one
+	margin := 1.0
+	a4 := job.PrintOptions{PaperSize: "a4", MarginTop: &margin, MarginBottom: &margin}
+	assert.InDelta(t, 0.5, contentRatio(pageImage(1170, 585), a4), 0.001)
+	assert.InDelta(t, 1.0-job.DEFAULT_MARGIN/11, contentRatio(pageImage(1170, 1070), a4), 0.001, "the end of the printable area")
+	assert.InDelta(t, 1.0-job.DEFAULT_MARGIN/11, contentRatio(pageImage(1170, 1170), a4), 0.001, "content in the margin doesn't go past the end")
+}
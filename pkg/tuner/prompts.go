@@ -0,0 +1,126 @@
+package tuner
+
+import (
+	"github.com/rs/zerolog/log"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/prompts"
+)
+
+// names of the prompt templates that every prompt set has to have, on top of the ones named in layoutDefaults.
+const (
+	PROMPT_TUNE_SYSTEM       = "tune_system"
+	PROMPT_TOO_MANY_PAGES    = "too_many_pages"
+	PROMPT_TOO_LONG          = "too_long"
+	PROMPT_TOO_SHORT         = "too_short"
+	PROMPT_TRUNCATED         = "truncated"
+	PROMPT_JD_NOTES_SYSTEM   = "jd_notes_system"
+	PROMPT_JD_NOTES          = "jd_notes"
+	PROMPT_EXTRACT_SYSTEM    = "extract_system"
+	PROMPT_EXTRACT_TOO_SHORT = "extract_too_short"
+	PROMPT_EXTRACT_TOO_LONG  = "extract_too_long"
+	PROMPT_EXTRACT_TRUNCATED = "extract_truncated"
+	PROMPT_SCHEMA_REPAIR     = "schema_repair"
+	PROMPT_REVERT_FABRICATED = "revert_fabrications"
+)
+
+const PROMPT_VERSION_FILENAME = "prompt_version.txt"
+
+func requiredPromptTemplates() []string {
+	required := []string{
+		PROMPT_TUNE_SYSTEM,
+		PROMPT_TOO_MANY_PAGES,
+		PROMPT_TOO_LONG,
+		PROMPT_TOO_SHORT,
+		PROMPT_TRUNCATED,
+		PROMPT_JD_NOTES_SYSTEM,
+		PROMPT_JD_NOTES,
+		PROMPT_EXTRACT_SYSTEM,
+		PROMPT_EXTRACT_TOO_SHORT,
+		PROMPT_EXTRACT_TOO_LONG,
+		PROMPT_EXTRACT_TRUNCATED,
+		PROMPT_SCHEMA_REPAIR,
+		PROMPT_REVERT_FABRICATED,
+	}
+	for _, defaults := range layoutDefaults {
+		for _, name := range []string{defaults.MainPromptTemplate, defaults.ComposePromptTemplate, defaults.ExtractPromptTemplate} {
+			if name != "" {
+				required = append(required, name)
+			}
+		}
+	}
+	return required
+}
+
+// configurePrompts loads and checks all the prompt sets, a broken prompt template should stop startup rather than a job.
+func (t *Tuner) configurePrompts() *prompts.Library {
+	library, err := prompts.Load(t.config.PromptsPath, requiredPromptTemplates())
+	if err != nil {
+		log.Fatal().Msgf("Failed to load prompts: %v", err)
+	}
+	if _, err := library.Set(t.config.PromptSet); err != nil {
+		log.Fatal().Msgf("Default prompt set is no good: %v", err)
+	}
+	t.Prompts = library
+	return library
+}
+
+// PopulateJobPromptSet settles which prompt set the job uses and records its exact version on the job.
+// A job that didn't ask for a particular set goes into the running experiment for its layout, if there is one.
+func (t *Tuner) PopulateJobPromptSet(job *job.Job) (*prompts.Set, error) {
+	job.Experiment = ""
+	job.Variant = ""
+	if job.PromptSet == "" {
+		if experiment := t.Prompts.ExperimentFor(job.Layout); experiment != nil {
+			variant := experiment.Assign(job.Id)
+			job.Experiment = experiment.Name
+			job.Variant = variant.Name
+			job.PromptSet = variant.PromptSet
+			job.Log().Info().Msgf("job is in prompt experiment %s as variant %s", job.Experiment, job.Variant)
+		}
+	}
+	if job.PromptSet == "" {
+		job.PromptSet = t.config.PromptSet
+	}
+	set, err := t.Prompts.Set(job.PromptSet)
+	if err != nil {
+		return nil, err
+	}
+	job.PromptVersion = set.ID()
+	job.Log().Info().Msgf("job using prompts %s", job.PromptVersion)
+	return set, nil
+}
+
+// jobPromptSet is the jobs prompt set, or the default set if it hasn't got one.
+func (t *Tuner) jobPromptSet(job *job.Job) (*prompts.Set, error) {
+	setName := job.PromptSet
+	if setName == "" {
+		setName = t.config.PromptSet
+	}
+	return t.Prompts.Set(setName)
+}
+
+// renderPrompt renders one of the templates from the jobs prompt set. The jobs page target is filled in for every prompt.
+func (t *Tuner) renderPrompt(job *job.Job, name string, data prompts.Data) (string, error) {
+	data.TargetPages = job.TargetPages
+	set, err := t.jobPromptSet(job)
+	if err != nil {
+		return "", err
+	}
+	return set.Render(name, data)
+}
+
+func (t *Tuner) getMainPrompt(set *prompts.Set, layout string, targetPages int) (string, error) {
+	defaults, err := t.GetLayoutDefaults(layout)
+	if err != nil {
+		return "", err
+	}
+	return set.Render(defaults.MainPromptTemplate, prompts.Data{Layout: layout, TargetPages: targetPages})
+}
+
+// saveJobPromptVersion notes the prompts used next to the job outputs, so we can tell which prompts produced which PDF.
+func (t *Tuner) saveJobPromptVersion(job *job.Job) {
+	if job.PromptVersion == "" {
+		return
+	}
+	t.saveJobOutputFile(job, PROMPT_VERSION_FILENAME, job.PromptVersion+"\n")
+}
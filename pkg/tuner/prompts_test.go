@@ -0,0 +1,108 @@
+package tuner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"pdfinspector/pkg/config"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/prompts"
+	"testing"
+)
+
+func promptsTestTuner(t *testing.T) *Tuner {
+	library, err := prompts.Load(filepath.Join("..", "..", "prompts"), requiredPromptTemplates())
+	assert.NoError(t, err)
+	return &Tuner{
+		config:  &config.ServiceConfig{PromptSet: prompts.DEFAULT_SET},
+		Prompts: library,
+	}
+}
+
+func TestShippedPromptsComposeTheSameResumePromptAsBefore(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.JobDescription = "Wanted: gopher"
+	testJob.BaselineJSON = `{"basics":{}}`
+	set, err := tuner.PopulateJobPromptSet(testJob)
+	assert.NoError(t, err)
+	assert.Equal(t, set.ID(), testJob.PromptVersion)
+	testJob.MainPrompt, err = tuner.getMainPrompt(set, testJob.Layout, testJob.TargetPages)
+	assert.NoError(t, err)
+	assert.Contains(t, testJob.MainPrompt, "exactly one page.\nSome of the information")
+
+	prompt, err := tuner.GetCompletePromptForLayout(testJob, []string{"go", "gcp"})
+	assert.NoError(t, err)
+	assert.Equal(t, testJob.MainPrompt+
+		"\n--- start job description ---\nWanted: gopher\n--- end job description ---\n"+
+		"The adjusted resume data should contain as many of the following keywords as is reasonable/possible: go, gcp\n"+
+		"The following JSON resume data represents the work history, skills, competencies and education for the candidate:\n"+
+		`{"basics":{}}`, prompt)
+}
+
+func TestShippedPromptsComposeCoverletterWithSupplement(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "coverletter"
+	testJob.MainPrompt = "Write it."
+	testJob.JobDescription = "Wanted: gopher"
+	testJob.BaselineJSON = `{}`
+	testJob.SupplementData = []byte(`{"name":"x","resumedata":{"a":1}}`)
+
+	prompt, err := tuner.GetCompletePromptForLayout(testJob, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Candidate info to inform and supplement the contents of the cover letter:\n"+
+		"\n--- start candidate info ---\n"+`{"a":1}`+"\n--- end candidate info ---\n"+
+		"Write it.\n--- start job description ---\nWanted: gopher\n--- end job description ---\n"+
+		"The following JSON cover letter data represents a draft version supplied by the candidate. We should improve upon it or completely rewrite it if needed.\n{}", prompt)
+}
+
+func TestPopulateJobPromptSetAssignsExperimentVariant(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	tuner.Prompts.Experiments = []prompts.Experiment{{
+		Name:     "resume-compose-order",
+		Enabled:  true,
+		Layouts:  []string{"chrono"},
+		Variants: []prompts.Variant{{Name: "resumedata-first", PromptSet: "resumedata_first", Weight: 1}},
+	}}
+
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	set, err := tuner.PopulateJobPromptSet(testJob)
+	assert.NoError(t, err)
+	assert.Equal(t, "resumedata_first", set.Name)
+	assert.Equal(t, "resume-compose-order", testJob.Experiment)
+	assert.Equal(t, "resumedata-first", testJob.Variant)
+
+	//asking for a set explicitly keeps the job out of experiments
+	pinned := job.NewDefaultJob()
+	pinned.Layout = "chrono"
+	pinned.PromptSet = prompts.DEFAULT_SET
+	_, err = tuner.PopulateJobPromptSet(pinned)
+	assert.NoError(t, err)
+	assert.Equal(t, "", pinned.Experiment)
+
+	coverletter := job.NewDefaultJob()
+	coverletter.Layout = "coverletter"
+	set, err = tuner.PopulateJobPromptSet(coverletter)
+	assert.NoError(t, err)
+	assert.Equal(t, prompts.DEFAULT_SET, set.Name)
+}
+
+func TestShippedPromptsAskForTheTargetPages(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "functional"
+	testJob.TargetPages = 2
+	set, err := tuner.PopulateJobPromptSet(testJob)
+	assert.NoError(t, err)
+
+	mainPrompt, err := tuner.getMainPrompt(set, testJob.Layout, testJob.TargetPages)
+	assert.NoError(t, err)
+	assert.Contains(t, mainPrompt, "keeping the final render to exactly 2 pages.")
+	assert.NotContains(t, mainPrompt, "one page")
+
+	systemPrompt, err := tuner.renderPrompt(testJob, PROMPT_TUNE_SYSTEM, prompts.Data{AcceptableRatio: 88})
+	assert.NoError(t, err)
+	assert.Contains(t, systemPrompt, "fills 2 pages, with the last page filled to between 88% and 95%")
+}
@@ -0,0 +1,167 @@
+package tuner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pdfinspector/pkg/job"
+	"time"
+)
+
+// When an attempt only just overflows, dropping a bullet or a trailing skill usually fits it on the page, which is a lot
+// cheaper than another completion. Pruning takes things out of the resumedata one at a time, by the layouts priorities,
+// re-rendering after each, and gives up (leaving it to the LLM) if it can't get there in MAX_PRUNE_RENDERS.
+const PRUNE_MAX_OVERFLOW = 0.1 //only prune when the overflow is at most this much of a page, roughly 5 lines
+const MAX_PRUNE_RENDERS = 4
+
+// PRUNE_SLOT_BASE keeps the pruned renders numbered clear of the attempts and their candidates, see candidateSlot.
+// Prune step 2 of attempt 3 is written as attempt10203.json/pdf.
+const PRUNE_SLOT_BASE = 10000
+
+// leave at least this many skills/tech items, an empty skills section looks worse than a second page.
+const MIN_PRUNED_SKILLS = 6
+const MIN_PRUNED_TECH = 3
+
+// PruneStep removes one thing from the decoded resumedata, saying what it took out. false if it has nothing left to take.
+type PruneStep func(data map[string]interface{}) (string, bool)
+
+func pruneSlot(attempt, step int) int {
+	return PRUNE_SLOT_BASE + candidateSlot(attempt, step)
+}
+
+func withinPruningReach(result inspectResult, goal LengthGoal) bool {
+	return result.NumberOfPages == goal.Pages+1 && result.LastPageContentRatio <= PRUNE_MAX_OVERFLOW
+}
+
+// pruneToFit tries to get a slightly overflowing attempt onto the target pages by pruning.
+// Returns the pruned version if that got it to an acceptable length, otherwise false and the LLM gets asked as usual.
+// Every render counts against the jobs wall time budget (from started), same as the attempts.
+func (t *Tuner) pruneToFit(ctx context.Context, job *job.Job, candidate attemptCandidate, attempt int, goal LengthGoal, started time.Time, updates chan job.JobStatus) (attemptCandidate, bool) {
+	defaults, err := t.GetLayoutDefaults(job.Layout)
+	if err != nil || len(defaults.PruneSteps) == 0 || !withinPruningReach(candidate.result, goal) {
+		return candidate, false
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal([]byte(candidate.content), &data)
+	if err != nil {
+		return candidate, false
+	}
+	SendJobUpdate(updates, fmt.Sprintf("attempt %d only overflowed by %.0f%% of a page, will try pruning it to fit", attempt, candidate.result.LastPageContentRatio*100))
+
+	for p := 0; p < MAX_PRUNE_RENDERS; p++ {
+		if ctx.Err() != nil {
+			return candidate, false
+		}
+		if exhausted := job.Budget.Exhausted(started, job.Usage.Totals().TotalTokens); exhausted != "" {
+			job.Log().Info().Msgf("%s budget ran out pruning attempt %d", exhausted, attempt)
+			return candidate, false
+		}
+		removed, ok := pruneOnce(data, defaults.PruneSteps)
+		if !ok {
+			job.Log().Info().Msgf("nothing left to prune from attempt %d", attempt)
+			return candidate, false
+		}
+		pruned, err := json.Marshal(data)
+		if err != nil {
+			return candidate, false
+		}
+		label := fmt.Sprintf("attempt %d prune %d", attempt, p)
+		job.Log().Info().Msgf("%s: removed %s", label, removed)
+		result, err := t.renderResumeData(ctx, job, string(pruned), pruneSlot(attempt, p), label, updates)
+		if err != nil {
+			job.Log().Error().Msgf("error rendering %s, leaving it to the LLM: %v", label, err)
+			return candidate, false
+		}
+		if result.NumberOfPages > goal.Pages {
+			continue
+		}
+		if !lengthIsAcceptable(result, goal) {
+			job.Log().Info().Msgf("%s fits but is too short now, leaving it to the LLM", label)
+			return candidate, false
+		}
+		SendJobUpdate(updates, fmt.Sprintf("pruned attempt %d to fit, removed %s", attempt, removed))
+		return attemptCandidate{slot: pruneSlot(attempt, p), content: string(pruned), result: result, reverted: candidate.reverted, fabrications: len(fabricationsIn(job, string(pruned)))}, true
+	}
+	job.Log().Info().Msgf("pruning couldn't fit attempt %d in %d renders", attempt, MAX_PRUNE_RENDERS)
+	return candidate, false
+}
+
+// pruneOnce runs the first step that can still remove something.
+func pruneOnce(data map[string]interface{}, steps []PruneStep) (string, bool) {
+	for _, step := range steps {
+		if removed, ok := step(data); ok {
+			return removed, true
+		}
+	}
+	return "", false
+}
+
+// pruneOldestProject drops the last project of the last company that has more than one, work history being newest first.
+// Companies never lose their only project, that would leave a gap in the history.
+func pruneOldestProject(data map[string]interface{}) (string, bool) {
+	companies, _ := data["work_history"].([]interface{})
+	for c := len(companies) - 1; c >= 0; c-- {
+		company, _ := companies[c].(map[string]interface{})
+		projects, _ := company["projects"].([]interface{})
+		if len(projects) > 1 {
+			company["projects"] = projects[:len(projects)-1]
+			return fmt.Sprintf("the oldest project at %v", company["company"]), true
+		}
+	}
+	return "", false
+}
+
+// pruneSmallestAreaContribution drops the last key contribution of the functional area with the fewest (but more than one).
+// Later areas lose out on a tie.
+func pruneSmallestAreaContribution(data map[string]interface{}) (string, bool) {
+	areas, _ := data["functional_areas"].([]interface{})
+	var smallest map[string]interface{}
+	smallestCount := 0
+	for _, a := range areas {
+		area, _ := a.(map[string]interface{})
+		contributions, _ := area["key_contributions"].([]interface{})
+		if len(contributions) > 1 && (smallest == nil || len(contributions) <= smallestCount) {
+			smallest, smallestCount = area, len(contributions)
+		}
+	}
+	if smallest == nil {
+		return "", false
+	}
+	contributions := smallest["key_contributions"].([]interface{})
+	smallest["key_contributions"] = contributions[:len(contributions)-1]
+	return fmt.Sprintf("the last key contribution in %v", smallest["title"]), true
+}
+
+// pruneSkillsOverflow drops the last skill.
+func pruneSkillsOverflow(data map[string]interface{}) (string, bool) {
+	skills, _ := data["skills"].([]interface{})
+	if len(skills) <= MIN_PRUNED_SKILLS {
+		return "", false
+	}
+	data["skills"] = skills[:len(skills)-1]
+	return fmt.Sprintf("the skill %v", skills[len(skills)-1]), true
+}
+
+// pruneTechOverflow drops the last tech item of the key contribution with the longest tech list.
+func pruneTechOverflow(data map[string]interface{}) (string, bool) {
+	areas, _ := data["functional_areas"].([]interface{})
+	var longest map[string]interface{}
+	longestCount := MIN_PRUNED_TECH
+	for _, a := range areas {
+		area, _ := a.(map[string]interface{})
+		contributions, _ := area["key_contributions"].([]interface{})
+		for _, c := range contributions {
+			contribution, _ := c.(map[string]interface{})
+			tech, _ := contribution["tech"].([]interface{})
+			if len(tech) > longestCount {
+				longest, longestCount = contribution, len(tech)
+			}
+		}
+	}
+	if longest == nil {
+		return "", false
+	}
+	tech := longest["tech"].([]interface{})
+	longest["tech"] = tech[:len(tech)-1]
+	return fmt.Sprintf("the tech %v", tech[len(tech)-1]), true
+}
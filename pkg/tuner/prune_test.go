@@ -0,0 +1,122 @@
+package tuner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/render"
+	"testing"
+	"time"
+)
+
+func decodeForPruning(t *testing.T, content string) map[string]interface{} {
+	var data map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(content), &data))
+	return data
+}
+
+func TestChronoPruningTakesOldestProjectsThenSkills(t *testing.T) {
+	data := decodeForPruning(t, `{
+		"skills": ["go", "gcp", "k8s", "sql", "react", "terraform", "perl"],
+		"work_history": [
+			{"company": "Now", "projects": [{"desc": "a"}, {"desc": "b"}]},
+			{"company": "Then", "projects": [{"desc": "c"}, {"desc": "d"}]},
+			{"company": "Ages Ago", "projects": [{"desc": "e"}]}
+		]
+	}`)
+	steps := layoutDefaults["chrono"].PruneSteps
+
+	removed, ok := pruneOnce(data, steps)
+	assert.True(t, ok)
+	assert.Equal(t, "the oldest project at Then", removed)
+	removed, _ = pruneOnce(data, steps)
+	assert.Equal(t, "the oldest project at Now", removed)
+	removed, _ = pruneOnce(data, steps)
+	assert.Equal(t, "the skill perl", removed)
+	_, ok = pruneOnce(data, steps)
+	assert.False(t, ok, "down to the minimum skills and one project per company")
+	assert.Len(t, data["skills"], MIN_PRUNED_SKILLS)
+}
+
+func TestFunctionalPruningTakesFromTheSmallestArea(t *testing.T) {
+	data := decodeForPruning(t, `{
+		"functional_areas": [
+			{"title": "Big", "key_contributions": [{"tech": []}, {"tech": []}, {"tech": []}]},
+			{"title": "Small", "key_contributions": [{"tech": ["a", "b", "c", "d"]}, {"tech": []}]},
+			{"title": "Alone", "key_contributions": [{"tech": []}]}
+		]
+	}`)
+	steps := layoutDefaults["functional"].PruneSteps
+
+	removed, _ := pruneOnce(data, steps)
+	assert.Equal(t, "the last key contribution in Small", removed)
+	removed, _ = pruneOnce(data, steps)
+	assert.Equal(t, "the last key contribution in Big", removed)
+	removed, _ = pruneOnce(data, steps)
+	assert.Equal(t, "the last key contribution in Big", removed)
+	removed, _ = pruneOnce(data, steps)
+	assert.Equal(t, "the tech d", removed)
+	_, ok := pruneOnce(data, steps)
+	assert.False(t, ok)
+}
+
+func TestOnlySmallOverflowsGetPruned(t *testing.T) {
+	goal := lengthGoalForJob(1, 0.88)
+	assert.True(t, withinPruningReach(inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.05}, goal))
+	assert.False(t, withinPruningReach(inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.3}, goal))
+	assert.False(t, withinPruningReach(inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.5}, goal))
+	assert.False(t, withinPruningReach(inspectResult{NumberOfPages: 3, LastPageContentRatio: 0.05}, goal))
+	assert.Equal(t, 10203, pruneSlot(3, 2))
+}
+
+// pruneTestTuner renders with the stub renderer, with every project a tenth of a page. It counts the renders.
+func pruneTestTuner(t *testing.T) (*Tuner, *int) {
+	tuner := promptsTestTuner(t)
+	tuner.Renderer = render.NewStubRenderer()
+	renders := 0
+	tuner.rasterize = func(ctx context.Context, attempt int, outputDir string) error {
+		renders++
+		return rasterizeProjects(0.1, attempt, outputDir)
+	}
+	return tuner, &renders
+}
+
+func TestPruneToFitGetsAnOverflowOntoThePage(t *testing.T) {
+	tuner, renders := pruneTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	goal := lengthGoalForJob(1, testJob.AcceptableRatio)
+	//11 projects is a tenth of a page over
+	candidate := attemptCandidate{slot: 0, content: chronoWithProjects(t, 11), result: inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.1}}
+
+	pruned, ok := tuner.pruneToFit(context.Background(), testJob, candidate, 0, goal, time.Now(), nil)
+	assert.True(t, ok)
+	assert.Equal(t, 1, *renders)
+	assert.Equal(t, pruneSlot(0, 0), pruned.slot)
+	assert.Equal(t, 1, pruned.result.NumberOfPages)
+	assert.True(t, lengthIsAcceptable(pruned.result, goal))
+	assert.NotContains(t, pruned.content, "made thing 11")
+	assert.FileExists(t, filepath.Join(testJob.OutputDir, fmt.Sprintf("attempt%d.pdf", pruned.slot)))
+}
+
+func TestPruneToFitStopsWhenTheJobDoes(t *testing.T) {
+	tuner, renders := pruneTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	goal := lengthGoalForJob(1, testJob.AcceptableRatio)
+	candidate := attemptCandidate{slot: 0, content: chronoWithProjects(t, 11), result: inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.1}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok := tuner.pruneToFit(ctx, testJob, candidate, 0, goal, time.Now(), nil)
+	assert.False(t, ok)
+
+	testJob.Budget = job.Budget{MaxAttempts: 3, MaxWallSeconds: 60}
+	_, ok = tuner.pruneToFit(context.Background(), testJob, candidate, 0, goal, time.Now().Add(-time.Hour), nil)
+	assert.False(t, ok, "out of time")
+	assert.Equal(t, 0, *renders)
+	_, err := os.Stat(filepath.Join(testJob.OutputDir, fmt.Sprintf("attempt%d.json", pruneSlot(0, 0))))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,10 +1,9 @@
 package tuner
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"pdfinspector/pkg/job"
-	"time"
 )
 
 func (t *Tuner) PopulateRenderJob(job *job.RenderJob, updates chan job.JobStatus) error {
@@ -13,7 +12,7 @@ func (t *Tuner) PopulateRenderJob(job *job.RenderJob, updates chan job.JobStatus
 	return nil
 }
 
-func (t *Tuner) RenderResume(renderJob *job.RenderJob, updates chan job.JobStatus) error {
+func (t *Tuner) RenderResume(ctx context.Context, renderJob *job.RenderJob, updates chan job.JobStatus) error {
 	renderJob.Log().Info().Str("user_key", renderJob.UserKey).Msgf("starting RenderResume")
 
 	//a chopped down version of resume tune, take the json and render it. one attempt, and that was the 'best' one. then we're done!
@@ -35,45 +34,50 @@ func (t *Tuner) RenderResume(renderJob *job.RenderJob, updates chan job.JobStatu
 		Layout:        renderJob.Layout,
 		Logger:        renderJob.Logger,
 		OutputDir:     renderJob.OutputDir,
+		PrintOptions:  renderJob.PrintOptions,
+	}
+	err = WriteAttemptResumedataJSON(content, compatibilityJob, attemptNum)
+	if err != nil {
+		return err
 	}
-	err = WriteAttemptResumedataJSON(content, compatibilityJob, attemptNum, t.Fs, t.config)
 
-	//we should be able to render that updated content proposal now via gotenberg + ghostscript
-	maxGotenAttempts := 3
-	for k := 0; k < maxGotenAttempts; k++ {
-		err = makePDFRequestAndSave(attemptNum, t.config, compatibilityJob)
-		if err == nil {
-			break
-		}
-		var httpErr *GotenbergHTTPError
-		if errors.As(err, &httpErr) {
-			// Handle the error based on the HTTP code
-			renderJob.Log().Info().Msgf("Got a retryable error from Gotenberg, code %d", httpErr.HttpResponseCode)
-			time.Sleep(1 * time.Second)
-			continue
-		} else if err != nil {
-			return err
-		}
+	err = t.renderAttemptPDF(ctx, compatibilityJob, attemptNum)
+	if err != nil {
+		return err
 	}
 	SendJobUpdate(updates, fmt.Sprintf("got PDF for attempt %d, will dump to PNG", attemptNum))
 
 	//this part is now just for information, we do inspect for render error so its not entirely useless.
 	//ghostscript dump to pngs ...
-	err = dumpPDFToPNG(attemptNum, renderJob.OutputDir, t.config)
+	err = t.rasterizeAttempt(ctx, attemptNum, renderJob.OutputDir)
 	if err != nil {
 		return fmt.Errorf("Error during pdf to image dump: %v", err)
 	}
 	SendJobUpdate(updates, fmt.Sprintf("got PNGs for attempt %d, will check it", attemptNum))
 
-	result, err := inspectPNGFiles(renderJob.OutputDir, attemptNum)
+	result, err := inspectPNGFiles(renderJob.OutputDir, attemptNum, renderJob.PrintOptions)
 	if err != nil {
 		renderJob.Log().Error().Msgf("Error inspecting png files: %v", err)
 		return err
 	}
 	SendJobUpdate(updates, fmt.Sprintf("attempt %d png inspection, content ratio: %.2f, page count: %d", attemptNum, result.LastPageContentRatio, result.NumberOfPages))
 
-	attemptsLog := []inspectResult{result}
-	err = t.saveBestAttemptToGCS(attemptsLog, t.Fs, t.config, compatibilityJob, updates)
+	//only the one attempt so it's the best regardless, but the score still gets recorded like any other
+	scorer, err := t.GetAttemptScorer(renderJob.Layout)
+	if err != nil {
+		scorer = defaultAttemptScorer
+	}
+	acceptableRatio, err := t.GetAcceptableRatio(renderJob.Layout)
+	if err != nil {
+		acceptableRatio = defaultAcceptableRatio
+	}
+	score := scorer.Score(ScoredAttempt{
+		Result:      result,
+		Content:     content,
+		SchemaValid: t.contentMatchesSchema(renderJob.Layout, content),
+	}, lengthGoalForJob(1, acceptableRatio))
+	score.Attempt = attemptNum
+	err = t.saveBestAttemptToGCS([]AttemptScore{score}, t.Fs, t.config, compatibilityJob, updates)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,133 @@
+package tuner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/xeipuuv/gojsonschema"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
+)
+
+// MAX_SCHEMA_REPAIRS is how many times we'll ask the model to fix output that doesn't match the layout schema before giving up on it.
+const MAX_SCHEMA_REPAIRS = 2
+
+// Custom error type that holds a list of validation errors
+type SchemaValidationError struct {
+	ValidationErrors []gojsonschema.ResultError
+}
+
+// Implement the error interface by defining the Error() method
+func (ve SchemaValidationError) Error() string {
+	if len(ve.ValidationErrors) == 0 {
+		return "no validation errors"
+	}
+
+	// Format all validation errors into a single string
+	var errMsg string
+	for _, err := range ve.ValidationErrors {
+		errMsg += fmt.Sprintf("- %s\n", err.String())
+	}
+	return fmt.Sprintf("validation failed with the following errors:\n%s", errMsg)
+}
+
+// Optional: Implement the Is() method to allow errors.Is to check this type
+func (ve SchemaValidationError) Is(target error) bool {
+	_, ok := target.(*SchemaValidationError)
+	return ok
+}
+
+// Constructor function for creating a new SchemaValidationError
+func NewSchemaValidationError(errors []gojsonschema.ResultError) error {
+	return &SchemaValidationError{
+		ValidationErrors: errors,
+	}
+}
+
+// Descriptions lists each validation error on its own, for telling the model what to fix.
+func (ve SchemaValidationError) Descriptions() []string {
+	var descriptions []string
+	for _, err := range ve.ValidationErrors {
+		descriptions = append(descriptions, err.String())
+	}
+	return descriptions
+}
+
+// ValidateResumeData checks resumedata against the layouts schema. allowRendererFields is for resumedata that is
+// going to the renderer as is (eg a saved template), rather than coming back from the LLM.
+func (t *Tuner) ValidateResumeData(layout string, resumeData interface{}, allowRendererFields bool) error {
+	var schemaInterface interface{}
+	var err error
+	if allowRendererFields {
+		schemaInterface, err = t.GetRendererJsonSchema(layout)
+	} else {
+		schemaInterface, err = t.GetExpectedResponseJsonSchema(layout)
+	}
+	if err != nil {
+		return err
+	}
+	schemaLoader := gojsonschema.NewGoLoader(schemaInterface)
+	documentLoader := gojsonschema.NewGoLoader(resumeData)
+	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	log.Trace().Msgf("ValidateResumeData err? %#v", err)
+	log.Trace().Msgf("ValidateResumeData result? %#v", result)
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		return NewSchemaValidationError(result.Errors())
+	}
+	return nil
+}
+
+// repairAgainstSchema validates LLM output against the layout schema, and while it doesn't match, shows the model
+// what's wrong and asks for a fixed version. Returns the content that validated, or the last SchemaValidationError
+// once MAX_SCHEMA_REPAIRS have been used up. The repair calls are logged and replayed like any other,
+// as api_response_repair<n>_raw_<counter>.txt.
+func (t *Tuner) repairAgainstSchema(ctx context.Context, request *llm.ChatRequest, content string, layout string, set *prompts.Set, counter int, outputDir string, usage *job.UsageSummary, phase string, updates chan job.JobStatus) (string, error) {
+	for r := 0; ; r++ {
+		decoded, err := DecodeJSON(content)
+		if err != nil {
+			return content, err
+		}
+		err = t.ValidateResumeData(layout, decoded, false)
+		var schemaErr *SchemaValidationError
+		if !errors.As(err, &schemaErr) || r >= MAX_SCHEMA_REPAIRS {
+			return content, err
+		}
+		log.Info().Msgf("%s output didn't match the %s schema: %v", phase, layout, schemaErr)
+		SendJobUpdate(updates, fmt.Sprintf("%s output had %d schema problem(s), asking for a repair", phase, len(schemaErr.ValidationErrors)))
+
+		repairPrompt, err := set.Render(PROMPT_SCHEMA_REPAIR, prompts.Data{SchemaErrors: schemaErr.Descriptions()})
+		if err != nil {
+			return content, err
+		}
+		repairRequest := *request
+		repairRequest.Messages = append(request.Messages[:len(request.Messages):len(request.Messages)], []llm.ChatMessage{
+			{
+				Role:    "assistant",
+				Content: content,
+			}, {
+				Role:    "user",
+				Content: repairPrompt,
+			},
+		}...)
+
+		repairPhase := fmt.Sprintf("%s_repair_%d", phase, r)
+		name := fmt.Sprintf("api_response_repair%d_raw", r)
+		output, err := t.makeAPIRequest(ctx, &repairRequest, counter, name, outputDir, usage, repairPhase, updates)
+		if err != nil {
+			return content, err
+		}
+		content, err = extractCompletionContent(output, repairPhase)
+		if err != nil {
+			return content, err
+		}
+		err = validateJSON(content)
+		if err != nil {
+			return content, err
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package tuner
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
+	"testing"
+)
+
+const validChronoResponse = `{
+	"personal_info": {"name": "Sam", "email": "sam@example.com", "phone": "555", "linkedin": null, "location": "Here", "github": null},
+	"skills": ["go"],
+	"work_history": [{"company": "Acme", "tag": "acme", "location": "Here", "jobtitle": "Gopher", "daterange": "2020 - now",
+		"projects": [{"desc": "made things", "github": null, "location": "Here"}]}],
+	"education_v2": [{"institution": "School", "location": null, "description": "BSc", "graduated": "2019", "notes": null}]
+}`
+
+func schemaTestTuner(t *testing.T, fake *llm.FakeClient) (*Tuner, *prompts.Set) {
+	tuner := promptsTestTuner(t)
+	tuner.config.SchemasPath = filepath.Join("..", "..", "response_templates")
+	tuner.LLM = fake
+	set, err := tuner.Prompts.Set(prompts.DEFAULT_SET)
+	assert.NoError(t, err)
+	return tuner, set
+}
+
+func TestRepairAgainstSchemaAsksForTheProblemsToBeFixed(t *testing.T) {
+	fake := llm.NewFakeClient(validChronoResponse)
+	tuner, set := schemaTestTuner(t, fake)
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	content, err := tuner.repairAgainstSchema(context.Background(), request, `{"skills": ["go"]}`, "chrono", set, 0, t.TempDir(), job.NewUsageSummary(), "attempt_0", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, validChronoResponse, content)
+
+	if assert.Len(t, fake.Requests, 1) {
+		sent := fake.Requests[0].Messages
+		assert.Len(t, sent, 3)
+		assert.Equal(t, `{"skills": ["go"]}`, sent[1].Content)
+		assert.Contains(t, sent[2].Content, "- (root): personal_info is required")
+	}
+	assert.Len(t, request.Messages, 1, "the original request is left alone")
+}
+
+func TestRepairAgainstSchemaGivesUp(t *testing.T) {
+	fake := llm.NewFakeClient(`{"skills": ["still wrong"]}`)
+	tuner, set := schemaTestTuner(t, fake)
+	request := &llm.ChatRequest{Messages: []llm.ChatMessage{{Role: "user", Content: "tune it"}}}
+
+	_, err := tuner.repairAgainstSchema(context.Background(), request, `{"skills": ["go"]}`, "chrono", set, 0, t.TempDir(), job.NewUsageSummary(), "attempt_0", nil)
+	var schemaErr *SchemaValidationError
+	assert.True(t, errors.As(err, &schemaErr))
+	assert.Len(t, fake.Requests, MAX_SCHEMA_REPAIRS)
+}
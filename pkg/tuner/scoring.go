@@ -0,0 +1,112 @@
+package tuner
+
+import (
+	"math"
+)
+
+// ATTEMPT_SCORES_FILENAME is where the score breakdown of every attempt gets saved, next to the other outputs.
+const ATTEMPT_SCORES_FILENAME = "attempt_scores.json"
+
+// ScoredAttempt is everything an AttemptScorer has to go on for an attempt (or a candidate for one).
+type ScoredAttempt struct {
+	Result       inspectResult
+	Content      string //the resumedata
+	Keywords     []string
+	SchemaValid  bool
+	Fabrications int //how many details the fabrication guard flagged
+}
+
+// AttemptScore is how good an attempt is, along with what went into it. Components are unweighted, Total is the weighted sum.
+// Higher is better.
+type AttemptScore struct {
+	Attempt         int     `json:"attempt"`
+	Skipped         bool    `json:"skipped,omitempty"` //never got rendered, so it can't be picked
+	PageFit         float64 `json:"page_fit"`          //1 if it fits in the target pages, otherwise minus how far it overflows in pages
+	Fill            float64 `json:"fill"`              //1 at the aim length, less the further off it is (per target page)
+	KeywordCoverage float64 `json:"keyword_coverage"`  //fraction of the JD keywords in there
+	SchemaValid     float64 `json:"schema_valid"`      //1 if it matches the layout schema, otherwise 0
+	Fabrications    float64 `json:"fabrications"`      //minus the number of details that aren't in the baseline
+	Total           float64 `json:"total"`
+}
+
+// AttemptScorer puts a number on an attempt, so the best one can be picked. Layouts can have their own, see LayoutCustomization.
+type AttemptScorer interface {
+	Score(attempt ScoredAttempt, goal LengthGoal) AttemptScore
+}
+
+// WeightedScorer adds up the score components with a weight each.
+type WeightedScorer struct {
+	PageFitWeight         float64
+	FillWeight            float64
+	KeywordCoverageWeight float64
+	SchemaValidWeight     float64
+	FabricationWeight     float64
+}
+
+// defaultAttemptScorer is used for layouts that don't pick one. Fitting on the page matters most, then being close to the
+// aim length. An overflow of a tenth of a page costs about as much as being a tenth of a page short, on top of not fitting.
+var defaultAttemptScorer AttemptScorer = &WeightedScorer{
+	PageFitWeight:         1,
+	FillWeight:            1,
+	KeywordCoverageWeight: KEYWORD_COVERAGE_WEIGHT,
+	SchemaValidWeight:     1,
+	FabricationWeight:     0.05,
+}
+
+func (s *WeightedScorer) Score(attempt ScoredAttempt, goal LengthGoal) AttemptScore {
+	length := renderedLength(attempt.Result)
+	score := AttemptScore{
+		PageFit:         1,
+		Fill:            math.Max(0, 1-math.Abs(length-aimLength(goal))/float64(goal.Pages)),
+		KeywordCoverage: keywordCoverage(attempt.Content, attempt.Keywords),
+		Fabrications:    -float64(attempt.Fabrications),
+	}
+	if attempt.Result.NumberOfPages > goal.Pages {
+		score.PageFit = -(length - float64(goal.Pages))
+	}
+	if attempt.SchemaValid {
+		score.SchemaValid = 1
+	}
+	score.Total = s.PageFitWeight*score.PageFit +
+		s.FillWeight*score.Fill +
+		s.KeywordCoverageWeight*score.KeywordCoverage +
+		s.SchemaValidWeight*score.SchemaValid +
+		s.FabricationWeight*score.Fabrications
+	//so that attempts that are equally good come out equal, rather than one winning on floating point noise
+	score.Total = math.Round(score.Total*1e6) / 1e6
+	return score
+}
+
+// bestAttemptIndex is the attempt with the highest total, the earliest if it's a tie. -1 if none were rendered.
+func bestAttemptIndex(scores []AttemptScore) int {
+	best := -1
+	for i, score := range scores {
+		if score.Skipped {
+			continue
+		}
+		if best < 0 || score.Total > scores[best].Total {
+			best = i
+		}
+	}
+	return best
+}
+
+// contentMatchesSchema is whether resumedata decodes and is valid for the layout.
+func (t *Tuner) contentMatchesSchema(layout string, content string) bool {
+	decoded, err := DecodeJSON(content)
+	if err != nil {
+		return false
+	}
+	return t.ValidateResumeData(layout, decoded, false) == nil
+}
+
+func (t *Tuner) GetAttemptScorer(layout string) (AttemptScorer, error) {
+	defaults, err := t.GetLayoutDefaults(layout)
+	if err != nil {
+		return nil, err
+	}
+	if defaults.AttemptScorer == nil {
+		return defaultAttemptScorer, nil
+	}
+	return defaults.AttemptScorer, nil
+}
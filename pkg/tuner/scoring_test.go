@@ -0,0 +1,45 @@
+package tuner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWeightedScorerBreakdown(t *testing.T) {
+	goal := LengthGoal{Pages: 1, AcceptableRatio: 0.88}
+	score := defaultAttemptScorer.Score(ScoredAttempt{
+		Result:       inspectResult{NumberOfPages: 2, LastPageContentRatio: 0.2},
+		Content:      `{"skills":["go"]}`,
+		Keywords:     []string{"go", "rust"},
+		SchemaValid:  false,
+		Fabrications: 2,
+	}, goal)
+	assert.InDelta(t, -0.2, score.PageFit, 1e-9)
+	assert.InDelta(t, 0.74, score.Fill, 1e-9)
+	assert.Equal(t, 0.5, score.KeywordCoverage)
+	assert.Equal(t, 0.0, score.SchemaValid)
+	assert.Equal(t, -2.0, score.Fabrications)
+	assert.InDelta(t, -0.2+0.74+0.05-0.1, score.Total, 1e-6)
+
+	clean := defaultAttemptScorer.Score(ScoredAttempt{Result: inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.9}, SchemaValid: true}, goal)
+	flagged := defaultAttemptScorer.Score(ScoredAttempt{Result: inspectResult{NumberOfPages: 1, LastPageContentRatio: 0.9}, SchemaValid: true, Fabrications: 1}, goal)
+	assert.Greater(t, clean.Total, flagged.Total)
+}
+
+func TestSaveBestAttemptRecordsTheScores(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := checkpointTestJob(t, tuner)
+	scores := []AttemptScore{{Attempt: 0, Skipped: true}, {Attempt: 1, PageFit: 1, Total: 2}}
+
+	err := tuner.saveBestAttemptToGCS(scores, nil, tuner.config, testJob, nil)
+	assert.NoError(t, err)
+	recorded, err := os.ReadFile(filepath.Join(testJob.OutputDir, ATTEMPT_SCORES_FILENAME))
+	if assert.NoError(t, err) {
+		decoded, err := DecodeJSON(string(recorded))
+		assert.NoError(t, err)
+		assert.Len(t, decoded, 2)
+		assert.Equal(t, float64(2), decoded.([]interface{})[1].(map[string]interface{})["total"])
+	}
+}
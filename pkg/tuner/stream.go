@@ -0,0 +1,53 @@
+package tuner
+
+import (
+	"fmt"
+	"pdfinspector/pkg/job"
+	"strings"
+	"time"
+)
+
+// STREAM_UPDATE_INTERVAL is the least time between streamed progress updates, so the NDJSON feed doesn't get a line per token.
+const STREAM_UPDATE_INTERVAL = 500 * time.Millisecond
+
+// streamForwarder batches up the deltas from a streaming completion into JobStatus updates.
+type streamForwarder struct {
+	phase    string
+	updates  chan job.JobStatus
+	pending  strings.Builder
+	tokens   int
+	lastSent time.Time
+}
+
+func newStreamForwarder(phase string, updates chan job.JobStatus) *streamForwarder {
+	return &streamForwarder{
+		phase:   phase,
+		updates: updates,
+	}
+}
+
+// handle is the llm.StreamHandler. The first delta goes out straight away so the user knows the response has started.
+func (f *streamForwarder) handle(delta string, tokens int) {
+	f.pending.WriteString(delta)
+	f.tokens = tokens
+	if time.Since(f.lastSent) >= STREAM_UPDATE_INTERVAL {
+		f.flush()
+	}
+}
+
+// flush sends whatever has been received since the last update, if anything.
+func (f *streamForwarder) flush() {
+	if f.updates == nil || f.pending.Len() == 0 {
+		return
+	}
+	f.updates <- job.JobStatus{
+		Message: fmt.Sprintf("Receiving response for %s (%d tokens so far)", f.phase, f.tokens),
+		Stream: &job.StreamProgress{
+			Phase:  f.phase,
+			Tokens: f.tokens,
+			Delta:  f.pending.String(),
+		},
+	}
+	f.pending.Reset()
+	f.lastSent = time.Now()
+}
@@ -1,6 +1,7 @@
 package tuner
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,15 +11,49 @@ import (
 	"pdfinspector/pkg/config"
 	"pdfinspector/pkg/filesystem"
 	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
+	"strings"
 	"time"
 )
 
 var TrueVal = true
 
-func (t *Tuner) TuneResumeContents(job *job.Job, updates chan job.JobStatus) error {
+func (t *Tuner) TuneResumeContents(ctx context.Context, job *job.Job, updates chan job.JobStatus) (err error) {
 	job.Log().Info().Str("user_key", job.UserKey).Msgf("starting TuneResumeContents")
+	checkpoint := &Checkpoint{Job: job, started: time.Now()}
+	defer func() {
+		t.saveTuningOutcome(checkpoint, err)
+	}()
+	t.saveJobPromptVersion(job)
+	err = t.startTuning(ctx, checkpoint, updates)
+	if err != nil {
+		return err
+	}
+	return t.tuneAttempts(ctx, checkpoint, updates)
+}
+
+// ContinueTuneResumeContents carries on a job that was interrupted (eg the instance running it got recycled) from its last checkpoint,
+// see LoadCheckpoint. Attempts that were already made aren't asked for again.
+func (t *Tuner) ContinueTuneResumeContents(ctx context.Context, checkpoint *Checkpoint, updates chan job.JobStatus) (err error) {
+	job := checkpoint.Job
+	job.Log().Info().Str("user_key", job.UserKey).Msgf("continuing TuneResumeContents from attempt %d", checkpoint.NextAttempt)
+	if checkpoint.State != CHECKPOINT_RUNNING {
+		return fmt.Errorf("job %s is %s, only an interrupted job can be resumed", job.Id, checkpoint.State)
+	}
+	defer func() {
+		t.saveTuningOutcome(checkpoint, err)
+	}()
+	checkpoint.started = time.Now() //the wall time budget is per run, a job interrupted for hours shouldn't have used it up
+	t.restoreAttemptFiles(ctx, checkpoint)
+	return t.tuneAttempts(ctx, checkpoint, updates)
+}
+
+// startTuning takes notes on the JD and composes the opening of the conversation, everything before the first attempt.
+func (t *Tuner) startTuning(ctx context.Context, checkpoint *Checkpoint, updates chan job.JobStatus) error {
+	job := checkpoint.Job
 	SendJobUpdate(updates, "getting any JD meta")
-	jDmetaRawJSON, err := t.takeNotesOnJD(job)
+	jDmetaRawJSON, err := t.takeNotesOnJD(ctx, job, updates)
 	if err != nil {
 		job.Log().Info().Msgf("error taking notes on JD: %s", err.Error())
 		return err
@@ -36,51 +71,96 @@ func (t *Tuner) TuneResumeContents(job *job.Job, updates chan job.JobStatus) err
 		return err
 	}
 
-	expectResponseSchema, err := t.GetExpectedResponseJsonSchema(job.Layout)
+	systemPrompt, err := t.renderPrompt(job, PROMPT_TUNE_SYSTEM, prompts.Data{AcceptableRatio: int(job.AcceptableRatio * 100)})
+	if err != nil {
+		return err
+	}
 
-	// Create a map to represent the API request structure
-	data := map[string]interface{}{
-		"model": "gpt-4o-mini",
-		"messages": []map[string]interface{}{
-			{
-				"role": "system",
-				//"content": fmt.Sprintf("You are a helpful resume tuning person (not a bot or an AI). The response should include only the fields expected to be rendered by the application, in well-formed JSON, without any triple quoting, such that the final resume fills one page to between %d%% and 95%%, leaving only a small margin at the bottom.", int(acceptable_ratio*100)),
-				//"content": fmt.Sprintf("You are a helpful resume tuning assistant. The response should include resume content such that the final resume fills one page to between %d%% and 95%%, leaving only a small margin at the bottom. The output must respect the supplied JSON schema including having some value for fields identified as required in the schema", int(acceptable_ratio*100)),
-				"content": fmt.Sprintf("You are a helpful resume tuning assistant. The response should include resume content such that the final resume fills one page to between %d%% and 95%%, leaving only a small margin at the bottom.", int(job.AcceptableRatio*100)),
-			},
-			// this was the way to do it without using the structured output facilities. tbh i'm still not sure what was producing better results but continuing on with the "right" way (structured output) at present.
-			//todo move this to readme
-			// mostly keeping this commented bit for posterity
-			//{
-			//	"role":    "user",
-			//	"content": "Show me an example input for the resume system to ingest",
-			//},
-			//{
-			//	"role":    "assistant",
-			//	"content": input.ExpectResponse,
-			//},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
+	checkpoint.Keywords = jDMetaDecoded.Keywords
+	checkpoint.Messages = []llm.ChatMessage{
+		{
+			Role:    "system",
+			Content: systemPrompt,
+		},
+		// this was the way to do it without using the structured output facilities. tbh i'm still not sure what was producing better results but continuing on with the "right" way (structured output) at present.
+		//todo move this to readme
+		// mostly keeping this commented bit for posterity
+		//{
+		//	Role:    "user",
+		//	Content: "Show me an example input for the resume system to ingest",
+		//},
+		//{
+		//	Role:    "assistant",
+		//	Content: input.ExpectResponse,
+		//},
+		{
+			Role:    "user",
+			Content: prompt,
 		},
-		"response_format": map[string]interface{}{
-			"type": "json_schema",
-			"json_schema": map[string]interface{}{
-				"name":   "candidate_resume",
-				"strict": true,
-				"schema": expectResponseSchema,
-			},
+	}
+	checkpoint.NextMessages = checkpoint.Messages
+	checkpoint.State = CHECKPOINT_RUNNING
+	return nil
+}
+
+// tuneAttempts is the attempt loop, from wherever the checkpoint is up to. A checkpoint is saved before every attempt.
+func (t *Tuner) tuneAttempts(ctx context.Context, checkpoint *Checkpoint, updates chan job.JobStatus) error {
+	job := checkpoint.Job
+	truncatedPrompt, err := t.renderPrompt(job, PROMPT_TRUNCATED, prompts.Data{})
+	if err != nil {
+		return err
+	}
+
+	lengthController, err := t.GetLengthController(job.Layout)
+	if err != nil {
+		return err
+	}
+	scorer, err := t.GetAttemptScorer(job.Layout)
+	if err != nil {
+		return err
+	}
+
+	expectResponseSchema, err := t.GetExpectedResponseJsonSchema(job.Layout)
+
+	// Create the API request structure
+	request := &llm.ChatRequest{
+		Model:    job.Model,
+		Messages: checkpoint.NextMessages,
+		ResponseSchema: &llm.ResponseSchema{
+			Name:   "candidate_resume",
+			Strict: true,
+			Schema: expectResponseSchema,
 		},
-		//"max_tokens":  2000, //idk i had legit response go over 2000 because it was wordy. not sure that bug where it generated full stream of garbage happened again after putting on 'strict' tho. keep an eye on things.
-		"temperature": 0.7,
-		"user":        job.UserID,
+		//MaxTokens:  2000, //idk i had legit response go over 2000 because it was wordy. not sure that bug where it generated full stream of garbage happened again after putting on 'strict' tho. keep an eye on things.
+		MaxTokens:   t.jobMaxTokens(job),
+		Temperature: t.jobTemperature(job),
+		User:        job.UserID,
 	}
-	messages := data["messages"].([]map[string]interface{}) //preserve orig
+	messages := checkpoint.Messages //preserve orig
 
-	var attemptsLog []inspectResult
-	for i := 0; i < job.MaxAttempts; i++ {
-		api_request_pretty, err := serializeToJSON(data)
+	goal := lengthGoalForJob(job.TargetPages, job.AcceptableRatio)
+	var lastCompletionErr error
+	var exhausted string
+	for i := checkpoint.NextAttempt; ; i++ {
+		if ctx.Err() != nil {
+			//cancelled, or the client went away. nothing after this is wanted.
+			return ctx.Err()
+		}
+		if i >= job.Budget.MaxAttempts {
+			job.Log().Info().Msgf("tried enough now, stopping after %d attempt(s)", i)
+			break
+		}
+		exhausted = job.Budget.Exhausted(checkpoint.started, job.Usage.Totals().TotalTokens)
+		if exhausted != "" {
+			job.Log().Info().Msgf("%s budget exhausted after %d attempt(s)", exhausted, i)
+			job.BudgetExhausted = exhausted
+			sendBudgetExhausted(updates, job.Budget, exhausted)
+			break
+		}
+		checkpoint.NextAttempt = i
+		checkpoint.NextMessages = request.Messages
+		t.saveCheckpoint(checkpoint)
+		api_request_pretty, err := serializeToJSON(request)
 		if err != nil {
 			return fmt.Errorf("Failed to marshal final JSON: %v", err)
 		}
@@ -89,137 +169,143 @@ func (t *Tuner) TuneResumeContents(job *job.Job, updates chan job.JobStatus) err
 			return fmt.Errorf("Failed to log api request locally: %v", err)
 		}
 
-		exists, output, err := checkForPreexistingAPIOutput(job.OutputDir, "api_response_raw", i)
-		if err != nil {
-			return fmt.Errorf("Error checking for pre-existing API output: %v", err)
-		}
-		if !exists {
-			SendJobUpdate(updates, fmt.Sprintf("asking for an attempt %d", i))
-			output, err = t.makeAPIRequest(data, i, "api_response_raw", job.OutputDir)
-			if err != nil {
-				return err
+		candidates := t.renderCandidates(ctx, job, request, i, updates)
+		best := pickBestCandidate(candidates, scorer, checkpoint.Keywords, goal)
+		if best < 0 {
+			//none of them made it. a hard error from any of them fails the job like it always has, but an unusable
+			//completion or output that couldn't be repaired to match the schema only costs us the attempt.
+			var completionErr *CompletionError
+			var schemaErr *SchemaValidationError
+			for _, candidate := range candidates {
+				if !errors.As(candidate.err, &completionErr) && !errors.As(candidate.err, &schemaErr) {
+					return candidate.err
+				}
 			}
-		}
-
-		//openai api should have responded to our request with a json text that can be used as resumedata input. extract it.
-		var apiResponse APIResponse
-		err = json.Unmarshal([]byte(output), &apiResponse)
-		if err != nil {
-			job.Log().Error().Msgf("Error deserializing API response: %v", err)
-			return err
-		}
-
-		//Extract the message content
-		if len(apiResponse.Choices) == 0 {
-			return errors.New("no choices found in the API response")
-		}
-
-		content := apiResponse.Choices[0].Message.Content
-
-		err = validateJSON(content)
-		if err != nil {
-			job.Log().Error().Msgf("Error validating JSON content: %v", err)
-			return err
-		}
-		job.Log().Info().Msgf("Got %d bytes of JSON content (at least well formed enough to be decodable) out of that last response", len(content))
-		SendJobUpdate(updates, fmt.Sprintf("got JSON for attempt %d, will request PDF", i))
-
-		err = WriteAttemptResumedataJSON(content, job, i, t.Fs, t.config)
-
-		//we should be able to render that updated content proposal now via gotenberg + ghostscript
-		maxGotenAttempts := 3
-		for k := 0; k < maxGotenAttempts; k++ {
-			err = makePDFRequestAndSave(i, t.config, job)
-			if err == nil {
+			checkpoint.AttemptsLog = append(checkpoint.AttemptsLog, inspectResult{Skipped: true})
+			checkpoint.Scores = append(checkpoint.Scores, AttemptScore{Attempt: i, Skipped: true})
+			checkpoint.RequestedChange = 0
+			if completionErr == nil {
+				lastCompletionErr = schemaErr
+				if i+1 < job.Budget.MaxAttempts {
+					SendJobUpdate(updates, fmt.Sprintf("attempt %d never matched the schema, asking again", i))
+					continue
+				}
 				break
 			}
-			var httpErr *GotenbergHTTPError
-			if errors.As(err, &httpErr) {
-				// Handle the error based on the HTTP code
-				job.Log().Info().Msgf("Got a retryable error from Gotenberg, code %d", httpErr.HttpResponseCode)
-				time.Sleep(1 * time.Second)
+			lastCompletionErr = completionErr
+			if errors.Is(completionErr, ErrCompletionTruncated) && i+1 < job.Budget.MaxAttempts {
+				//nothing useful to show it from a cut off response, so just ask again from the original prompt for less.
+				SendJobUpdate(updates, fmt.Sprintf("attempt %d response was cut off, asking again for shorter content", i))
+				request.Messages = append(messages[:len(messages):len(messages)], llm.ChatMessage{
+					Role:    "user",
+					Content: truncatedPrompt,
+				})
 				continue
-			} else if err != nil {
-				return err
 			}
+			//a refusal is unlikely to change by asking again. stop here and go with the best earlier attempt, if there was one.
+			SendJobUpdate(updates, fmt.Sprintf("attempt %d: %v", i, completionErr))
+			break
 		}
-		SendJobUpdate(updates, fmt.Sprintf("got PDF for attempt %d, will dump to PNG", i))
-
-		//and the ghostscript dump to pngs ...
-		err = dumpPDFToPNG(i, job.OutputDir, t.config)
-		if err != nil {
-			return fmt.Errorf("Error during pdf to image dump: %v", err)
+		if len(candidates) > 1 {
+			job.Log().Info().Msgf("picked candidate %d of %d for attempt %d", best, len(candidates), i)
+			SendJobUpdate(updates, fmt.Sprintf("picked candidate %d of %d for attempt %d", best, len(candidates), i))
 		}
-		SendJobUpdate(updates, fmt.Sprintf("got PNGs for attempt %d, will check it", i))
-
-		result, err := inspectPNGFiles(job.OutputDir, i)
+		winner := candidates[best]
+		if pruned, ok := t.pruneToFit(ctx, job, winner, i, goal, checkpoint.started, updates); ok {
+			winner = pruned
+		}
+		err = t.promoteCandidate(job, winner, i)
 		if err != nil {
-			job.Log().Error().Msgf("Error inspecting png files: %v", err)
 			return err
 		}
-		attemptsLog = append(attemptsLog, result)
+		t.saveAttemptPDF(job, i)
+		content := winner.content
+		result := winner.result
+		result.RequestedChange = checkpoint.RequestedChange
+		checkpoint.AttemptsLog = append(checkpoint.AttemptsLog, result)
+
+		//checked after pruning, which may well have taken out something that was flagged
+		fabrications := fabricationsIn(job, content)
+		checkpoint.FabricationReport = append(checkpoint.FabricationReport, fabricationReportEntry{Attempt: i, Corrected: winner.reverted, Warnings: fabrications})
+		sendFabricationWarnings(updates, i, fabrications)
+
+		score := scorer.Score(ScoredAttempt{
+			Result:       result,
+			Content:      content,
+			Keywords:     checkpoint.Keywords,
+			SchemaValid:  t.contentMatchesSchema(job.Layout, content),
+			Fabrications: len(fabrications),
+		}, goal)
+		score.Attempt = i
+		checkpoint.Scores = append(checkpoint.Scores, score)
 
-		job.Log().Info().Msgf("inspect result: %#v", result)
-		if result.NumberOfPages == 0 {
-			return fmt.Errorf("no pages, idk just stop")
-		}
 		SendJobUpdate(updates, fmt.Sprintf("attempt %d png inspection, content ratio: %.2f, page count: %d", i, result.LastPageContentRatio, result.NumberOfPages))
 
-		tryNewPrompt := false
+		//which length correction to ask for, if any
+		instruction := lengthController.Next(checkpoint.AttemptsLog, goal)
+		if instruction.Stop {
+			job.Log().Info().Msgf("over %d%% and still on %d page(s)? nice. we should stop (determined complete after attempt index %d).", int(job.AcceptableRatio*100), goal.Pages, i)
+			//we will stop now, and this will most likely be the best scoring one picked later if we are saving one to gcs.
+			break
+		}
+		job.Log().Info().Msgf("length controller says: %#v", instruction)
+		checkpoint.RequestedChange = instruction.Change()
+		tryPromptTemplate := instruction.Template
+		promptData := prompts.Data{
+			AcceptableRatio: int(job.AcceptableRatio * 100),
+			ContentRatio:    int(result.LastPageContentRatio * 100),
+			NumberOfPages:   result.NumberOfPages,
+			ReduceByPct:     instruction.ReduceByPct,
+			IncreaseByPct:   instruction.IncreaseByPct,
+		}
+		tryNewPrompt := tryPromptTemplate != ""
 		var tryPrompt string
-		if result.NumberOfPages > 1 {
-			if result.NumberOfPages > 2 {
-				job.Log().Info().Msgf("too many pages , this could be interesting ... (untested!)")
-				tryNewPrompt = true
-				tryPrompt = fmt.Sprintf("That was way too long, reduce the amount of content to try to get it down to one full page by summarizing or removing some existing project descriptions, removing projects within companies or by shortening up the skills list. Remember to make the candidate still look great in relation to the Job Description supplied earlier!")
-			} else {
-				reduceByPct := int(((result.LastPageContentRatio / (1 + result.LastPageContentRatio)) * 100) / 2)
-				job.Log().Info().Msgf("only one extra page .... reduce by %d%%", reduceByPct)
-				tryNewPrompt = true
-				//tryPrompt = fmt.Sprintf("Too long, reduce by %d%%, by making minimal edits to the prior output as possible. Sometimes going overboard on skills makes it too long. Remember to make the candidate still look great in relation to the Job Description supplied earlier!", reduceByPct)
-				tryPrompt = fmt.Sprintf("Too long, reduce the total content length by %d%%, while still keeping the information highly relevant to the Job Description.", reduceByPct)
+		if tryNewPrompt {
+			tryPrompt, err = t.renderPrompt(job, tryPromptTemplate, promptData)
+			if err != nil {
+				return err
 			}
-		} else if result.NumberOfPages == 1 && result.LastPageContentRatio < job.AcceptableRatio {
-			job.Log().Info().Msgf("make it longer ...")
-			tryNewPrompt = true
-			//tryPrompt = fmt.Sprintf("Not long enough when rendered, was only %d%% of the page. Fill it up to between %d%% and 95%%. You can bulk up the content of existing project descriptions, add new projects within companies or by beefing up the skills list. Remember to make the candidate look even greater in relation to the Job Description supplied earlier!", int(result.LastPageContentRatio*100), int(acceptable_ratio*100))
-			increaseByPct := int((95.0 - result.LastPageContentRatio*100) / 2) //wat? idk smthin like this anyway.
-			//tryPrompt = fmt.Sprintf("Not long enough, increase by %d%%, you can bulk up the content of existing project descriptions, add new projects within companies or by beefing up the skills list. Remember to make the candidate look even greater in relation to the Job Description supplied earlier!", increaseByPct)
-			tryPrompt = fmt.Sprintf("Not long enough, increase the total content length by %d%%, while still keeping the information highly relevant to the Job Description.", increaseByPct)
-
-			//try to make it longer!!! - include the assistants last message in the new prompt so it can see what it did
-		} else if result.NumberOfPages == 1 && result.LastPageContentRatio >= job.AcceptableRatio {
-			job.Log().Info().Msgf("over %d%% and still on one page? nice. we should stop (determined complete after attempt index %d).", int(job.AcceptableRatio*100), i)
-			//we will stop now, and this will be the 'best' one found by getBestAttemptIndex later if we are saving one to gcs.
-			break
 		}
 		job.Log().Info().Msgf("will try new prompt: %s", tryPrompt)
 		if tryNewPrompt {
 			//not sure what the best approach is, to only send the assistants last response and the new prompt,
-			data["messages"] = append(messages, []map[string]interface{}{
+			request.Messages = append(messages[:len(messages):len(messages)], []llm.ChatMessage{
 				{
-					"role":    "assistant",
-					"content": content,
+					Role:    "assistant",
+					Content: content,
 				}, {
-					"role":    "user",
-					"content": tryPrompt,
+					Role:    "user",
+					Content: tryPrompt,
 				},
 			}...)
 
 			//or to keep stacking them...
-			//messages = append(messages, []map[string]interface{}{
+			//messages = append(messages, []llm.ChatMessage{
 			//	{
-			//		"role":    "assistant",
-			//		"content": content,
+			//		Role:    "assistant",
+			//		Content: content,
 			//	}, {
-			//		"role":    "user",
-			//		"content": tryPrompt,
+			//		Role:    "user",
+			//		Content: tryPrompt,
 			//	},
 			//}...)
-			//data["messages"] = messages
+			//request.Messages = messages
 		}
 	}
-	err = t.saveBestAttemptToGCS(attemptsLog, t.Fs, t.config, job, updates)
+	if bestAttemptIndex(checkpoint.Scores) < 0 && lastCompletionErr != nil {
+		//never got anything that could be rendered
+		return lastCompletionErr
+	}
+	if bestAttemptIndex(checkpoint.Scores) < 0 && exhausted != "" {
+		return fmt.Errorf("%w: used up the %s budget of %s before any attempt was rendered", ErrBudgetExhausted, exhausted, describeBudget(job.Budget, exhausted))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if bestAttemptIndex(checkpoint.Scores) < 0 {
+		return fmt.Errorf("none of the %d attempt(s) could be rendered", job.Budget.MaxAttempts)
+	}
+	err = t.saveBestAttemptToGCS(checkpoint.Scores, t.Fs, t.config, job, updates)
 	if err != nil {
 		return err
 	}
@@ -228,13 +314,23 @@ func (t *Tuner) TuneResumeContents(job *job.Job, updates chan job.JobStatus) err
 }
 
 // alright this is my cheesy naive implementation that just reads the file and then writes it but in short order i'd like to try out streaming it from fs to gcs with code similar to what is commented below this func implementation
-func (t *Tuner) saveBestAttemptToGCS(results []inspectResult, fs filesystem.FileSystem, config *config.ServiceConfig, job *job.Job, updates chan job.JobStatus) error {
+// The best attempt is the one the layouts AttemptScorer scored highest, the score breakdown of every attempt is saved either way.
+func (t *Tuner) saveBestAttemptToGCS(scores []AttemptScore, fs filesystem.FileSystem, config *config.ServiceConfig, job *job.Job, updates chan job.JobStatus) error {
+	t.saveAttemptScores(job, scores)
+	bestAttemptIndex := bestAttemptIndex(scores)
+	formats := []string{OUTPUT_FORMAT_PDF}
+	if bestAttemptIndex >= 0 {
+		//the other formats come from the resumedata, so they can be saved (locally at least) whatever the fs is
+		formats = t.saveExports(job, bestAttemptIndex)
+	}
 	//only if we're using gs fs of course.
 	if config.FsType != "gcs" {
 		return nil //not an error, but we can't proceed with gcs stuff without this being gcs.
 	}
 
-	bestAttemptIndex := getBestAttemptIndex(results)
+	if bestAttemptIndex < 0 {
+		return errors.New("no attempt was rendered, nothing to save")
+	}
 	filepath := filepath.Join(job.OutputDir, fmt.Sprintf("attempt%d.pdf", bestAttemptIndex))
 	// Check if the file exists
 	_, err := os.Stat(filepath)
@@ -274,14 +370,65 @@ func (t *Tuner) saveBestAttemptToGCS(results []inspectResult, fs filesystem.File
 		//so while the file will always actually be Output.pdf we can save a better filename here, for the users generations list.
 		genObjPath := fmt.Sprintf("sso/%s/gen/%s/%s", job.UserID, job.Id, t.GetOuputFileName(job.Layout))
 		job.Log().Info().Msgf("should note sso ownership at %s", genObjPath)
-		fs.WriteFile(genObjPath, []byte{})
+		record, _ := json.Marshal(GenerationRecord{Formats: formats})
+		fs.WriteFile(genObjPath, record)
 	}
 
 	job.Log().Info().Msgf("saveBestAttemptToGCS believed to be complete - bestAttemptIndex was %d", bestAttemptIndex)
 	SendJobUpdate(updates, fmt.Sprintf("wrote %d bytes to GCS, download PDF via: %s/joboutput/%s/%s", bytesCount, config.ServiceUrl, job.Id, copyToFilename))
+	if len(formats) > 1 {
+		SendJobUpdate(updates, fmt.Sprintf("also saved as %s, download with ?format= on the same url", strings.Join(formats[1:], ", ")))
+	}
 	return nil
 }
 
+// saveAttemptScores writes the score breakdown of each attempt next to the other outputs.
+func (t *Tuner) saveAttemptScores(j *job.Job, scores []AttemptScore) {
+	if len(scores) == 0 {
+		return
+	}
+	scoresJSON, err := serializeToJSON(scores)
+	if err != nil {
+		j.Log().Error().Msgf("Error serializing attempt scores: %v", err)
+		return
+	}
+	t.saveJobOutputFile(j, ATTEMPT_SCORES_FILENAME, scoresJSON)
+}
+
+// saveUsageSummary writes the token usage for the job next to the other outputs, locally and to gcs if that's what we're using.
+func (t *Tuner) saveUsageSummary(job *job.Job) {
+	if job.Usage == nil {
+		return
+	}
+	usageJSON, err := serializeToJSON(job.Usage)
+	if err != nil {
+		job.Log().Error().Msgf("Error serializing usage summary: %v", err)
+		return
+	}
+	totals := job.Usage.Totals()
+	job.Log().Info().Msgf("job used %d tokens over %d LLM calls, estimated cost $%.4f", totals.TotalTokens, totals.Calls, totals.EstimatedCostUSD)
+
+	t.saveJobOutputFile(job, USAGE_FILENAME, usageJSON)
+}
+
+// saveJobOutputFile writes a small bookkeeping file next to the other outputs, locally and to gcs if that's what we're using.
+// Failures are only logged, these files are nice to have but not worth failing a job over.
+func (t *Tuner) saveJobOutputFile(job *job.Job, filename string, content string) {
+	err := os.MkdirAll(job.OutputDir, 0755)
+	if err == nil {
+		err = WriteValidatedContent(content, filepath.Join(job.OutputDir, filename))
+	}
+	if err != nil {
+		job.Log().Error().Msgf("Error writing %s locally: %v", filename, err)
+	}
+	if t.config.FsType == "gcs" {
+		err = t.Fs.WriteFile(fmt.Sprintf("%s/%s", job.OutputDir, filename), []byte(content))
+		if err != nil {
+			job.Log().Error().Msgf("Error writing %s to GCS: %v", filename, err)
+		}
+	}
+}
+
 func SendJobUpdate(updates chan job.JobStatus, message string) {
 	if updates == nil {
 		return
@@ -294,17 +441,3 @@ func SendJobErrorUpdate(updates chan job.JobStatus, message string) {
 	}
 	updates <- job.JobStatus{Message: message, Error: &TrueVal}
 }
-
-func getBestAttemptIndex(results []inspectResult) int {
-	bestResult := 0
-	for i, v := range results {
-		if v.NumberOfPages > results[bestResult].NumberOfPages {
-			continue
-		}
-		if v.LastPageContentRatio < results[bestResult].LastPageContentRatio {
-			continue
-		}
-		bestResult = i
-	}
-	return bestResult
-}
@@ -1,6 +1,35 @@
 package tuner
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"pdfinspector/pkg/cassette"
+	"pdfinspector/pkg/job"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/render"
+	"testing"
+)
+
+// bestOf scores inspect results the default way, on length alone, and picks the best.
+func bestOf(attempts []inspectResult, targetPages int) int {
+	goal := lengthGoalForJob(targetPages, defaultAcceptableRatio)
+	scores := make([]AttemptScore, len(attempts))
+	for i, attempt := range attempts {
+		if attempt.Skipped {
+			scores[i] = AttemptScore{Attempt: i, Skipped: true}
+			continue
+		}
+		scores[i] = defaultAttemptScorer.Score(ScoredAttempt{Result: attempt, SchemaValid: true}, goal)
+	}
+	return bestAttemptIndex(scores)
+}
 
 func TestCorrectlyPicksBetterPNGInspectResultFromMultipage(t *testing.T) {
 	attempts := []inspectResult{{
@@ -16,7 +45,7 @@ func TestCorrectlyPicksBetterPNGInspectResultFromMultipage(t *testing.T) {
 		NumberOfPages:        1,
 		LastPageContentRatio: 0.66,
 	}}
-	best := getBestAttemptIndex(attempts)
+	best := bestOf(attempts, 1)
 	if best != 0 {
 		t.Fatalf("wrong index for best attempt")
 	}
@@ -36,8 +65,180 @@ func TestCorrectlyPicksBetterPNGInspectResultFromSinglepage(t *testing.T) {
 		NumberOfPages:        1,
 		LastPageContentRatio: 0.66,
 	}}
-	best := getBestAttemptIndex(attempts)
+	best := bestOf(attempts, 1)
 	if best != 2 {
 		t.Fatalf("wrong index for best attempt")
 	}
 }
+
+func TestBestAttemptIgnoresSkippedAttempts(t *testing.T) {
+	attempts := []inspectResult{{
+		Skipped: true,
+	}, {
+		NumberOfPages:        2,
+		LastPageContentRatio: 0.2,
+	}, {
+		Skipped: true,
+	}}
+	best := bestOf(attempts, 1)
+	if best != 1 {
+		t.Fatalf("wrong index for best attempt")
+	}
+	if bestOf([]inspectResult{{Skipped: true}}, 1) != -1 {
+		t.Fatalf("expected no best attempt when every attempt was skipped")
+	}
+}
+
+func TestBestAttemptForTwoPagesFillsTheSecondPage(t *testing.T) {
+	attempts := []inspectResult{
+		{NumberOfPages: 1, LastPageContentRatio: 0.95},
+		{NumberOfPages: 2, LastPageContentRatio: 0.5},
+		{NumberOfPages: 3, LastPageContentRatio: 0.1},
+		{NumberOfPages: 2, LastPageContentRatio: 0.3},
+	}
+	if bestOf(attempts, 2) != 1 {
+		t.Fatalf("wrong index for best attempt")
+	}
+	//none fit, so the one that overflows least
+	attempts = []inspectResult{
+		{NumberOfPages: 3, LastPageContentRatio: 0.4},
+		{NumberOfPages: 3, LastPageContentRatio: 0.2},
+	}
+	if bestOf(attempts, 2) != 1 {
+		t.Fatalf("wrong index for best attempt")
+	}
+}
+
+func TestBestAttemptEquallyCloseToTheAimKeepsTheEarlierOne(t *testing.T) {
+	//aim is 0.94, these are both 0.03 off it
+	attempts := []inspectResult{
+		{NumberOfPages: 1, LastPageContentRatio: 0.91},
+		{NumberOfPages: 1, LastPageContentRatio: 0.97},
+	}
+	if bestOf(attempts, 1) != 0 {
+		t.Fatalf("wrong index for best attempt")
+	}
+}
+
+func TestBestAttemptPrefersAnUnderfilledPageToAnOverflow(t *testing.T) {
+	attempts := []inspectResult{
+		{NumberOfPages: 2, LastPageContentRatio: 0.05},
+		{NumberOfPages: 1, LastPageContentRatio: 0.5},
+	}
+	if bestOf(attempts, 1) != 1 {
+		t.Fatalf("wrong index for best attempt")
+	}
+}
+
+// chronoWithProjects is validChronoResponse with the one job having this many projects.
+func chronoWithProjects(t *testing.T, projects int) string {
+	var data map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(validChronoResponse), &data))
+	company := data["work_history"].([]interface{})[0].(map[string]interface{})
+	list := make([]interface{}, projects)
+	for p := range list {
+		list[p] = map[string]interface{}{"desc": fmt.Sprintf("made thing %d", p+1), "github": nil, "location": "Here"}
+	}
+	company["projects"] = list
+	content, err := json.Marshal(data)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+// projectsRasterizer stands in for ghostscript: every project in the attempts resumedata takes up perProject of a page,
+// whatever is in the PDF.
+func projectsRasterizer(perProject float64) func(ctx context.Context, attempt int, outputDir string) error {
+	return func(ctx context.Context, attempt int, outputDir string) error {
+		return rasterizeProjects(perProject, attempt, outputDir)
+	}
+}
+
+func rasterizeProjects(perProject float64, attempt int, outputDir string) error {
+	content, err := os.ReadFile(filepath.Join(outputDir, fmt.Sprintf("attempt%d.json", attempt)))
+	if err != nil {
+		return err
+	}
+	decoded, err := DecodeJSON(string(content))
+	if err != nil {
+		return err
+	}
+	data, _ := decoded.(map[string]interface{})
+	company, _ := data["work_history"].([]interface{})[0].(map[string]interface{})
+	fill := math.Round(perProject*float64(len(company["projects"].([]interface{})))*100) / 100
+	pages := int(math.Ceil(fill))
+	for p := 1; p <= pages; p++ {
+		file, err := os.Create(filepath.Join(outputDir, fmt.Sprintf("out%d-%03d.png", attempt, p)))
+		if err != nil {
+			return err
+		}
+		contentTo := 1100
+		if p == pages {
+			contentTo = int(math.Round((fill - float64(pages-1)) * 1100))
+		}
+		err = png.Encode(file, pageImage(1100, contentTo))
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayTestTuner has the LLM and renderer going through a cassette in dir, with the stub renderer behind it.
+func replayTestTuner(t *testing.T, fake *llm.FakeClient, dir string, mode cassette.Mode) *Tuner {
+	tuner, _ := schemaTestTuner(t, fake)
+	tuner.config.FsType = "local"
+	tuner.config.LocalPath = t.TempDir()
+	recording, err := cassette.New(dir, mode, cassette.MatchRequest)
+	assert.NoError(t, err)
+	tuner.Cassette = recording
+	tuner.LLM = llm.NewCassetteClient(fake, recording)
+	tuner.Renderer = render.NewCassetteRenderer(render.NewStubRenderer(), recording)
+	tuner.rasterize = projectsRasterizer(0.3)
+	return tuner
+}
+
+func replayTestJob(t *testing.T, tuner *Tuner) *job.Job {
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.JobDescription = "Wanted: gopher"
+	testJob.BaselineJSON = chronoWithProjects(t, 4)
+	testJob.Budget = job.Budget{MaxAttempts: 5}
+	assert.NoError(t, tuner.PopulateJob(testJob, nil))
+	assert.NoError(t, os.MkdirAll(testJob.OutputDir, 0755))
+	return testJob
+}
+
+func TestTuneResumeContentsReplaysFromCassette(t *testing.T) {
+	dir := t.TempDir()
+	jdNotes := `{"company_name": "Acme", "job_title": "Gopher", "keywords": ["go"], "location": "Here", "remote_ok": null, "salary_info": null, "process": null}`
+	//too long (2 pages), then too short, then just right
+	recorded := llm.NewFakeClient(jdNotes, chronoWithProjects(t, 4), chronoWithProjects(t, 2), chronoWithProjects(t, 3))
+	tuner := replayTestTuner(t, recorded, dir, cassette.ModeRecord)
+	assert.NoError(t, tuner.TuneResumeContents(context.Background(), replayTestJob(t, tuner), nil))
+	assert.Len(t, recorded.Requests, 4)
+
+	replayed := llm.NewFakeClient()
+	replayed.Handler = func(request *llm.ChatRequest) (*llm.ChatResponse, error) {
+		return nil, errors.New("nothing should reach the LLM when replaying")
+	}
+	tuner = replayTestTuner(t, replayed, dir, cassette.ModeReplay)
+	testJob := replayTestJob(t, tuner)
+	assert.NoError(t, tuner.TuneResumeContents(context.Background(), testJob, nil))
+	assert.Empty(t, replayed.Requests)
+
+	checkpoint, err := tuner.LoadCheckpoint(context.Background(), testJob.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, CHECKPOINT_FINISHED, checkpoint.State)
+		if assert.Len(t, checkpoint.AttemptsLog, 3) {
+			assert.Equal(t, 2, checkpoint.AttemptsLog[0].NumberOfPages)
+			assert.InDelta(t, 0.6, checkpoint.AttemptsLog[1].LastPageContentRatio, 0.01)
+		}
+		assert.Equal(t, 2, bestAttemptIndex(checkpoint.Scores))
+	}
+	best, err := os.ReadFile(filepath.Join(testJob.OutputDir, "attempt2.json"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(best), "made thing 3")
+		assert.NotContains(t, string(best), "made thing 4")
+	}
+}
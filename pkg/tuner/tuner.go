@@ -1,58 +1,29 @@
 package tuner
 
 import (
-	"bytes"
 	"cloud.google.com/go/storage"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/xeipuuv/gojsonschema"
 	"io"
 
 	"github.com/rs/zerolog/log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"pdfinspector/pkg/cassette"
 	"pdfinspector/pkg/config"
 	"pdfinspector/pkg/filesystem"
 	"pdfinspector/pkg/job"
-	"strings"
+	"pdfinspector/pkg/llm"
+	"pdfinspector/pkg/prompts"
+	"pdfinspector/pkg/render"
+	"time"
 )
 
 const TUNER_DEFAULT_OUTPUT_FILENAME = "Output.pdf"
-
-// Custom error type that holds a list of validation errors
-type SchemaValidationError struct {
-	ValidationErrors []gojsonschema.ResultError
-}
-
-// Implement the error interface by defining the Error() method
-func (ve SchemaValidationError) Error() string {
-	if len(ve.ValidationErrors) == 0 {
-		return "no validation errors"
-	}
-
-	// Format all validation errors into a single string
-	var errMsg string
-	for _, err := range ve.ValidationErrors {
-		errMsg += fmt.Sprintf("- %s\n", err.String())
-	}
-	return fmt.Sprintf("validation failed with the following errors:\n%s", errMsg)
-}
-
-// Optional: Implement the Is() method to allow errors.Is to check this type
-func (ve SchemaValidationError) Is(target error) bool {
-	_, ok := target.(*SchemaValidationError)
-	return ok
-}
-
-// Constructor function for creating a new SchemaValidationError
-func NewSchemaValidationError(errors []gojsonschema.ResultError) error {
-	return &SchemaValidationError{
-		ValidationErrors: errors,
-	}
-}
+const USAGE_FILENAME = "usage.json"
 
 type jdMeta struct {
 	CompanyName string   `json:"company_name" validate:"required"`
@@ -64,18 +35,15 @@ type jdMeta struct {
 	Process     *string  `json:"process" validate:"required"`
 }
 
-// APIResponse Struct to represent (parts of) the OpenAI API response (that we care about r/n)
-type APIResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
 type Tuner struct {
-	config *config.ServiceConfig
-	Fs     filesystem.FileSystem
+	config   *config.ServiceConfig
+	Fs       filesystem.FileSystem
+	LLM      llm.LLMClient
+	Renderer render.Renderer
+	Cassette *cassette.Cassette //nil unless we are recording or replaying outbound calls
+	Prompts  *prompts.Library
+
+	rasterize func(ctx context.Context, attempt int, outputDir string) error //nil for ghostscript, see rasterizeAttempt
 }
 
 func NewTuner(config *config.ServiceConfig) *Tuner {
@@ -83,80 +51,81 @@ func NewTuner(config *config.ServiceConfig) *Tuner {
 		config: config,
 	}
 	t.configureFilesystem()
+	t.configureCassette()
+	t.configureLLMClient()
+	t.configureRenderer()
+	t.configurePrompts()
 	return t
 }
 
 var defaultAcceptableRatio = 0.88
 
-// var defaultMaxAttempts = 1 //this should probably come from env
-var defaultMaxAttempts = 7 //this should probably come from env
 const RESUME_FILENAME = "Resume.pdf"
 const COVERLETTER_FILENAME = "Cover Letter.pdf"
 
 type LayoutCustomization struct {
 	//min and max length for page
-	//prompts
 	AcceptableRatio float64
-	DefaultPrompt   string
-	ComposePrompt   func(job *job.Job, keywords []string) string
 	CanSupplement   bool //true if this type of layout might need to have prompt supplemented with some sort of data from gcs
 	OutputFilename  string
+
+	//prompts, names of templates in the prompt set - see the prompts dir
+	MainPromptTemplate    string //the instructions, unless the job has a custom prompt
+	ComposePromptTemplate string //puts the main prompt, jd, keywords and baseline together
+	ExtractPromptTemplate string //empty if we can't extract resume data into this layout
+
+	LengthController LengthController //how to steer attempts toward the right length, nil for the default
+	PruneSteps       []PruneStep      //in order of preference, for fitting a slightly overflowing attempt without the LLM. none means no pruning.
+	AttemptScorer    AttemptScorer    //how to pick the best attempt and candidate, nil for the default
+
+	//model settings, leave empty/nil/0 to use the server defaults from config.
+	Model        string
+	Temperature  *float64
+	MaxTokens    int
+	ExtractModel string //extraction of a long resume can need a bigger model than the tuning does
 }
 
 var layoutDefaults = map[string]LayoutCustomization{
 	"chrono": {
-		AcceptableRatio: defaultAcceptableRatio,
-		DefaultPrompt: strings.Join([]string{
-			"The task is to examine a Job Description and a resume data structure with the goal of adjusting the data structure such that the final rendered resume presents the perfect candidate for the job while still keeping the final render to exactly one page. ",
-			//"Your output JSON can simply omit anything which need not be seen in the rendered resume document (If all of the projects within a job are marked as hidden then the whole job will be hidden). ",
-			//"The work_history contains a list of companies and projects within those companies. ",
-			"Some of the information in the candidate resume JSON data structure is currently set to be hidden in the output, but this information is available to inspire any changes which may make the candidate appear more suitable for the Job Description below. ",
-			"Your output JSON can simply omit anything which need not be seen in the rendered resume document. ",
-			"Feel free to adjust any descriptive text fields at the company or project level with inspiration from the target Job Description to make the candidate seem more relevant in all possible ways that do not involve overt fabrications or lies. ",
-			"Embellishment of anything remotely factual or possibly tangential is encouraged. ",
-			"Information from older company projects can be applied to current jobs descriptions. If older, currently hidden work history can be made particularly relevant, feel free to include it. ",
-			"The goal is to keep the length of the final render at one page, while showing the most relevant information to make the candidate appear a perfect fit for the target job. ",
-			"Be sure to include between 3 and 5 distinct company sections. Each company section can list separate projects within it, aim for 2-3 projects within each company. ",
-			"Make sure that all descriptive text is highly relevant to the job description in some way but still reflects the original character of the item being changed. ",
-			"The target Job Description for which this candidate should appear to perfectly match is below. ",
-			"Pay special attention to any special tokens that the job wants included in applications, or weird instructions. Be prepared to follow them to the best of your ability:",
-		}, ""),
-		ComposePrompt:  resumeComposePrompt,
-		OutputFilename: RESUME_FILENAME,
+		AcceptableRatio:       defaultAcceptableRatio,
+		MainPromptTemplate:    "chrono_main",
+		ComposePromptTemplate: "resume_compose",
+		ExtractPromptTemplate: "chrono_extract",
+		LengthController:      &BisectionController{},
+		PruneSteps:            []PruneStep{pruneOldestProject, pruneSkillsOverflow},
+		OutputFilename:        RESUME_FILENAME,
 	},
 	"functional": {
-		AcceptableRatio: defaultAcceptableRatio,
-		DefaultPrompt: strings.Join([]string{
-			//"This guy needs a job ASAP. You need to make his resume look PERFECT for the job. Fake it until you make it right? Fix it up, do what it takes. Aim for 3-5 Functional Areas, each with 2-4 examples of key contributions. Make them relate to the Job Description as best as possible, including possibly switching up industries and industry terms. ",
-			//"Feel free to dig into those hidden companies and projects for inspiration, include whatever you think could be relevant. ",
-			//"The target Job Description for which this candidate should appear to perfectly match is below. Pay special attention to any magic tokens that the job wants included in applications, or weird instructions. Be prepared to follow them to the best of your ability (magic tokens should be placed somewhere that will get rendered such as a project description or a job title):\n",
-
-			"The task is to examine a Job Description and a resume data structure with the goal of adjusting the data structure such that the final rendered resume presents the perfect candidate for the job while still keeping the final render to exactly one page. ",
-			"Some of the information in the candidate resume JSON data structure is currently set to be hidden in the output, but this information is available to inspire any changes which may make the candidate appear more suitable for the Job Description below. ",
-			"Your output JSON can simply omit anything which need not be seen in the rendered resume document. ",
-			"Feel free to adjust any descriptive text fields at the functional area or key contribution level with inspiration from the target Job Description to make the candidate seem more relevant in all possible ways that do not involve overt fabrications or lies. ",
-			"Embellishment of anything remotely factual or possibly tangential is encouraged. ",
-			"Information from older company projects can be applied to current jobs descriptions. If older, currently hidden work history can be made particularly relevant, feel free to include it. ",
-			"The goal is to keep the length of the final render at one page, while showing the most relevant information to make the candidate appear a perfect fit for the target job. ",
-			"Be sure to include between 3 and 5 distinct functional areas. Each functional area can list separate key contributions within it, aim for 2-3 examples within each. ",
-			"Ensure that all descriptive text is highly relevant to the job description in some way but still reflects the original character of the item being changed, ",
-			"The target Job Description for which this candidate should appear to perfectly match is below. ",
-			"Pay special attention to any special tokens that the job wants included in applications, or weird instructions. Be prepared to follow them to the best of your ability:",
-		}, ""),
-		ComposePrompt:  resumeComposePrompt,
-		OutputFilename: RESUME_FILENAME,
+		AcceptableRatio:       defaultAcceptableRatio,
+		MainPromptTemplate:    "functional_main",
+		ComposePromptTemplate: "resume_compose",
+		ExtractPromptTemplate: "functional_extract",
+		LengthController:      &BisectionController{},
+		PruneSteps:            []PruneStep{pruneSmallestAreaContribution, pruneTechOverflow},
+		OutputFilename:        RESUME_FILENAME,
 	},
 	"coverletter": {
-		AcceptableRatio: 0.55,
-		DefaultPrompt: strings.Join([]string{
-			"Write a cover letter for the candidate which matches the Job Description below.",
-		}, ""),
-		ComposePrompt:  coverletterComposePrompt,
-		CanSupplement:  true,
-		OutputFilename: COVERLETTER_FILENAME,
+		AcceptableRatio:       0.55,
+		MainPromptTemplate:    "coverletter_main",
+		ComposePromptTemplate: "coverletter_compose",
+		LengthController:      &ProportionalController{Gain: 0.5},
+		CanSupplement:         true,
+		OutputFilename:        COVERLETTER_FILENAME,
+		//a cover letter just has to fit, being a bit short of the aim is fine
+		AttemptScorer: &WeightedScorer{
+			PageFitWeight:         1,
+			FillWeight:            0.5,
+			KeywordCoverageWeight: KEYWORD_COVERAGE_WEIGHT,
+			SchemaValidWeight:     1,
+			FabricationWeight:     0.05,
+		},
 	},
 }
 
+// ErrInvalidJob is a PopulateJob failure down to the job as it was sent (an unknown layout or prompt set, too many
+// candidates), rather than to us or the services we use.
+var ErrInvalidJob = errors.New("invalid job")
+
 func (t *Tuner) PopulateJob(job *job.Job, updates chan job.JobStatus) error {
 	job.OutputDir = fmt.Sprintf("%s/%s", t.config.LocalPath, job.Id)
 
@@ -172,15 +141,41 @@ func (t *Tuner) PopulateJob(job *job.Job, updates chan job.JobStatus) error {
 	acceptableRatio, err := t.GetAcceptableRatio(job.Layout)
 	if err != nil {
 		job.Log().Error().Msgf("error from reading input prompt: %s", err.Error())
-		return err
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
 	}
 	job.AcceptableRatio = acceptableRatio
-	job.MaxAttempts = defaultMaxAttempts
+	job.Budget.Fill(t.DefaultBudget())
+	if job.Candidates < 1 {
+		job.Candidates = 1
+	}
+	if job.Candidates > MAX_ADMIN_CANDIDATES {
+		return fmt.Errorf("%w: candidates must be between 1 and %d", ErrInvalidJob, MAX_ADMIN_CANDIDATES)
+	}
+	if job.Candidates > 1 && t.Cassette != nil && t.Cassette.Mode != cassette.ModeOff && t.Cassette.Match == cassette.MatchSequence {
+		//candidates ask at the same time, so the order of the calls isn't the same from one run to the next
+		return fmt.Errorf("%w: candidates can't be used with cassette sequence matching, only with request matching", ErrInvalidJob)
+	}
+
+	err = t.PopulateJobModelSettings(job)
+	if err != nil {
+		return err
+	}
+
+	pinnedPromptSet := job.PromptSet != ""
+	promptSet, err := t.PopulateJobPromptSet(job)
+	if err != nil && pinnedPromptSet {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	if err != nil {
+		//an experiment or the server default pointing at a set that isn't there is on us
+		return err
+	}
+	SendJobUpdate(updates, fmt.Sprintf("using prompts %s", job.PromptVersion))
 
 	//var err error
 	mainPrompt := job.CustomPrompt
 	if mainPrompt == "" {
-		mainPrompt, err = t.GetDefaultPrompt(job.Layout)
+		mainPrompt, err = t.getMainPrompt(promptSet, job.Layout, job.TargetPages)
 		if err != nil {
 			job.Log().Error().Msgf("error from reading input prompt: %s", err.Error())
 			return err
@@ -196,11 +191,57 @@ func (t *Tuner) PopulateJob(job *job.Job, updates chan job.JobStatus) error {
 	return nil
 }
 
+// PopulateJobModelSettings fills in whatever model settings the job didn't specify, layout defaults first then server config.
+// An unknown layout is still returned as an error, but the job gets the server config settings regardless.
+func (t *Tuner) PopulateJobModelSettings(job *job.Job) error {
+	defaults, err := t.GetLayoutDefaults(job.Layout)
+	if err != nil {
+		defaults = &LayoutCustomization{}
+	}
+	if job.Model == "" {
+		job.Model = defaults.Model
+	}
+	if job.Model == "" {
+		job.Model = t.config.LLMModel
+	}
+	if job.Temperature == nil {
+		job.Temperature = defaults.Temperature
+	}
+	if job.Temperature == nil {
+		temperature := t.config.LLMTemperature
+		job.Temperature = &temperature
+	}
+	if job.MaxTokens == 0 {
+		job.MaxTokens = defaults.MaxTokens
+	}
+	if job.MaxTokens == 0 {
+		job.MaxTokens = t.config.LLMMaxTokens
+	}
+	job.Log().Info().Msgf("job model settings: model %s, temperature %.2f, max tokens %d", job.Model, *job.Temperature, job.MaxTokens)
+	return err
+}
+
+// jobTemperature is the jobs temperature, or the server default for a job that never had its model settings filled in.
+func (t *Tuner) jobTemperature(j *job.Job) float64 {
+	if j.Temperature == nil {
+		return t.config.LLMTemperature
+	}
+	return *j.Temperature
+}
+
+// jobMaxTokens is the jobs max tokens per call, or the server default for a job that never had its model settings filled in.
+func (t *Tuner) jobMaxTokens(j *job.Job) int {
+	if j.MaxTokens == 0 {
+		return t.config.LLMMaxTokens
+	}
+	return j.MaxTokens
+}
+
 func (t *Tuner) GetBaselineJSON(baseline string) (string, error) {
 	// get JSON of the current complete resume including all the hidden stuff, this hits an express server that imports the reactresume resumedata.mjs and outputs it as json.
 	jsonRequestURL := fmt.Sprintf("%s?baseline=%s", t.config.JsonServerURL, baseline)
 
-	client, err := createAuthenticatedClient(context.Background(), t.config.ReactAppURL) //we use the reactapp url because we have to implement the security in the application due to the way the react app will load the json -- having to first send an OPTIONS request which needs to just be allowed through since it will never have a bearer token. And then the bearer token we do send for the gotenberg request to the react app will always be the one forwarded in the json fetch request, we cannot override it with the correct one even! so here, we just be consistent.
+	client, err := render.NewAuthenticatedClient(context.Background(), t.config.ReactAppURL) //we use the reactapp url because we have to implement the security in the application due to the way the react app will load the json -- having to first send an OPTIONS request which needs to just be allowed through since it will never have a bearer token. And then the bearer token we do send for the gotenberg request to the react app will always be the one forwarded in the json fetch request, we cannot override it with the correct one even! so here, we just be consistent.
 	if err != nil {
 		return "", fmt.Errorf("failed to create authenticated client: %v", err)
 	}
@@ -249,8 +290,8 @@ func (t *Tuner) GetStyleFromBaselineJSON(baselineJSON string) (string, string, e
 	return layout, style, nil
 }
 
-func (t *Tuner) takeNotesOnJD(job *job.Job) (string, error) {
-	jDResponseSchemaRaw, err := os.ReadFile(filepath.Join("response_templates", "jdinfo-schema.json"))
+func (t *Tuner) takeNotesOnJD(ctx context.Context, job *job.Job, updates chan job.JobStatus) (string, error) {
+	jDResponseSchemaRaw, err := os.ReadFile(filepath.Join(t.config.SchemasPath, "jdinfo-schema.json"))
 	if err != nil {
 		return "", fmt.Errorf("failed to read expect_response.json: %v", err)
 	}
@@ -259,36 +300,36 @@ func (t *Tuner) takeNotesOnJD(job *job.Job) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to decode JSON: %v", err)
 	}
-	prompt := strings.Join([]string{
-		"Extract information from the following Job Description. Take note of the name of the company, the job title, and most importantly the list of key words that a candidate will have in their CV in order to get through initial screening. Additionally, extract any location, remote-ok status, salary info and hiring process notes which can be succinctly captured.",
-		"\n--- start job description ---\n",
-		job.JobDescription,
-		"\n--- end job description ---\n",
-	}, "")
+	systemPrompt, err := t.renderPrompt(job, PROMPT_JD_NOTES_SYSTEM, prompts.Data{})
+	if err != nil {
+		return "", err
+	}
+	prompt, err := t.renderPrompt(job, PROMPT_JD_NOTES, prompts.Data{JobDescription: job.JobDescription})
+	if err != nil {
+		return "", err
+	}
 
-	apirequest := map[string]interface{}{
-		"model": "gpt-4o-mini",
-		"messages": []map[string]interface{}{
+	apirequest := &llm.ChatRequest{
+		Model: t.getJDNotesModel(),
+		Messages: []llm.ChatMessage{
 			{
-				"role":    "system",
-				"content": "You are a Job Description info extractor assistant.",
+				Role:    "system",
+				Content: systemPrompt,
 			},
 			//before switching to structured output we had to prompt it here with a message telling it to respond in json and then providing a fake response from the assistant in the expected json format. now we just send a json schema in a different part of the request :D
 			{
-				"role":    "user",
-				"content": prompt,
+				Role:    "user",
+				Content: prompt,
 			},
 		},
-		"response_format": map[string]interface{}{
-			"type": "json_schema",
-			"json_schema": map[string]interface{}{
-				"name":   "job_description",
-				"strict": true,
-				"schema": jDResponseSchema,
-			},
+		ResponseSchema: &llm.ResponseSchema{
+			Name:   "job_description",
+			Strict: true,
+			Schema: jDResponseSchema,
 		},
-		"temperature": 0.7,
-		"user":        job.UserID,
+		Temperature: t.jobTemperature(job),
+		MaxTokens:   t.jobMaxTokens(job),
+		User:        job.UserID,
 	}
 	api_request_pretty, err := serializeToJSON(apirequest)
 	writeToFile(api_request_pretty, 0, "jd_info_request_pretty", job.OutputDir)
@@ -296,31 +337,17 @@ func (t *Tuner) takeNotesOnJD(job *job.Job) (string, error) {
 		return "", fmt.Errorf("Failed to marshal final JSON: %v", err)
 	}
 
-	exists, output, err := checkForPreexistingAPIOutput(job.OutputDir, "jd_info_response_raw", 0)
+	output, err := t.makeAPIRequest(ctx, apirequest, 0, "jd_info_response_raw", job.OutputDir, job.Usage, "jd_notes", updates)
 	if err != nil {
-		return "", fmt.Errorf("Error checking for pre-existing API output: %v", err)
-	}
-	if !exists {
-		output, err = t.makeAPIRequest(apirequest, 0, "jd_info_response_raw", job.OutputDir)
-		if err != nil {
-			return "", fmt.Errorf("Error making API request: %v", err)
-		}
+		return "", fmt.Errorf("Error making API request: %w", err)
 	}
 
 	//openai api should have responded to our request with a json text that can be used as resumedata input. extract it.
-	var apiResponse APIResponse
-	err = json.Unmarshal([]byte(output), &apiResponse)
+	content, err := extractCompletionContent(output, "jd_notes")
 	if err != nil {
-		return "", fmt.Errorf("Error deserializing API response: %v\n", err)
-	}
-
-	//Extract the message content
-	if len(apiResponse.Choices) == 0 {
-		return "", fmt.Errorf("No choices found in the API response")
+		return "", err
 	}
 
-	content := apiResponse.Choices[0].Message.Content
-
 	err = validateJSON(content)
 	if err != nil {
 		return "", fmt.Errorf("Error validating JSON content: %v\n", err)
@@ -336,6 +363,24 @@ func (t *Tuner) takeNotesOnJD(job *job.Job) (string, error) {
 	return content, nil
 }
 
+func (t *Tuner) getJDNotesModel() string {
+	if t.config.JDNotesModel != "" {
+		return t.config.JDNotesModel
+	}
+	return t.config.LLMModel
+}
+
+func (t *Tuner) getExtractModel(layout string) string {
+	defaults, err := t.GetLayoutDefaults(layout)
+	if err == nil && defaults.ExtractModel != "" {
+		return defaults.ExtractModel
+	}
+	if t.config.ExtractModel != "" {
+		return t.config.ExtractModel
+	}
+	return t.config.LLMModel
+}
+
 // configureFilesystem sets up the filesystem based on the command line flags.
 func (t *Tuner) configureFilesystem() filesystem.FileSystem {
 	if t.config.FsType == "local" {
@@ -356,6 +401,66 @@ func (t *Tuner) configureFilesystem() filesystem.FileSystem {
 	return nil
 }
 
+// configureCassette sets up recording/replaying of outbound LLM and Gotenberg calls, if configured.
+func (t *Tuner) configureCassette() *cassette.Cassette {
+	if t.config.CassetteMode == "" || t.config.CassetteMode == string(cassette.ModeOff) {
+		return nil
+	}
+	c, err := cassette.New(t.config.CassetteDir, cassette.Mode(t.config.CassetteMode), cassette.Match(t.config.CassetteMatch))
+	if err != nil {
+		log.Fatal().Msgf("Failed to set up cassette: %v", err)
+	}
+	log.Info().Msgf("cassette mode %s, match by %s, using dir: %s", c.Mode, c.Match, c.Dir)
+	t.Cassette = c
+	return c
+}
+
+// configureLLMClient sets up the chat completion provider based on the service config.
+func (t *Tuner) configureLLMClient() llm.LLMClient {
+	var client llm.LLMClient
+	switch t.config.LLMProvider {
+	case "", "openai":
+		client = llm.NewOpenAIClient(t.config.OpenAiApiKey)
+	case "openai-compatible":
+		client = llm.NewOpenAICompatibleClient(t.config.LLMBaseURL, t.config.OpenAiApiKey)
+	case "anthropic":
+		client = llm.NewAnthropicClient(t.config.AnthropicApiKey)
+	case "fake":
+		client = llm.NewFakeClient()
+	default:
+		log.Fatal().Msgf("Unknown LLM provider: %s", t.config.LLMProvider)
+	}
+	t.LLM = llm.NewRetryingClient(client, t.config.LLMMaxRetries, time.Duration(t.config.LLMCallTimeout)*time.Second)
+	if t.Cassette != nil {
+		t.LLM = llm.NewCassetteClient(t.LLM, t.Cassette)
+	}
+	log.Info().Msgf("using LLM provider: %s (max retries %d, call timeout %ds)", t.LLM.Name(), t.config.LLMMaxRetries, t.config.LLMCallTimeout)
+	return nil
+}
+
+// configureRenderer sets up the renderer based on the service config.
+func (t *Tuner) configureRenderer() render.Renderer {
+	var renderer render.Renderer
+	switch t.config.Renderer {
+	case "", "html":
+		renderer = render.NewGotenbergHTMLRenderer(t.config.GotenbergURL)
+	case "url":
+		renderer = render.NewGotenbergURLRenderer(t.config.GotenbergURL, t.config.ReactAppURL, t.config.JsonServerURL, t.Fs, t.config.FsType)
+	case "chromium":
+		renderer = render.NewChromiumRenderer(t.config.ChromiumPath)
+	case "stub":
+		renderer = render.NewStubRenderer()
+	default:
+		log.Fatal().Msgf("Unknown renderer: %s", t.config.Renderer)
+	}
+	t.Renderer = render.NewRetryingRenderer(renderer, t.config.RenderMaxRetries)
+	if t.Cassette != nil {
+		t.Renderer = render.NewCassetteRenderer(t.Renderer, t.Cassette)
+	}
+	log.Info().Msgf("using renderer: %s (max retries %d)", t.Renderer.Name(), t.config.RenderMaxRetries)
+	return t.Renderer
+}
+
 func (t *Tuner) GetExpectedResponseJsonSchema(layout string) (interface{}, error) {
 	completeSchema, err := t.readAndDecodeJsonSchema(layout)
 	if err != nil {
@@ -416,6 +521,17 @@ func (t *Tuner) GetLayoutDefaults(layout string) (*LayoutCustomization, error) {
 	return &defaults, nil
 }
 
+func (t *Tuner) GetLengthController(layout string) (LengthController, error) {
+	defaults, err := t.GetLayoutDefaults(layout)
+	if err != nil {
+		return nil, err
+	}
+	if defaults.LengthController == nil {
+		return defaultLengthController, nil
+	}
+	return defaults.LengthController, nil
+}
+
 func (t *Tuner) GetAcceptableRatio(layout string) (float64, error) {
 	defaults, err := t.GetLayoutDefaults(layout)
 	if err != nil {
@@ -425,13 +541,13 @@ func (t *Tuner) GetAcceptableRatio(layout string) (float64, error) {
 	return defaults.AcceptableRatio, nil
 }
 
+// GetDefaultPrompt is the main prompt for the layout from the server default prompt set.
 func (t *Tuner) GetDefaultPrompt(layout string) (string, error) {
-	defaults, err := t.GetLayoutDefaults(layout)
+	set, err := t.Prompts.Set(t.config.PromptSet)
 	if err != nil {
 		return "", err
 	}
-
-	return defaults.DefaultPrompt, nil
+	return t.getMainPrompt(set, layout, 1)
 }
 
 func (t *Tuner) GetJobSupplement(job *job.Job) []byte {
@@ -474,7 +590,14 @@ func (t *Tuner) GetCompletePromptForLayout(job *job.Job, keywords []string) (str
 		return "", err
 	}
 
-	return defaults.ComposePrompt(job, keywords), nil
+	return t.renderPrompt(job, defaults.ComposePromptTemplate, prompts.Data{
+		Layout:         job.Layout,
+		JobDescription: job.JobDescription,
+		MainPrompt:     job.MainPrompt,
+		Keywords:       keywords,
+		BaselineJSON:   job.BaselineJSON,
+		Supplement:     supplementResumeData(job),
+	})
 }
 
 func (t *Tuner) GetOuputFileName(layout string) string {
@@ -486,37 +609,38 @@ func (t *Tuner) GetOuputFileName(layout string) string {
 	return defaults.OutputFilename
 }
 
-func (t *Tuner) makeAPIRequest(apiBody interface{}, counter int, name, outputDir string) (string, error) {
+func (t *Tuner) makeAPIRequest(ctx context.Context, request *llm.ChatRequest, counter int, name, outputDir string, usage *job.UsageSummary, phase string, updates chan job.JobStatus) (string, error) {
 	//panic("slow down there son, you really want to hit the paid api at this time?")
-	log.Info().Msgf("Make request to OpenAI ...")
-	// Serialize the interface to pretty-printed JSON
-	jsonData, err := json.Marshal(apiBody)
+	log.Info().Msgf("Make request to LLM provider %s ...", t.LLM.Name())
+	ctx = llm.WithRetryNotifier(ctx, func(retry int, maxRetries int, wait time.Duration, err error) {
+		SendJobUpdate(updates, fmt.Sprintf("%s, retrying in %.0fs (retry %d of %d)", describeLLMError(err), wait.Seconds(), retry, maxRetries))
+	})
+	var forwarder *streamForwarder
+	if t.config.LLMStream && updates != nil {
+		forwarder = newStreamForwarder(phase, updates)
+		ctx = llm.WithStreamHandler(ctx, forwarder.handle)
+	}
+	response, err := t.LLM.ChatCompletion(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize API request body to JSON: %v", err)
-	}
-
-	// Create a new HTTP POST request
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer([]byte(jsonData)))
+		return "", fmt.Errorf("%s: %w", describeLLMError(err), err)
+	}
+	if forwarder != nil {
+		//the tail end of the content, so that anyone stitching the deltas together gets all of it
+		forwarder.flush()
+	}
+	usage.Record(phase, job.TokenUsage{
+		Calls:            1,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+		EstimatedCostUSD: llm.EstimateCostUSD(request.Model, response.Usage.PromptTokens, response.Usage.CompletionTokens),
+	})
+	log.Info().Msgf("LLM call for %s used %d prompt + %d completion tokens", phase, response.Usage.PromptTokens, response.Usage.CompletionTokens)
+
+	// Serialize the (provider agnostic) response so it can be written out and replayed later
+	respBody, err := json.Marshal(response)
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %v", err)
-	}
-
-	// Set the Content-Type and Authorization headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.config.OpenAiApiKey))
-
-	// Send the request using the default HTTP client
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send HTTP request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
+		return "", fmt.Errorf("failed to serialize API response to JSON: %v", err)
 	}
 
 	// Convert the response body to a string
@@ -527,8 +651,27 @@ func (t *Tuner) makeAPIRequest(apiBody interface{}, counter int, name, outputDir
 	if err != nil {
 		return "", fmt.Errorf("failed to write response to file: %v", err)
 	}
-	log.Info().Msgf("Got response from OpenAI API ... (and should have wrote it to the file system)")
+	log.Info().Msgf("Got response from LLM API ... (and should have wrote it to the file system)")
 
 	// Return the response string
 	return responseString, nil
 }
+
+// describeLLMError turns the typed llm errors into something we can show to the user in a JobStatus.
+func describeLLMError(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrRateLimited):
+		return "LLM provider is rate limiting us"
+	case errors.Is(err, llm.ErrQuotaExceeded):
+		return "LLM provider quota exceeded"
+	case errors.Is(err, llm.ErrContextLength):
+		return "request was too long for the model context"
+	case errors.Is(err, llm.ErrServer):
+		return "LLM provider had a server error"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "LLM request timed out"
+	case errors.Is(err, context.Canceled):
+		return "LLM request was cancelled"
+	}
+	return "LLM request failed"
+}
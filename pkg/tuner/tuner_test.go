@@ -0,0 +1,140 @@
+package tuner
+
+import (
+	"github.com/stretchr/testify/assert"
+	"pdfinspector/pkg/cassette"
+	"pdfinspector/pkg/config"
+	"pdfinspector/pkg/job"
+	"testing"
+)
+
+func TestPopulateJobModelSettingsPrefersJobThenLayoutThenConfig(t *testing.T) {
+	tuner := &Tuner{
+		config: &config.ServiceConfig{
+			LLMModel:       "server-model",
+			LLMTemperature: 0.5,
+			LLMMaxTokens:   1000,
+		},
+	}
+
+	defaultedJob := job.NewDefaultJob()
+	defaultedJob.Layout = "chrono"
+	err := tuner.PopulateJobModelSettings(defaultedJob)
+	assert.NoError(t, err)
+	assert.Equal(t, "server-model", defaultedJob.Model)
+	assert.Equal(t, 0.5, *defaultedJob.Temperature)
+	assert.Equal(t, 1000, defaultedJob.MaxTokens)
+
+	overrideTemperature := 0.1
+	overriddenJob := job.NewDefaultJob()
+	overriddenJob.Layout = "chrono"
+	overriddenJob.Model = "job-model"
+	overriddenJob.Temperature = &overrideTemperature
+	err = tuner.PopulateJobModelSettings(overriddenJob)
+	assert.NoError(t, err)
+	assert.Equal(t, "job-model", overriddenJob.Model)
+	assert.Equal(t, 0.1, *overriddenJob.Temperature)
+	assert.Equal(t, 1000, overriddenJob.MaxTokens)
+}
+
+func TestPopulateJobModelSettingsUnknownLayoutStillFillsConfig(t *testing.T) {
+	tuner := &Tuner{config: &config.ServiceConfig{LLMModel: "server-model", LLMTemperature: 0.5, LLMMaxTokens: 1000}}
+
+	unknownJob := job.NewDefaultJob()
+	unknownJob.Layout = "nope"
+	err := tuner.PopulateJobModelSettings(unknownJob)
+	assert.Error(t, err)
+	assert.Equal(t, "server-model", unknownJob.Model)
+	assert.Equal(t, 0.5, *unknownJob.Temperature)
+	assert.Equal(t, 1000, unknownJob.MaxTokens)
+
+	//a job that never went through PopulateJobModelSettings gets the config, not a panic
+	unpopulatedJob := job.NewDefaultJob()
+	assert.Equal(t, 0.5, tuner.jobTemperature(unpopulatedJob))
+	assert.Equal(t, 1000, tuner.jobMaxTokens(unpopulatedJob))
+}
+
+func TestExtractModelSettingsPreferJobThenConfig(t *testing.T) {
+	tuner := &Tuner{config: &config.ServiceConfig{LLMTemperature: 0.5, LLMMaxTokens: 1000}}
+
+	extraction := &ResumeExtractionJob{Layout: "chrono"}
+	assert.Equal(t, 0.5, tuner.extractTemperature(extraction))
+	assert.Equal(t, 1000, tuner.extractMaxTokens(extraction))
+
+	temperature := 0.1
+	extraction.Temperature = &temperature
+	extraction.MaxTokens = 4000
+	assert.Equal(t, 0.1, tuner.extractTemperature(extraction))
+	assert.Equal(t, 4000, tuner.extractMaxTokens(extraction))
+}
+
+func TestPopulateJobCapsCandidates(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.Candidates = MAX_ADMIN_CANDIDATES + 1
+	err := tuner.PopulateJob(testJob, nil)
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	assert.ErrorContains(t, err, "candidates")
+	assert.Less(t, candidateSlot(0, MAX_ADMIN_CANDIDATES), pruneSlot(0, 0), "the last candidate slot is clear of the pruned renders")
+}
+
+func TestPopulateJobTellsInvalidJobsApartFromOurFailures(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "nope"
+	assert.ErrorIs(t, tuner.PopulateJob(testJob, nil), ErrInvalidJob, "unknown layout")
+
+	testJob = job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.PromptSet = "nope"
+	assert.ErrorIs(t, tuner.PopulateJob(testJob, nil), ErrInvalidJob, "unknown prompt set asked for")
+
+	tuner.config.PromptSet = "missing"
+	testJob = job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	err := tuner.PopulateJob(testJob, nil)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidJob, "the server default set being missing is on us")
+}
+
+func TestPopulateJobRejectsCandidatesWithSequenceMatching(t *testing.T) {
+	tuner := promptsTestTuner(t)
+	var err error
+	tuner.Cassette, err = cassette.New(t.TempDir(), cassette.ModeReplay, cassette.MatchSequence)
+	assert.NoError(t, err)
+	testJob := job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.Candidates = 2
+	err = tuner.PopulateJob(testJob, nil)
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	assert.ErrorContains(t, err, "sequence")
+
+	tuner.Cassette.Match = cassette.MatchRequest
+	testJob = job.NewDefaultJob()
+	testJob.Layout = "chrono"
+	testJob.Candidates = 2
+	if err := tuner.PopulateJob(testJob, nil); err != nil {
+		assert.NotContains(t, err.Error(), "sequence", "request matching is fine with candidates")
+	}
+}
+
+func TestStreamForwarderBatchesDeltas(t *testing.T) {
+	updates := make(chan job.JobStatus, 10)
+	forwarder := newStreamForwarder("attempt_1", updates)
+	forwarder.handle(`{"a"`, 1) //first one goes straight out
+	forwarder.handle(`:1`, 2)   //within the interval, held back
+	forwarder.handle(`}`, 3)
+	forwarder.flush()
+	close(updates)
+
+	var statuses []job.JobStatus
+	for status := range updates {
+		statuses = append(statuses, status)
+	}
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, `{"a"`, statuses[0].Stream.Delta)
+	assert.Equal(t, `:1}`, statuses[1].Stream.Delta)
+	assert.Equal(t, 3, statuses[1].Stream.Tokens)
+	assert.Equal(t, "attempt_1", statuses[1].Stream.Phase)
+}
@@ -7,8 +7,6 @@ import (
 	"github.com/rs/zerolog/log"
 	"os"
 	"path/filepath"
-	"pdfinspector/pkg/config"
-	"pdfinspector/pkg/filesystem"
 	"pdfinspector/pkg/job"
 	"regexp"
 	"strings"
@@ -82,62 +80,15 @@ func serializeToJSON(v interface{}) (string, error) {
 	return string(jsonData), nil
 }
 
-func checkForPreexistingAPIOutput(directory, filenameFragment string, counter int) (bool, string, error) {
-	// Construct the filename
-	filename := fmt.Sprintf("%s_%d.txt", filenameFragment, counter)
-	filepath := filepath.Join(directory, filename)
-
-	// Check if the file exists
-	if _, err := os.Stat(filepath); err == nil {
-		// File exists, read its contents
-		data, err := os.ReadFile(filepath)
-		if err != nil {
-			return true, "", fmt.Errorf("failed to read existing API output: %v", err)
-		}
-		log.Info().Msgf("Read prior response for api request attempt number %d from file system.", counter)
-		return true, string(data), nil
-	} else if os.IsNotExist(err) {
-		// File does not exist
-		log.Info().Msgf("No prior response found for api request attempt number %d in file system.", counter)
-		return false, "", nil
-	} else {
-		// Some other error occurred
-		log.Error().Msg("Error while checking file system for prior api response info.")
-		return false, "", fmt.Errorf("error checking file existence: %v", err)
-	}
-}
-
-func WriteAttemptResumedataJSON(content string, job *job.Job, attemptNum int, fs filesystem.FileSystem, config *config.ServiceConfig) error {
-	// Step 5: Write the validated content to the filesystem in a way the resume projects json server can read it, plus locally for posterity.
-	// Assuming the file path is up and outside of the project directory
-	// Example: /home/user/output/validated_content.json
+// WriteAttemptResumedataJSON writes out the resumedata for an attempt as attemptN.json, the way the renderer wants it
+// (with the layout and style in), which is where it gets rendered from.
+func WriteAttemptResumedataJSON(content string, job *job.Job, attemptNum int) error {
 	updatedContent, err := insertLayout(content, job.Layout, job.StyleOverride)
 	if err != nil {
 		job.Log().Error().Msgf("Error inserting layout info: %v", err)
 		return err
 	}
 
-	//TODO !!!!!!!! dont do this!!!!!! not like this!!!!
-	if config.FsType == "local" {
-		// this is/was just a cheesy way to get the attempted resume updated json available to the react project via a local json server service.
-		outputFilePath := filepath.Join("../ResumeData/resumedata/", fmt.Sprintf("attempt%d.json", attemptNum))
-		err = WriteValidatedContent(updatedContent, outputFilePath)
-		if err != nil {
-			job.Log().Error().Msgf("Error writing content to file: %v", err)
-			return err
-		}
-		job.Log().Info().Msgf("Content successfully written to: %s", outputFilePath)
-	} else if config.FsType == "gcs" {
-		outputFilePath := fmt.Sprintf("%s/attempt%d.json", job.OutputDir, attemptNum)
-		job.Log().Info().Msgf("writeAttemptResumedataJSON to GCS bucket, path: %s", outputFilePath)
-		err = fs.WriteFile(outputFilePath, []byte(updatedContent))
-		if err != nil {
-			job.Log().Error().Msgf("Error writing content to file: %v", err)
-			return err
-		}
-		job.Log().Trace().Msg("writeAttemptResumedataJSON thinks it got past that.")
-	}
-
 	// Example: /home/user/output/validated_content.json
 	localOutfilePath := filepath.Join(job.OutputDir, fmt.Sprintf("attempt%d.json", attemptNum))
 	err = WriteValidatedContent(updatedContent, localOutfilePath)
@@ -205,83 +156,24 @@ func stripStringOfWhiteSpace(in string) string {
 	return spaceStripRe.ReplaceAllString(in, "")
 }
 
-func resumeComposePrompt(job *job.Job, keywords []string) string {
-	kwPrompt := ""
-	if len(keywords) > 0 {
-		kwPrompt = "The adjusted resume data should contain as many of the following keywords as is reasonable/possible: " + strings.Join(keywords, ", ") + "\n"
+// supplementResumeData pulls just the resumedata out of a supplement template, for use in a cover letter prompt.
+func supplementResumeData(job *job.Job) string {
+	log.Trace().Msgf("supplementResumeData: job %s", spew.Sprint(job))
+	if job.SupplementData == nil {
+		return ""
 	}
-	prompt_parts := []string{
-		job.MainPrompt,
-		"\n--- start job description ---\n",
-		job.JobDescription,
-		"\n--- end job description ---\n",
-		kwPrompt,
-		"The following JSON resume data represents the work history, skills, competencies and education for the candidate:\n",
-		job.BaselineJSON,
+	//ok so this will be the raw json from a template. not sure i want to just jam that right into a prompt lol! ... so for now, i will extract the 'resumedata'
+	var decoded map[string]interface{}
+	err := json.Unmarshal(job.SupplementData, &decoded)
+	if err != nil {
+		return ""
 	}
-
-	//perhaps the resumedata should be at the start and the instructions of what to do with it should come after? need to a/b test this stuff somehow.
-	//prompt_parts := []string{
-	//	"The following JSON resume data represents the work history, skills, competencies and education for the candidate:\n",
-	//	baselineJSON,
-	//	"\n--- start job description ---\n",
-	//	input.JD,
-	//	"\n--- end job description ---\n",
-	//	kwPrompt,
-	//	mainPrompt,
-	//}
-
-	return strings.Join(prompt_parts, "")
-}
-
-func coverletterComposePrompt(job *job.Job, keywords []string) string {
-
-	// cover letter prompt is a little different and can also refer to resumedata supplement.
-
-	log.Trace().Msgf("coverletterComposePrompt: job %s", spew.Sprint(job))
-
-	var supplement string
-	if job.SupplementData != nil {
-		//ok so this will be the raw json from a template. not sure i want to just jam that right into a prompt lol! ... so for now, i will extract the 'resumedata'
-		var decoded interface{}
-		err := json.Unmarshal(job.SupplementData, &decoded)
+	if resumedata, ok := decoded["resumedata"]; ok {
+		reEncoded, err := json.Marshal(resumedata)
 		if err == nil {
-			if resumedata, ok := decoded.(map[string]interface{})["resumedata"]; ok {
-				reEncoded, err := json.Marshal(resumedata)
-				if err == nil {
-					supplement = string(reEncoded)
-					log.Info().Msgf("reencoded just the resumedata to: %s", supplement)
-				}
-			}
+			log.Info().Msgf("reencoded just the resumedata to: %s", string(reEncoded))
+			return string(reEncoded)
 		}
 	}
-
-	prompt_parts := []string{}
-	if supplement != "" {
-		prompt_parts = append(prompt_parts, []string{
-			"Candidate info to inform and supplement the contents of the cover letter:\n",
-			"\n--- start candidate info ---\n",
-			supplement,
-			"\n--- end candidate info ---\n",
-		}...)
-	}
-
-	prompt_parts = append(prompt_parts, []string{
-		job.MainPrompt,
-		"\n--- start job description ---\n",
-		job.JobDescription,
-		"\n--- end job description ---\n",
-	}...)
-
-	if len(keywords) > 0 {
-		prompt_parts = append(prompt_parts, "The adjusted cover letter data should contain as many of the following keywords as is reasonable/possible: "+strings.Join(keywords, ", ")+"\n")
-	}
-
-	//for now lets include a baseline cover letter but i'd like to be able to control whether we do this or not somehow, because if a supplementary info is included then i'm not sure some predefined cover letter adds any value or might just confuse the gpt context
-	prompt_parts = append(prompt_parts, []string{
-		"The following JSON cover letter data represents a draft version supplied by the candidate. We should improve upon it or completely rewrite it if needed.\n",
-		job.BaselineJSON,
-	}...)
-
-	return strings.Join(prompt_parts, "")
+	return ""
 }